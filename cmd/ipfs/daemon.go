@@ -25,6 +25,8 @@ import (
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
 	libp2p "github.com/ipfs/go-ipfs/core/node/libp2p"
 	nodeMount "github.com/ipfs/go-ipfs/fuse/node"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	pinqueue "github.com/ipfs/go-ipfs/pinqueue"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	migrate "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
 	sockets "github.com/libp2p/go-socket-activation"
@@ -94,6 +96,11 @@ other computers in the network, use 0.0.0.0 as the ip address:
 
   ipfs config Addresses.Gateway /ip4/0.0.0.0/tcp/8080
 
+To serve the gateway over HTTPS, end its address with /tls, with the
+certificates configured in the GatewayTLS section of the config:
+
+  ipfs config Addresses.Gateway /ip4/0.0.0.0/tcp/443/tls
+
 Be careful if you expose the API. It is a security risk, as anyone could
 control your node remotely. If you need to control the node remotely,
 make sure to protect the port as you would other services or database
@@ -293,6 +300,14 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	// fail before we get to that. It can't hurt to close it twice.
 	defer repo.Close()
 
+	// Unlock an encrypted keystore right away rather than when a key is first
+	// needed, so a missing or wrong passphrase is reported on startup.
+	if ks, ok := repo.Keystore().(*keystore.EncryptedKeystore); ok {
+		if err := ks.Unlock(); err != nil {
+			return err
+		}
+	}
+
 	offline, _ := req.Options[offlineKwd].(bool)
 	ipnsps, _ := req.Options[enableIPNSPubSubKwd].(bool)
 	pubsub, _ := req.Options[enablePubSubKwd].(bool)
@@ -400,6 +415,9 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 		return err
 	}
 
+	// pin the objects queued with 'ipfs pin add --background'
+	go node.PinQueue.Run(req.Context, pinqueue.DefaultWorkers)
+
 	// construct http gateway
 	gwErrc, err := serveHTTPGateway(req, cctx)
 	if err != nil {
@@ -606,6 +624,10 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 		listenerAddrs[string(listener.Multiaddr().Bytes())] = true
 	}
 
+	// the listeners of the addresses ending with /tls or /https, with the
+	// suffix of their address
+	tlsListeners := make(map[manet.Listener]ma.Multiaddr)
+
 	gatewayAddrs := cfg.Addresses.Gateway
 	for _, addr := range gatewayAddrs {
 		gatewayMaddr, err := ma.NewMultiaddr(addr)
@@ -613,16 +635,21 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 			return nil, fmt.Errorf("serveHTTPGateway: invalid gateway address: %q (err: %s)", addr, err)
 		}
 
-		if listenerAddrs[string(gatewayMaddr.Bytes())] {
+		listenMaddr, isTLS := corehttp.SplitTLS(gatewayMaddr)
+		if listenerAddrs[string(listenMaddr.Bytes())] {
 			continue
 		}
 
-		gwLis, err := manet.Listen(gatewayMaddr)
+		gwLis, err := manet.Listen(listenMaddr)
 		if err != nil {
-			return nil, fmt.Errorf("serveHTTPGateway: manet.Listen(%s) failed: %s", gatewayMaddr, err)
+			return nil, fmt.Errorf("serveHTTPGateway: manet.Listen(%s) failed: %s", listenMaddr, err)
 		}
-		listenerAddrs[string(gatewayMaddr.Bytes())] = true
+		listenerAddrs[string(listenMaddr.Bytes())] = true
 		listeners = append(listeners, gwLis)
+		if isTLS {
+			_, tlsMaddr := ma.SplitLast(gatewayMaddr)
+			tlsListeners[gwLis] = tlsMaddr
+		}
 	}
 
 	// we might have listened to /tcp/0 - let's see what we are listing on
@@ -632,20 +659,65 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 	}
 
 	for _, listener := range listeners {
-		fmt.Printf("Gateway (%s) server listening on %s\n", gwType, listener.Multiaddr())
+		addr := listener.Multiaddr()
+		if tlsMaddr, ok := tlsListeners[listener]; ok {
+			addr = addr.Encapsulate(tlsMaddr)
+		}
+		fmt.Printf("Gateway (%s) server listening on %s\n", gwType, addr)
 	}
 
 	cmdctx := *cctx
 	cmdctx.Gateway = true
 
+	node, err := cctx.ConstructNode()
+	if err != nil {
+		return nil, fmt.Errorf("serveHTTPGateway: ConstructNode() failed: %s", err)
+	}
+
+	pinningCfg, err := corehttp.LoadPinningServiceConfig(node.Repo)
+	if err != nil {
+		return nil, fmt.Errorf("serveHTTPGateway: %s", err)
+	}
+
+	limitsCfg, err := corehttp.LoadGatewayLimitsConfig(node.Repo)
+	if err != nil {
+		return nil, fmt.Errorf("serveHTTPGateway: %s", err)
+	}
+
+	var gwTLS *corehttp.GatewayTLS
+	if len(tlsListeners) > 0 {
+		if gwTLS, err = corehttp.LoadGatewayTLS(node); err != nil {
+			return nil, fmt.Errorf("serveHTTPGateway: %s", err)
+		}
+	}
+
 	var opts = []corehttp.ServeOption{
 		corehttp.MetricsCollectionOption("gateway"),
+	}
+
+	// the http-01 challenges of ACME are answered before the requests reach
+	// the gateway
+	if gwTLS != nil {
+		opts = append(opts, gwTLS.ACMEChallengeOption())
+	}
+
+	// the pinning service is registered before the hostname option, which
+	// only lets known gateways serve the gateway paths
+	if pinningCfg.Enabled {
+		if len(pinningCfg.AccessTokens) == 0 {
+			return nil, fmt.Errorf("serveHTTPGateway: PinningService.AccessTokens must not be empty")
+		}
+		opts = append(opts, corehttp.PinningServiceOption(pinningCfg))
+	}
+
+	opts = append(opts,
 		corehttp.HostnameOption(),
+		corehttp.GatewayLimitsOption(limitsCfg),
 		corehttp.GatewayOption(writable, "/ipfs", "/ipns"),
 		corehttp.VersionOption(),
 		corehttp.CheckVersionOption(),
 		corehttp.CommandsROOption(cmdctx),
-	}
+	)
 
 	if cfg.Experimental.P2pHttpProxy {
 		opts = append(opts, corehttp.P2PProxyOption())
@@ -655,19 +727,18 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 		opts = append(opts, corehttp.RedirectOption("", cfg.Gateway.RootRedirect))
 	}
 
-	node, err := cctx.ConstructNode()
-	if err != nil {
-		return nil, fmt.Errorf("serveHTTPGateway: ConstructNode() failed: %s", err)
-	}
-
 	errc := make(chan error)
 	var wg sync.WaitGroup
 	for _, lis := range listeners {
 		wg.Add(1)
-		go func(lis manet.Listener) {
+		netLis := manet.NetListener(lis)
+		if _, ok := tlsListeners[lis]; ok {
+			netLis = gwTLS.NewListener(netLis)
+		}
+		go func(lis net.Listener) {
 			defer wg.Done()
-			errc <- corehttp.Serve(node, manet.NetListener(lis), opts...)
-		}(lis)
+			errc <- corehttp.Serve(node, lis, opts...)
+		}(netLis)
 	}
 
 	go func() {
@@ -93,4 +93,6 @@ var cmdDetailsMap = map[string]cmdDetails{
 	"repo/fsck":   {cannotRunOnDaemon: true},
 	"config/edit": {cannotRunOnDaemon: true, doesNotUseRepo: true},
 	"cid":         {doesNotUseRepo: true},
+
+	"repo/encrypt-keystore": {cannotRunOnDaemon: true},
 }
@@ -32,6 +32,7 @@ import (
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
 	manet "github.com/multiformats/go-multiaddr-net"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 // log is the command logger
@@ -122,6 +123,9 @@ func mainRet() int {
 	// so we need to make sure it's stable
 	os.Args[0] = "ipfs"
 
+	// ask for the passphrase of encrypted keystores when it isn't in the env
+	fsrepo.KeystorePassphrase = keystorePassphrase
+
 	buildEnv := func(ctx context.Context, req *cmds.Request) (cmds.Environment, error) {
 		checkDebug(req)
 		repoPath, err := getRepoPath(req)
@@ -175,6 +179,20 @@ func mainRet() int {
 	return 0
 }
 
+// keystorePassphrase reads the keystore passphrase from the environment, or
+// prompts for it when running in a terminal.
+func keystorePassphrase() ([]byte, error) {
+	_, inEnv := os.LookupEnv(fsrepo.EnvKeystorePassphrase)
+	if inEnv || !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return fsrepo.EnvPassphrase()
+	}
+
+	fmt.Fprint(os.Stderr, "Enter keystore passphrase: ")
+	pass, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return pass, err
+}
+
 func insideGUI() bool {
 	return util.InsideGUI()
 }
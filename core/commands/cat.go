@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/denylist"
 
 	"github.com/ipfs/go-ipfs-cmds"
 	"github.com/ipfs/go-ipfs-files"
@@ -58,6 +59,12 @@ var CatCmd = &cmds.Command{
 			return err
 		}
 
+		for _, p := range req.Arguments {
+			if err := checkDenylist(req.Context, env, api, path.New(p)); err != nil {
+				return err
+			}
+		}
+
 		readers, length, err := cat(req.Context, api, req.Arguments, int64(offset), int64(max))
 		if err != nil {
 			return err
@@ -169,3 +176,53 @@ func cat(ctx context.Context, api iface.CoreAPI, paths []string, offset int64, m
 	}
 	return readers, length, nil
 }
+
+// commandDenylist returns the denylist of the node if the config enforces it
+// in commands, nil otherwise.
+func commandDenylist(env cmds.Environment) (*denylist.Denylist, error) {
+	nd, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := denylist.LoadConfig(nd.Repo)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Commands {
+		return nil, nil
+	}
+	return nd.Denylist, nil
+}
+
+// checkDenylist returns an error if the content at p is blocked by the
+// denylist of the node, when the config enforces it in commands.
+func checkDenylist(ctx context.Context, env cmds.Environment, api iface.CoreAPI, p path.Path) error {
+	dl, err := commandDenylist(env)
+	if err != nil || dl == nil {
+		return err
+	}
+
+	if dl.IsPathDenied(p.String()) {
+		return fmt.Errorf("%s: %w", p, denylist.ErrBlocked)
+	}
+	if p.Namespace() == "ipns" {
+		// the content may be blocked by a path under the root the name
+		// resolves to, which is checked before resolving the remainder
+		ipfsPath, err := api.Name().Resolve(ctx, p.String())
+		if err != nil {
+			return err
+		}
+		if dl.IsPathDenied(ipfsPath.String()) {
+			return fmt.Errorf("%s: %w", p, denylist.ErrBlocked)
+		}
+		p = ipfsPath
+	}
+	rp, err := api.ResolvePath(ctx, p)
+	if err != nil {
+		return err
+	}
+	if dl.IsPathDenied(rp.String()) || dl.IsCidDenied(rp.Cid()) {
+		return fmt.Errorf("%s: %w", p, denylist.ErrBlocked)
+	}
+	return nil
+}
@@ -133,6 +133,8 @@ func TestCommands(t *testing.T) {
 		"/id",
 		"/key",
 		"/key/gen",
+		"/key/export",
+		"/key/import",
 		"/key/list",
 		"/key/rename",
 		"/key/rm",
@@ -143,7 +145,14 @@ func TestCommands(t *testing.T) {
 		"/ls",
 		"/mount",
 		"/name",
+		"/name/create",
+		"/name/inspect",
 		"/name/publish",
+		"/name/put",
+		"/name/republish",
+		"/name/republish/now",
+		"/name/republish/pause",
+		"/name/republish/status",
 		"/name/pubsub",
 		"/name/pubsub/state",
 		"/name/pubsub/subs",
@@ -174,7 +183,16 @@ func TestCommands(t *testing.T) {
 		"/pin/add",
 		"/ping",
 		"/pin/ls",
+		"/pin/remote",
+		"/pin/remote/add",
+		"/pin/remote/ls",
+		"/pin/remote/rm",
+		"/pin/remote/service",
+		"/pin/remote/service/add",
+		"/pin/remote/service/ls",
+		"/pin/remote/service/rm",
 		"/pin/rm",
+		"/pin/status",
 		"/pin/update",
 		"/pin/verify",
 		"/pubsub",
@@ -189,6 +207,7 @@ func TestCommands(t *testing.T) {
 		"/repo/gc",
 		"/repo/stat",
 		"/repo/verify",
+		"/repo/encrypt-keystore",
 		"/repo/version",
 		"/resolve",
 		"/shutdown",
@@ -119,6 +119,12 @@ Set the value of the 'Datastore.Path' key:
 			return err
 		}
 
+		// the access tokens of the remote pinning services are as secret
+		// as the private key
+		if err := scrubRemotePinServiceKeys(output, len(args) == 1); err != nil {
+			return err
+		}
+
 		return cmds.EmitOnce(res, output)
 	},
 	Encoders: cmds.EncoderMap{
@@ -174,6 +180,7 @@ NOTE: For security reasons, this command will omit your private key. If you woul
 		if err != nil {
 			return err
 		}
+		scrubPath(cfg, remotePinServiceKeyPath)
 
 		return cmds.EmitOnce(res, &cfg)
 	},
@@ -372,6 +379,52 @@ func buildProfileHelp() string {
 	return out
 }
 
+// remotePinServiceKeyPath is the path of the access tokens of the remote
+// pinning services in the config, where "*" matches any service.
+var remotePinServiceKeyPath = strings.Split(RemoteServicesConfigKey+".*.API.Key", ".")
+
+// scrubRemotePinServiceKeys scrubs the access tokens of the remote pinning
+// services from a config field. Showing a token itself is an error.
+func scrubRemotePinServiceKeys(f *ConfigField, show bool) error {
+	segs := strings.Split(f.Key, ".")
+	if len(segs) > len(remotePinServiceKeyPath) {
+		segs = segs[:len(remotePinServiceKeyPath)]
+	}
+	for i, seg := range segs {
+		if remotePinServiceKeyPath[i] != "*" && remotePinServiceKeyPath[i] != seg {
+			return nil
+		}
+	}
+
+	if len(segs) < len(remotePinServiceKeyPath) {
+		scrubPath(f.Value, remotePinServiceKeyPath[len(segs):])
+		return nil
+	}
+	if show {
+		return errors.New("cannot show the keys of remote pinning services through API")
+	}
+	f.Value = nil
+	return nil
+}
+
+// scrubPath deletes the values at the given path of a config map, where "*"
+// matches any key.
+func scrubPath(v interface{}, path []string) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		delete(m, path[0])
+		return
+	}
+	for k, val := range m {
+		if path[0] == "*" || path[0] == k {
+			scrubPath(val, path[1:])
+		}
+	}
+}
+
 // scrubPrivKey scrubs private key for security reasons.
 func scrubPrivKey(cfg *config.Config) (map[string]interface{}, error) {
 	cfgMap, err := config.ToMap(cfg)
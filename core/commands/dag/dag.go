@@ -18,7 +18,6 @@ import (
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	files "github.com/ipfs/go-ipfs-files"
 	ipld "github.com/ipfs/go-ipld-format"
-	mdag "github.com/ipfs/go-merkledag"
 	ipfspath "github.com/ipfs/go-path"
 	"github.com/ipfs/interface-go-ipfs-core/options"
 	path "github.com/ipfs/interface-go-ipfs-core/path"
@@ -581,15 +580,7 @@ The output of blocks happens in strict DAG-traversal, first-seen, order.
 				close(errCh)
 			}()
 
-			if err := gocar.WriteCar(
-				req.Context,
-				mdag.NewSession(
-					req.Context,
-					node.DAG,
-				),
-				[]cid.Cid{c},
-				pipeW,
-			); err != nil {
+			if err := coredag.ExportCar(req.Context, node.DAG, c, pipeW); err != nil {
 				errCh <- err
 			}
 		}()
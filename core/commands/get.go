@@ -72,11 +72,30 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 
 		p := path.New(req.Arguments[0])
 
+		if err := checkDenylist(req.Context, env, api, p); err != nil {
+			return err
+		}
+
 		file, err := api.Unixfs().Get(req.Context, p)
 		if err != nil {
 			return err
 		}
 
+		// the content blocked under directories is left out
+		if dir, ok := file.(files.Directory); ok {
+			dl, err := commandDenylist(env)
+			if err != nil {
+				return err
+			}
+			if dl != nil {
+				rp, err := api.ResolvePath(req.Context, p)
+				if err != nil {
+					return err
+				}
+				file = dl.FilterDirectory(req.Context, api.Dag(), dir, rp.Cid(), p.String(), rp.String())
+			}
+		}
+
 		size, err := file.Size()
 		if err != nil {
 			return err
@@ -1,14 +1,22 @@
 package commands
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"text/tabwriter"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/e"
+	keystore "github.com/ipfs/go-ipfs/keystore"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	options "github.com/ipfs/interface-go-ipfs-core/options"
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
 )
 
 var KeyCmd = &cmds.Command{
@@ -26,10 +34,17 @@ publish'.
   > ipfs key list
   self
   mykey
+
+'ipfs key export' and 'ipfs key import' move keys between nodes.
+
+  > ipfs key export mykey
+  > ipfs key import mykey ./mykey.key
 		`,
 	},
 	Subcommands: map[string]*cmds.Command{
 		"gen":    keyGenCmd,
+		"export": keyExportCmd,
+		"import": keyImportCmd,
 		"list":   keyListCmd,
 		"rename": keyRenameCmd,
 		"rm":     keyRmCmd,
@@ -54,8 +69,15 @@ type KeyRenameOutput struct {
 }
 
 const (
-	keyStoreTypeOptionName = "type"
-	keyStoreSizeOptionName = "size"
+	keyStoreTypeOptionName     = "type"
+	keyStoreSizeOptionName     = "size"
+	keyStoreFormatOptionName   = "format"
+	keyStorePasswordOptionName = "password"
+)
+
+const (
+	keyFormatLibp2pProtobuf    = "libp2p-protobuf"
+	keyFormatPemPkcs8Encrypted = "pem-pkcs8-encrypted"
 )
 
 var keyGenCmd = &cmds.Command{
@@ -112,6 +134,203 @@ var keyGenCmd = &cmds.Command{
 	Type: KeyOutput{},
 }
 
+var keyExportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Export a keypair",
+		ShortDescription: `
+Exports a named key from the keystore to disk.
+
+By default, the output will be stored at './<key-name>.key', but an alternate
+path can be specified with '--output=<path>' or '-o=<path>'.
+
+The key is written in the libp2p protobuf encoding unless another format is
+selected with '--format':
+
+  libp2p-protobuf      unencrypted libp2p protobuf encoding (default)
+  pem-pkcs8-encrypted  PKCS#8 PEM encrypted with the key given in '--password'
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "name of key to export").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(outputOptionName, "o", "The path where the output should be stored."),
+		cmds.StringOption(keyStoreFormatOptionName, "f", "The format of the exported key: libp2p-protobuf, pem-pkcs8-encrypted.").WithDefault(keyFormatLibp2pProtobuf),
+		cmds.StringOption(keyStorePasswordOptionName, "Password used to encrypt the exported key."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		name := req.Arguments[0]
+		if name == "self" {
+			return fmt.Errorf("cannot export key with name 'self'")
+		}
+
+		sk, err := nd.Repo.Keystore().Get(name)
+		if err != nil {
+			return fmt.Errorf("key with name '%s' doesn't exist", name)
+		}
+
+		format, _ := req.Options[keyStoreFormatOptionName].(string)
+		password, _ := req.Options[keyStorePasswordOptionName].(string)
+
+		var encoded []byte
+		switch format {
+		case keyFormatLibp2pProtobuf:
+			encoded, err = crypto.MarshalPrivateKey(sk)
+		case keyFormatPemPkcs8Encrypted:
+			encoded, err = keystore.MarshalEncryptedPEM(sk, []byte(password))
+		default:
+			return fmt.Errorf("unrecognized key format: %s", format)
+		}
+		if err != nil {
+			return err
+		}
+
+		return res.Emit(bytes.NewReader(encoded))
+	},
+	PostRun: cmds.PostRunMap{
+		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
+			req := res.Request()
+
+			v, err := res.Next()
+			if err != nil {
+				return err
+			}
+
+			outReader, ok := v.(io.Reader)
+			if !ok {
+				return e.New(e.TypeErr(outReader, v))
+			}
+
+			outPath, _ := req.Options[outputOptionName].(string)
+			if outPath == "" {
+				trimmed := filepath.Base(req.Arguments[0])
+				outPath = filepath.Clean(trimmed) + ".key"
+			}
+
+			// create file
+			file, err := os.OpenFile(outPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			_, err = io.Copy(file, outReader)
+			return err
+		},
+	},
+}
+
+var keyImportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Import a key and prints imported key id",
+		ShortDescription: `
+Imports a key produced by 'ipfs key export' into the keystore under the given
+name. Use '--format' and '--password' to import an encrypted PEM key.
+
+Importing refuses to overwrite an existing key unless '--force' is given.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "name to associate with key in keychain"),
+		cmds.FileArg("key", true, false, "key provided by generate or export"),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(keyStoreFormatOptionName, "f", "The format of the imported key: libp2p-protobuf, pem-pkcs8-encrypted.").WithDefault(keyFormatLibp2pProtobuf),
+		cmds.StringOption(keyStorePasswordOptionName, "Password used to decrypt the imported key."),
+		cmds.BoolOption(keyStoreForceOptionName, "Allow to overwrite an existing key."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		name := req.Arguments[0]
+		if name == "self" {
+			return fmt.Errorf("cannot import key with name 'self'")
+		}
+
+		file, err := cmdenv.GetFileArg(req.Files.Entries())
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			return err
+		}
+
+		format, _ := req.Options[keyStoreFormatOptionName].(string)
+		password, _ := req.Options[keyStorePasswordOptionName].(string)
+
+		var sk crypto.PrivKey
+		switch format {
+		case keyFormatLibp2pProtobuf:
+			sk, err = crypto.UnmarshalPrivateKey(data)
+		case keyFormatPemPkcs8Encrypted:
+			sk, err = keystore.UnmarshalEncryptedPEM(data, []byte(password))
+		default:
+			return fmt.Errorf("unrecognized key format: %s", format)
+		}
+		if err != nil {
+			return err
+		}
+
+		pid, err := peer.IDFromPrivateKey(sk)
+		if err != nil {
+			return err
+		}
+
+		ks := nd.Repo.Keystore()
+		force, _ := req.Options[keyStoreForceOptionName].(bool)
+
+		err = ks.Put(name, sk)
+		if err == keystore.ErrKeyExists && force {
+			err = replaceKey(ks, name, sk)
+		}
+		if err != nil {
+			return err
+		}
+
+		return cmds.EmitOnce(res, &KeyOutput{
+			Name: name,
+			Id:   pid.Pretty(),
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ko *KeyOutput) error {
+			_, err := w.Write([]byte(ko.Id + "\n"))
+			return err
+		}),
+	},
+	Type: KeyOutput{},
+}
+
+// replaceKey overwrites the key of the given name, restoring the previous key
+// if the new one can't be stored.
+func replaceKey(ks keystore.Keystore, name string, sk crypto.PrivKey) error {
+	old, err := ks.Get(name)
+	if err != nil {
+		return err
+	}
+	if err := ks.Delete(name); err != nil {
+		return err
+	}
+	if err := ks.Put(name, sk); err != nil {
+		if rerr := ks.Put(name, old); rerr != nil {
+			return fmt.Errorf("%s, and failed to restore the previous key: %s", err, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
 var keyListCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "List all local keypairs",
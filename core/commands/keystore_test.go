@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/keystore"
+
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
+	pb "github.com/libp2p/go-libp2p-core/crypto/pb"
+)
+
+// failingKeystore fails to store the keys of the given type.
+type failingKeystore struct {
+	keystore.Keystore
+	keyType pb.KeyType
+}
+
+func (ks *failingKeystore) Put(name string, k crypto.PrivKey) error {
+	if k.Type() == ks.keyType {
+		return errors.New("failed to store the key")
+	}
+	return ks.Keystore.Put(name, k)
+}
+
+func TestReplaceKey(t *testing.T) {
+	ks := &failingKeystore{Keystore: keystore.NewMemKeystore(), keyType: pb.KeyType_Secp256k1}
+
+	old, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, 0, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("key", old); err != nil {
+		t.Fatal(err)
+	}
+
+	// the previous key is kept if the new one can't be stored
+	failing, _, err := crypto.GenerateKeyPairWithReader(crypto.Secp256k1, 0, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceKey(ks, "key", failing); err == nil {
+		t.Fatal("expected the replacement to fail")
+	}
+	if k, err := ks.Get("key"); err != nil || !k.Equals(old) {
+		t.Fatalf("expected the previous key to be restored, got %v", err)
+	}
+
+	sk, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, 0, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceKey(ks, "key", sk); err != nil {
+		t.Fatal(err)
+	}
+	if k, err := ks.Get("key"); err != nil || !k.Equals(sk) {
+		t.Fatalf("expected the key to be replaced, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package name
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ipfs/go-ipfs/core"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/keystore"
+	"github.com/ipfs/go-ipfs/namesys"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	files "github.com/ipfs/go-ipfs-files"
+	path "github.com/ipfs/go-path"
+	iface "github.com/ipfs/interface-go-ipfs-core"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	batchOptionName       = "batch"
+	concurrencyOptionName = "concurrency"
+)
+
+// BatchEntry is an entry of the file of 'ipfs name publish --batch'. The
+// options of the command are the defaults of the empty fields.
+type BatchEntry struct {
+	Key      string
+	Value    string
+	Lifetime string
+	TTL      string
+}
+
+// openBatchFile sends the batch file given instead of an ipfs path as the
+// file of the request, so that it's read by the daemon.
+func openBatchFile(req *cmds.Request, env cmds.Environment) error {
+	if batch, _ := req.Options[batchOptionName].(bool); !batch || len(req.Arguments) == 0 {
+		return nil
+	}
+	f, err := os.Open(req.Arguments[0])
+	if err != nil {
+		return err
+	}
+	req.Files = files.NewMapDirectory(map[string]files.Node{
+		batchOptionName: files.NewReaderFile(f),
+	})
+	return nil
+}
+
+// publishBatch publishes the names listed in the batch file, once all of them
+// are known to be publishable, emitting the outcome of each of them.
+func publishBatch(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return err
+	}
+	api, err := cmdenv.GetApi(env, req)
+	if err != nil {
+		return err
+	}
+
+	allowOffline, _ := req.Options[allowOfflineOptionName].(bool)
+	if err := checkPublishAllowed(n, allowOffline); err != nil {
+		return err
+	}
+
+	file, err := batchFile(req)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var batch []BatchEntry
+	if err := json.NewDecoder(file).Decode(&batch); err != nil {
+		return fmt.Errorf("invalid batch file: %s", err)
+	}
+
+	entries := make([]namesys.BatchEntry, len(batch))
+	for i := range batch {
+		b := &batch[i]
+		if b.Key == "" {
+			b.Key, _ = req.Options[keyOptionName].(string)
+		}
+		if b.Lifetime == "" {
+			b.Lifetime, _ = req.Options[lifeTimeOptionName].(string)
+		}
+		if b.TTL == "" {
+			b.TTL, _ = req.Options[ttlOptionName].(string)
+		}
+
+		e, err := newBatchEntry(req, n, api, *b)
+		if err != nil {
+			return fmt.Errorf("batch entry %d (key %s): %s", i, b.Key, err)
+		}
+		entries[i] = e
+	}
+
+	concurrency, _ := req.Options[concurrencyOptionName].(int)
+	results, err := namesys.PublishBatch(req.Context, n.Namesys, entries, concurrency)
+	if err != nil {
+		return err
+	}
+
+	var published, failed int
+	for r := range results {
+		out := &IpnsEntry{
+			Key:   batch[r.Entry].Key,
+			Name:  peer.Encode(r.ID),
+			Value: entries[r.Entry].Value.String(),
+		}
+		if r.Err != nil {
+			out.Error = r.Err.Error()
+			failed++
+		} else {
+			published++
+		}
+		if err := res.Emit(out); err != nil {
+			return err
+		}
+	}
+
+	if err := req.Context.Err(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to publish %d of %d names", failed, published+failed)
+	}
+	return nil
+}
+
+// batchFile returns the batch file of the request, which the daemon receives
+// as the body of the argument read from stdin.
+func batchFile(req *cmds.Request) (io.ReadCloser, error) {
+	if req.Files != nil {
+		return cmdenv.GetFileArg(req.Files.Entries())
+	}
+	if body := req.BodyArgs(); body != nil {
+		return body, nil
+	}
+	return nil, errors.New("no batch file given")
+}
+
+// newBatchEntry checks the entry, returning what to publish.
+func newBatchEntry(req *cmds.Request, n *core.IpfsNode, api iface.CoreAPI, b BatchEntry) (namesys.BatchEntry, error) {
+	var e namesys.BatchEntry
+
+	p, err := path.ParsePath(b.Value)
+	if err != nil {
+		return e, err
+	}
+	if verifyExists, _ := req.Options[resolveOptionName].(bool); verifyExists {
+		if _, err := api.ResolveNode(req.Context, ipath.New(b.Value)); err != nil {
+			return e, err
+		}
+	}
+
+	validTime, err := time.ParseDuration(b.Lifetime)
+	if err != nil {
+		return e, fmt.Errorf("error parsing lifetime: %s", err)
+	}
+	var ttl time.Duration
+	if b.TTL != "" {
+		if ttl, err = time.ParseDuration(b.TTL); err != nil {
+			return e, fmt.Errorf("error parsing TTL: %s", err)
+		}
+	}
+
+	k, err := keystore.Lookup(n.PrivateKey, n.Repo.Keystore(), b.Key)
+	if err != nil {
+		return e, err
+	}
+
+	return namesys.BatchEntry{
+		Key:   k,
+		Value: p,
+		EOL:   time.Now().Add(validTime),
+		TTL:   ttl,
+	}, nil
+}
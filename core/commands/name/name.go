@@ -7,6 +7,9 @@ import (
 type IpnsEntry struct {
 	Name  string
 	Value string
+	// Key and Error are set by batch publishing.
+	Key   string `json:",omitempty"`
+	Error string `json:",omitempty"`
 }
 
 var NameCmd = &cmds.Command{
@@ -59,8 +62,12 @@ Resolve the value of a dnslink:
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"publish": PublishCmd,
-		"resolve": IpnsCmd,
-		"pubsub":  IpnsPubsubCmd,
+		"publish":   PublishCmd,
+		"resolve":   IpnsCmd,
+		"pubsub":    IpnsPubsubCmd,
+		"create":    CreateCmd,
+		"inspect":   InspectCmd,
+		"put":       PutCmd,
+		"republish": RepublishCmd,
 	},
 }
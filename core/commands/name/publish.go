@@ -7,6 +7,7 @@ import (
 	"time"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/namesys"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	iface "github.com/ipfs/interface-go-ipfs-core"
@@ -65,11 +66,26 @@ Alternatively, publish an <ipfs-path> using a valid PeerID (as listed by
  > ipfs name publish --key=QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
   Published to QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
 
+Publish many names at once, listed in a JSON file:
+
+  > cat batch.json
+  [
+    {"Key": "customer-1", "Value": "/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy"},
+    {"Key": "customer-2", "Value": "/ipfs/QmSiTko9JZyabH56y2fussEt1A5oDqsFXB3CkvAqraFryz", "Lifetime": "48h", "TTL": "1m"}
+  ]
+  > ipfs name publish --batch batch.json
+  Published to QmSrPmbaUKA3ZodhzPWZnpFgcPMFWF4QsxXbkWfEptTBJd: /ipfs/QmSiTko9JZyabH56y2fussEt1A5oDqsFXB3CkvAqraFryz
+  Published to QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+
+The options are the defaults of the fields missing from the entries. Nothing is
+published unless all the entries are valid, and --concurrency names are
+published at the same time, each reported once published or failed.
+
 `,
 	},
 
 	Arguments: []cmds.Argument{
-		cmds.StringArg(ipfsPathOptionName, true, false, "ipfs path of the object to be published.").EnableStdin(),
+		cmds.StringArg(ipfsPathOptionName, true, false, "ipfs path of the object to be published, or the path of the batch file with --batch.").EnableStdin(),
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(resolveOptionName, "Check if the given path can be resolved before publishing.").WithDefault(true),
@@ -81,8 +97,15 @@ Alternatively, publish an <ipfs-path> using a valid PeerID (as listed by
 		cmds.StringOption(ttlOptionName, "Time duration this record should be cached for. Uses the same syntax as the lifetime option. (caution: experimental)"),
 		cmds.StringOption(keyOptionName, "k", "Name of the key to be used or a valid PeerID, as listed by 'ipfs key list -l'.").WithDefault("self"),
 		cmds.BoolOption(quieterOptionName, "Q", "Write only final hash."),
+		cmds.BoolOption(batchOptionName, "Publish the names listed in the JSON file given instead of an ipfs path."),
+		cmds.IntOption(concurrencyOptionName, "Number of names of a batch published at the same time.").WithDefault(namesys.DefaultBatchConcurrency),
 	},
+	PreRun: openBatchFile,
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		if batch, _ := req.Options[batchOptionName].(bool); batch {
+			return publishBatch(req, res, env)
+		}
+
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
@@ -138,9 +161,12 @@ Alternatively, publish an <ipfs-path> using a valid PeerID (as listed by
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ie *IpnsEntry) error {
 			var err error
 			quieter, _ := req.Options[quieterOptionName].(bool)
-			if quieter {
+			switch {
+			case ie.Error != "":
+				_, err = fmt.Fprintf(w, "Error publishing to %s (key %s): %s\n", ie.Name, ie.Key, ie.Error)
+			case quieter:
 				_, err = fmt.Fprintln(w, ie.Name)
-			} else {
+			default:
 				_, err = fmt.Fprintf(w, "Published to %s: %s\n", ie.Name, ie.Value)
 			}
 			return err
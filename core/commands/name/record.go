@@ -0,0 +1,349 @@
+package name
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ipfs/go-ipfs/core"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/keystore"
+	"github.com/ipfs/go-ipfs/namesys"
+
+	proto "github.com/gogo/protobuf/proto"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	ipns "github.com/ipfs/go-ipns"
+	pb "github.com/ipfs/go-ipns/pb"
+	path "github.com/ipfs/go-path"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	sequenceOptionName = "sequence"
+	verifyOptionName   = "verify"
+)
+
+// maxRecordSize is the size of the largest records read, the size of the
+// largest values accepted by the DHT.
+const maxRecordSize = 10 << 10
+
+var CreateCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Create a signed IPNS record.",
+		ShortDescription: `
+Create an IPNS record of an <ipfs-path>, signed with a key of the node, and
+write it to the standard output without publishing it. The record can be
+published later with 'ipfs name put', by a node without the key.
+`,
+		LongDescription: `
+Create an IPNS record of an <ipfs-path>, signed with a key of the node, and
+write it to the standard output without publishing it. The record can be
+published later with 'ipfs name put', by a node without the key, which
+allows keeping the keys of names on an offline machine.
+
+The sequence number of the record follows the one of the last record this
+node published for the name, unless given. Records with a lower sequence
+number than the record published for a name are ignored by the network.
+
+Examples:
+
+Sign a record with a key on an offline machine:
+
+  > ipfs name create --key=mykey /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy > record.bin
+
+Publish it from an online node:
+
+  > ipfs name put QmSrPmbaUKA3ZodhzPWZnpFgcPMFWF4QsxXbkWfEptTBJd record.bin
+  Published to QmSrPmbaUKA3ZodhzPWZnpFgcPMFWF4QsxXbkWfEptTBJd: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg(ipfsPathOptionName, true, false, "ipfs path of the object the record points to.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(keyOptionName, "k", "Name of the key to sign the record with or a valid PeerID, as listed by 'ipfs key list -l'.").WithDefault("self"),
+		cmds.StringOption(lifeTimeOptionName, "t",
+			`Time duration that the record will be valid for. <<default>>
+    This accepts durations such as "300s", "1.5h" or "2h45m". Valid time units are
+    "ns", "us" (or "µs"), "ms", "s", "m", "h".`).WithDefault("24h"),
+		cmds.StringOption(ttlOptionName, "Time duration this record should be cached for. Uses the same syntax as the lifetime option. (caution: experimental)"),
+		cmds.Uint64Option(sequenceOptionName, "Sequence number of the record, following the last one published by this node if unset."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		p, err := path.ParsePath(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		validTimeOpt, _ := req.Options[lifeTimeOptionName].(string)
+		validTime, err := time.ParseDuration(validTimeOpt)
+		if err != nil {
+			return fmt.Errorf("error parsing lifetime option: %s", err)
+		}
+
+		var ttl time.Duration
+		if ttlOpt, found := req.Options[ttlOptionName].(string); found {
+			if ttl, err = time.ParseDuration(ttlOpt); err != nil {
+				return err
+			}
+		}
+
+		kname, _ := req.Options[keyOptionName].(string)
+		k, err := keystore.Lookup(n.PrivateKey, n.Repo.Keystore(), kname)
+		if err != nil {
+			return err
+		}
+		id, err := peer.IDFromPrivateKey(k)
+		if err != nil {
+			return err
+		}
+
+		seqno, found := req.Options[sequenceOptionName].(uint64)
+		if !found {
+			publisher := namesys.NewIpnsPublisher(n.Routing, n.Repo.Datastore())
+			if seqno, err = publisher.NextSequence(req.Context, id, p); err != nil {
+				return err
+			}
+		}
+
+		entry, err := namesys.CreateRecord(k, p, seqno, time.Now().Add(validTime), ttl)
+		if err != nil {
+			return err
+		}
+		data, err := proto.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return res.Emit(bytes.NewReader(data))
+	},
+}
+
+// IpnsRecord describes an IPNS record.
+type IpnsRecord struct {
+	Value        string
+	ValidityType string
+	Validity     time.Time
+	Sequence     uint64
+	TTL          time.Duration
+	Expired      bool
+	Validation   *IpnsRecordValidation `json:",omitempty"`
+}
+
+// IpnsRecordValidation is the result of checking the signature of a record.
+type IpnsRecordValidation struct {
+	Name   string
+	Valid  bool
+	Reason string `json:",omitempty"`
+}
+
+var InspectCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Inspect an IPNS record.",
+		ShortDescription: `
+Print the value, validity, sequence number and TTL of an IPNS record, like
+the ones created with 'ipfs name create', and whether its signature is valid.
+
+The signature is checked against the public key embedded in the record, or
+the key of the name given with --verify.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.FileArg("record", true, false, "The file containing the record.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(verifyOptionName, "Name whose key the signature is checked against."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		entry, err := readRecord(req)
+		if err != nil {
+			return err
+		}
+
+		out := &IpnsRecord{
+			Value:        string(entry.GetValue()),
+			ValidityType: entry.GetValidityType().String(),
+			Sequence:     entry.GetSequence(),
+			TTL:          time.Duration(entry.GetTtl()),
+		}
+		if entry.GetValidityType() == pb.IpnsEntry_EOL {
+			if out.Validity, err = ipns.GetEOL(entry); err != nil {
+				return err
+			}
+			out.Expired = time.Now().After(out.Validity)
+		}
+
+		var id peer.ID
+		if name, found := req.Options[verifyOptionName].(string); found {
+			if id, err = peer.Decode(strings.TrimPrefix(name, "/ipns/")); err != nil {
+				return fmt.Errorf("invalid name %q: %s", name, err)
+			}
+		} else if len(entry.GetPubKey()) > 0 {
+			// the record is checked against the key it embeds
+			pk, err := ci.UnmarshalPublicKey(entry.GetPubKey())
+			if err != nil {
+				return fmt.Errorf("invalid public key in the record: %s", err)
+			}
+			if id, err = peer.IDFromPublicKey(pk); err != nil {
+				return err
+			}
+		}
+		if id != "" {
+			out.Validation = validateRecord(id, entry)
+		}
+
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *IpnsRecord) error {
+			tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+			fmt.Fprintf(tw, "Value:\t%s\n", out.Value)
+			fmt.Fprintf(tw, "Validity Type:\t%s\n", out.ValidityType)
+			if !out.Validity.IsZero() {
+				validity := out.Validity.Format(time.RFC3339Nano)
+				if out.Expired {
+					validity += " (expired)"
+				}
+				fmt.Fprintf(tw, "Validity:\t%s\n", validity)
+			}
+			fmt.Fprintf(tw, "Sequence:\t%d\n", out.Sequence)
+			if out.TTL > 0 {
+				fmt.Fprintf(tw, "TTL:\t%s\n", out.TTL)
+			}
+			if v := out.Validation; v != nil {
+				fmt.Fprintf(tw, "Name:\t%s\n", v.Name)
+				if v.Valid {
+					fmt.Fprintf(tw, "Signature:\tvalid\n")
+				} else {
+					fmt.Fprintf(tw, "Signature:\tinvalid: %s\n", v.Reason)
+				}
+			} else {
+				fmt.Fprintf(tw, "Signature:\tunverified (no public key, use --%s)\n", verifyOptionName)
+			}
+			return tw.Flush()
+		}),
+	},
+	Type: IpnsRecord{},
+}
+
+// validateRecord checks the signature of the record against the key of the
+// name. Expired records are reported as valid, since their expiration is
+// reported apart.
+func validateRecord(id peer.ID, entry *pb.IpnsEntry) *IpnsRecordValidation {
+	v := &IpnsRecordValidation{Name: peer.Encode(id)}
+	pk, err := ipns.ExtractPublicKey(id, entry)
+	if err != nil {
+		v.Reason = err.Error()
+		return v
+	}
+	if err := ipns.Validate(pk, entry); err != nil && err != ipns.ErrExpiredRecord {
+		v.Reason = err.Error()
+		return v
+	}
+	v.Valid = true
+	return v
+}
+
+var PutCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Publish a signed IPNS record.",
+		ShortDescription: `
+Publish an IPNS record for a <name>, like the ones created with
+'ipfs name create'. The record must be signed with the key of the name,
+which the node doesn't need to have.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "The IPNS name the record is published for."),
+		cmds.FileArg("record", true, false, "The file containing the record.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(allowOfflineOptionName, "When offline, save the IPNS record to the the local datastore without broadcasting to the network instead of simply failing."),
+		cmds.BoolOption(quieterOptionName, "Q", "Write only final hash."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		allowOffline, _ := req.Options[allowOfflineOptionName].(bool)
+		if err := checkPublishAllowed(n, allowOffline); err != nil {
+			return err
+		}
+
+		name := req.Arguments[0]
+		id, err := peer.Decode(strings.TrimPrefix(name, "/ipns/"))
+		if err != nil {
+			return fmt.Errorf("invalid name %q: %s", name, err)
+		}
+
+		entry, err := readRecord(req)
+		if err != nil {
+			return err
+		}
+
+		putter, ok := n.Namesys.(namesys.RecordPutter)
+		if !ok {
+			return errors.New("the name system can't publish records")
+		}
+		if err := putter.PutRecord(req.Context, id, entry); err != nil {
+			return err
+		}
+
+		return cmds.EmitOnce(res, &IpnsEntry{
+			Name:  peer.Encode(id),
+			Value: string(entry.GetValue()),
+		})
+	},
+	Encoders: PublishCmd.Encoders,
+	Type:     IpnsEntry{},
+}
+
+// checkPublishAllowed checks that the node can publish names, as the name
+// API does.
+func checkPublishAllowed(n *core.IpfsNode, allowOffline bool) error {
+	if !n.IsOnline && !allowOffline {
+		return errAllowOffline
+	}
+	if n.Mounts.Ipns != nil && n.Mounts.Ipns.IsActive() {
+		return errors.New("cannot manually publish while IPNS is mounted")
+	}
+	return nil
+}
+
+// readRecord reads the record of the file argument.
+func readRecord(req *cmds.Request) (*pb.IpnsEntry, error) {
+	file, err := cmdenv.GetFileArg(req.Files.Entries())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(file, maxRecordSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxRecordSize {
+		return nil, fmt.Errorf("the record exceeds the maximum size of %d bytes", maxRecordSize)
+	}
+
+	entry := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("invalid IPNS record: %s", err)
+	}
+	return entry, nil
+}
@@ -0,0 +1,198 @@
+package name
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/keystore"
+	"github.com/ipfs/go-ipfs/namesys/republisher"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+const resumeOptionName = "resume"
+
+var errNoRepublisher = errors.New("the republisher only runs on online nodes. Try running 'ipfs daemon' first")
+
+// RepublishCmd manages the republisher, which republishes the records
+// published by the node before they expire.
+var RepublishCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the republishing of IPNS records.",
+		ShortDescription: `
+The daemon republishes the records of the names published by the node every
+Ipns.RepublishPeriod, so that they don't expire. These commands report the
+state of the republishing of each key, republish the records immediately, or
+pause the republishing of keys.
+
+The keys listed in IpnsRepublisher.Exclude in the config are never
+republished.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"status": republishStatusCmd,
+		"now":    republishNowCmd,
+		"pause":  republishPauseCmd,
+	},
+}
+
+var republishStatusCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the state of the republishing of the IPNS records.",
+		ShortDescription: `
+List the keys with a published record, with the end of the validity of the
+record, the last attempt to republish it and its outcome, and the next one.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		rp, err := getRepublisher(env)
+		if err != nil {
+			return err
+		}
+		st, err := rp.Status()
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, st)
+	},
+	Encoders: republishStatusEncoders,
+	Type:     republisher.Status{},
+}
+
+var republishNowCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Republish the IPNS records now.",
+		ShortDescription: `
+Republish the records of the keys that aren't paused or excluded immediately,
+instead of at the next scheduled time, and show the state of the
+republishing once done.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		rp, err := getRepublisher(env)
+		if err != nil {
+			return err
+		}
+		repubErr := rp.RepublishNow(req.Context)
+		if err := req.Context.Err(); err != nil {
+			return err
+		}
+
+		st, err := rp.Status()
+		if err != nil {
+			return err
+		}
+		if err := res.Emit(st); err != nil {
+			return err
+		}
+		return repubErr
+	},
+	Encoders: republishStatusEncoders,
+	Type:     republisher.Status{},
+}
+
+var republishPauseCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Pause the republishing of IPNS records.",
+		ShortDescription: `
+Stop republishing the records of the given keys, or of all of them if none is
+given, until the daemon restarts or they're resumed with --resume. The records
+expire at the end of their validity unless they're republished.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", false, true, "Names of the keys, or their PeerIDs, as listed by 'ipfs key list -l'."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(resumeOptionName, "Resume the republishing instead of pausing it."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		rp, err := getRepublisher(env)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]peer.ID, 0, len(req.Arguments))
+		for _, kname := range req.Arguments {
+			k, err := keystore.Lookup(n.PrivateKey, n.Repo.Keystore(), kname)
+			if err != nil {
+				return fmt.Errorf("%s: %s", kname, err)
+			}
+			id, err := peer.IDFromPrivateKey(k)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+
+		if resume, _ := req.Options[resumeOptionName].(bool); resume {
+			rp.Resume(ids...)
+		} else {
+			rp.Pause(ids...)
+		}
+
+		st, err := rp.Status()
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, st)
+	},
+	Encoders: republishStatusEncoders,
+	Type:     republisher.Status{},
+}
+
+var republishStatusEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, st *republisher.Status) error {
+		if st.Paused {
+			fmt.Fprintln(w, "Republishing paused")
+		} else {
+			fmt.Fprintf(w, "Next republishing: %s\n", formatTime(st.Next))
+		}
+		if len(st.Keys) == 0 {
+			return nil
+		}
+
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "Key\tName\tExpires\tLast attempt\tLast success\tNext attempt\tError")
+		for _, k := range st.Keys {
+			next := formatTime(k.NextAttempt)
+			switch {
+			case k.Excluded:
+				next = "excluded"
+			case k.Paused || st.Paused:
+				next = "paused"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", k.Key, k.Name, formatTime(k.EOL),
+				formatTime(k.LastAttempt), formatTime(k.LastSuccess), next, k.Error)
+		}
+		return tw.Flush()
+	}),
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func getRepublisher(env cmds.Environment) (*republisher.Republisher, error) {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	if !n.IsOnline || n.IpnsRepub == nil {
+		return nil, errNoRepublisher
+	}
+	return n.IpnsRepub, nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	bserv "github.com/ipfs/go-blockservice"
@@ -22,6 +23,8 @@ import (
 	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	e "github.com/ipfs/go-ipfs/core/commands/e"
+	"github.com/ipfs/go-ipfs/pinmeta"
+	"github.com/ipfs/go-ipfs/pinqueue"
 )
 
 var PinCmd = &cmds.Command{
@@ -35,6 +38,8 @@ var PinCmd = &cmds.Command{
 		"ls":     listPinCmd,
 		"verify": verifyPinCmd,
 		"update": updatePinCmd,
+		"remote": remotePinCmd,
+		"status": statusPinCmd,
 	},
 }
 
@@ -44,18 +49,32 @@ type PinOutput struct {
 
 type AddPinOutput struct {
 	Pins     []string
-	Progress int `json:",omitempty"`
+	Progress int  `json:",omitempty"`
+	Queued   bool `json:",omitempty"`
 }
 
 const (
 	pinRecursiveOptionName = "recursive"
 	pinProgressOptionName  = "progress"
+	pinNameOptionName      = "name"
+	pinLabelOptionName     = "label"
 )
 
 var addPinCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline:          "Pin objects to local storage.",
 		ShortDescription: "Stores an IPFS object(s) from a given path locally to disk.",
+		LongDescription: `
+Stores an IPFS object(s) from a given path locally to disk.
+
+Pins can be given a name with --name, and labels with --label key=value
+(which can be repeated), to tell them apart in 'ipfs pin ls'. Pinning an
+object again with --name or --label replaces its name and labels.
+
+With --background, the objects are queued and pinned in the background by the
+daemon, which resumes the pins that were interrupted when it restarts. Use
+'ipfs pin status' to follow their progress.
+`,
 	},
 
 	Arguments: []cmds.Argument{
@@ -64,9 +83,18 @@ var addPinCmd = &cmds.Command{
 	Options: []cmds.Option{
 		cmds.BoolOption(pinRecursiveOptionName, "r", "Recursively pin the object linked to by the specified object(s).").WithDefault(true),
 		cmds.BoolOption(pinProgressOptionName, "Show progress"),
+		cmds.StringOption(pinNameOptionName, "A name for the pin(s)."),
+		cmds.StringsOption(pinLabelOptionName, "A key=value label for the pin(s). Can be repeated."),
+		cmds.BoolOption(pinBackgroundOptionName, "Pin the object(s) in the background.").WithDefault(false),
 	},
-	Type: AddPinOutput{},
+	Type:   AddPinOutput{},
+	PreRun: joinLabelOptions,
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
@@ -76,6 +104,11 @@ var addPinCmd = &cmds.Command{
 		recursive, _ := req.Options[pinRecursiveOptionName].(bool)
 		showProgress, _ := req.Options[pinProgressOptionName].(bool)
 
+		meta, err := pinMetaOptions(req)
+		if err != nil {
+			return err
+		}
+
 		if err := req.ParseBodyArgs(); err != nil {
 			return err
 		}
@@ -85,8 +118,17 @@ var addPinCmd = &cmds.Command{
 			return err
 		}
 
+		if background, _ := req.Options[pinBackgroundOptionName].(bool); background {
+			queued, err := pinQueueMany(req.Context, api, n.PinQueue, enc, req.Arguments, recursive, meta)
+			if err != nil {
+				return err
+			}
+
+			return cmds.EmitOnce(res, &AddPinOutput{Pins: queued, Queued: true})
+		}
+
 		if !showProgress {
-			added, err := pinAddMany(req.Context, api, enc, req.Arguments, recursive)
+			added, err := pinAddMany(req.Context, api, n.PinMeta, enc, req.Arguments, recursive, meta)
 			if err != nil {
 				return err
 			}
@@ -104,7 +146,7 @@ var addPinCmd = &cmds.Command{
 
 		ch := make(chan pinResult, 1)
 		go func() {
-			added, err := pinAddMany(ctx, api, enc, req.Arguments, recursive)
+			added, err := pinAddMany(ctx, api, n.PinMeta, enc, req.Arguments, recursive, meta)
 			ch <- pinResult{pins: added, err: err}
 		}()
 
@@ -145,7 +187,11 @@ var addPinCmd = &cmds.Command{
 			}
 
 			for _, k := range out.Pins {
-				fmt.Fprintf(w, "pinned %s %s\n", k, pintype)
+				if out.Queued {
+					fmt.Fprintf(w, "queued %s to be pinned %s\n", k, pintype)
+				} else {
+					fmt.Fprintf(w, "pinned %s %s\n", k, pintype)
+				}
 			}
 
 			return nil
@@ -180,7 +226,7 @@ var addPinCmd = &cmds.Command{
 	},
 }
 
-func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder, paths []string, recursive bool) ([]string, error) {
+func pinAddMany(ctx context.Context, api coreiface.CoreAPI, store *pinmeta.Store, enc cidenc.Encoder, paths []string, recursive bool, meta pinmeta.Meta) ([]string, error) {
 	added := make([]string, len(paths))
 	for i, b := range paths {
 		rp, err := api.ResolvePath(ctx, path.New(b))
@@ -191,12 +237,103 @@ func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder,
 		if err := api.Pin().Add(ctx, rp, options.Pin.Recursive(recursive)); err != nil {
 			return nil, err
 		}
+		if !meta.IsEmpty() {
+			if err := store.Put(rp.Cid(), meta); err != nil {
+				return nil, err
+			}
+		}
 		added[i] = enc.Encode(rp.Cid())
 	}
 
 	return added, nil
 }
 
+// pinQueueMany queues the given paths to be pinned in the background.
+func pinQueueMany(ctx context.Context, api coreiface.CoreAPI, queue *pinqueue.Queue, enc cidenc.Encoder, paths []string, recursive bool, meta pinmeta.Meta) ([]string, error) {
+	queued := make([]string, len(paths))
+	for i, b := range paths {
+		rp, err := api.ResolvePath(ctx, path.New(b))
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := queue.Add(rp.Cid(), recursive, meta); err != nil {
+			return nil, err
+		}
+		queued[i] = enc.Encode(rp.Cid())
+	}
+
+	return queued, nil
+}
+
+// pinMetaOptions returns the pin metadata set with the --name and --label
+// options.
+func pinMetaOptions(req *cmds.Request) (pinmeta.Meta, error) {
+	name, _ := req.Options[pinNameOptionName].(string)
+
+	var labelStrs []string
+	switch v := req.Options[pinLabelOptionName].(type) {
+	case []string:
+		labelStrs = v
+	case string:
+		// joined by joinLabelOptions
+		labelStrs = splitOptionList(v)
+	}
+
+	labels, err := pinmeta.ParseLabels(labelStrs)
+	if err != nil {
+		return pinmeta.Meta{}, err
+	}
+	return pinmeta.Meta{Name: name, Labels: labels}, nil
+}
+
+// joinLabelOptions joins the repeated --label options into a single
+// comma-separated value, as the HTTP API only forwards the first value of
+// repeated options to the daemon.
+func joinLabelOptions(req *cmds.Request, env cmds.Environment) error {
+	if labels, ok := req.Options[pinLabelOptionName].([]string); ok {
+		req.Options[pinLabelOptionName] = joinOptionList(labels)
+	}
+	return nil
+}
+
+// joinOptionList joins option values with commas, escaping the commas and
+// backslashes of the values with backslashes.
+func joinOptionList(values []string) string {
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		v = strings.ReplaceAll(v, `\`, `\\`)
+		escaped[i] = strings.ReplaceAll(v, ",", `\,`)
+	}
+	return strings.Join(escaped, ",")
+}
+
+// splitOptionList splits a comma-separated option value. Commas and
+// backslashes escaped with a backslash are part of the values.
+func splitOptionList(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	var (
+		values []string
+		cur    strings.Builder
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			cur.WriteByte(s[i])
+		case s[i] == ',':
+			values = append(values, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	return append(values, cur.String())
+}
+
 var rmPinCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Remove pinned objects from local storage.",
@@ -214,6 +351,11 @@ collected if needed. (By default, recursively. Use -r=false for direct pins.)
 	},
 	Type: PinOutput{},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
@@ -243,6 +385,9 @@ collected if needed. (By default, recursively. Use -r=false for direct pins.)
 			if err := api.Pin().Rm(req.Context, rp, options.Pin.RmRecursive(recursive)); err != nil {
 				return err
 			}
+			if err := n.PinMeta.Delete(rp.Cid()); err != nil {
+				return err
+			}
 		}
 
 		return cmds.EmitOnce(res, &PinOutput{pins})
@@ -291,6 +436,9 @@ With arguments, the command fails if any of the arguments is not a pinned
 object. And if --type=<type> is additionally used, the command will also fail
 if any of the arguments is not of the specified type.
 
+Use --name=<name> and --label=<key>=<value> to only list the direct and
+recursive pins with the given name and labels, as set by 'ipfs pin add'.
+
 Example:
 	$ echo "hello" | ipfs add -q
 	QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN
@@ -315,8 +463,16 @@ Example:
 		cmds.StringOption(pinTypeOptionName, "t", "The type of pinned keys to list. Can be \"direct\", \"indirect\", \"recursive\", or \"all\".").WithDefault("all"),
 		cmds.BoolOption(pinQuietOptionName, "q", "Write just hashes of objects."),
 		cmds.BoolOption(pinStreamOptionName, "s", "Enable streaming of pins as they are discovered."),
+		cmds.StringOption(pinNameOptionName, "Only list the pins with this name."),
+		cmds.StringsOption(pinLabelOptionName, "Only list the pins with this key=value label. Can be repeated."),
 	},
+	PreRun: joinLabelOptions,
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
@@ -325,6 +481,11 @@ Example:
 		typeStr, _ := req.Options[pinTypeOptionName].(string)
 		stream, _ := req.Options[pinStreamOptionName].(bool)
 
+		filter, err := pinMetaOptions(req)
+		if err != nil {
+			return err
+		}
+
 		switch typeStr {
 		case "all", "direct", "indirect", "recursive":
 		default:
@@ -338,15 +499,22 @@ Example:
 		if !stream {
 			emit = func(v interface{}) error {
 				obj := v.(*PinLsOutputWrapper)
-				lgcList[obj.PinLsObject.Cid] = PinLsType{Type: obj.PinLsObject.Type}
+				lgcList[obj.PinLsObject.Cid] = PinLsType{
+					Type:   obj.PinLsObject.Type,
+					Name:   obj.PinLsObject.Name,
+					Labels: obj.PinLsObject.Labels,
+				}
 				return nil
 			}
 		}
 
-		if len(req.Arguments) > 0 {
-			err = pinLsKeys(req, typeStr, api, emit)
-		} else {
-			err = pinLsAll(req, typeStr, api, emit)
+		switch {
+		case len(req.Arguments) > 0:
+			err = pinLsKeys(req, typeStr, api, n.PinMeta, filter, emit)
+		case !filter.IsEmpty():
+			err = pinLsMeta(req, typeStr, api, n.PinMeta, filter, emit)
+		default:
+			err = pinLsAll(req, typeStr, api, n.PinMeta, emit)
 		}
 		if err != nil {
 			return err
@@ -380,6 +548,8 @@ Example:
 			if stream {
 				if quiet {
 					fmt.Fprintf(w, "%s\n", out.PinLsObject.Cid)
+				} else if out.PinLsObject.Name != "" {
+					fmt.Fprintf(w, "%s %s %s\n", out.PinLsObject.Cid, out.PinLsObject.Type, out.PinLsObject.Name)
 				} else {
 					fmt.Fprintf(w, "%s %s\n", out.PinLsObject.Cid, out.PinLsObject.Type)
 				}
@@ -389,6 +559,8 @@ Example:
 			for k, v := range out.PinLsList.Keys {
 				if quiet {
 					fmt.Fprintf(w, "%s\n", k)
+				} else if v.Name != "" {
+					fmt.Fprintf(w, "%s %s %s\n", k, v.Type, v.Name)
 				} else {
 					fmt.Fprintf(w, "%s %s\n", k, v.Type)
 				}
@@ -412,18 +584,33 @@ type PinLsList struct {
 	Keys map[string]PinLsType
 }
 
-// PinLsType contains the type of a pin
+// PinLsType contains the type of a pin, and its name and labels if any
 type PinLsType struct {
-	Type string
+	Type   string
+	Name   string            `json:",omitempty"`
+	Labels map[string]string `json:",omitempty"`
 }
 
 // PinLsObject contains the description of a pin
 type PinLsObject struct {
-	Cid  string `json:",omitempty"`
-	Type string `json:",omitempty"`
+	Cid    string            `json:",omitempty"`
+	Type   string            `json:",omitempty"`
+	Name   string            `json:",omitempty"`
+	Labels map[string]string `json:",omitempty"`
 }
 
-func pinLsKeys(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit func(value interface{}) error) error {
+// pinMeta returns the metadata of a pin, which only direct and recursive
+// pins can have.
+func pinMeta(store *pinmeta.Store, c cid.Cid, pinType string) (pinmeta.Meta, error) {
+	switch pinType {
+	case "direct", "recursive":
+		return store.Get(c)
+	default:
+		return pinmeta.Meta{}, nil
+	}
+}
+
+func pinLsKeys(req *cmds.Request, typeStr string, api coreiface.CoreAPI, store *pinmeta.Store, filter pinmeta.Meta, emit func(value interface{}) error) error {
 	enc, err := cmdenv.GetCidEncoder(req)
 	if err != nil {
 		return err
@@ -461,10 +648,20 @@ func pinLsKeys(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit fu
 			pinType = "indirect through " + pinType
 		}
 
+		meta, err := pinMeta(store, rp.Cid(), pinType)
+		if err != nil {
+			return err
+		}
+		if !filter.IsEmpty() && (meta.IsEmpty() || !meta.Matches(filter.Name, filter.Labels)) {
+			continue
+		}
+
 		err = emit(&PinLsOutputWrapper{
 			PinLsObject: PinLsObject{
-				Type: pinType,
-				Cid:  enc.Encode(rp.Cid()),
+				Type:   pinType,
+				Cid:    enc.Encode(rp.Cid()),
+				Name:   meta.Name,
+				Labels: meta.Labels,
 			},
 		})
 		if err != nil {
@@ -475,7 +672,7 @@ func pinLsKeys(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit fu
 	return nil
 }
 
-func pinLsAll(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit func(value interface{}) error) error {
+func pinLsAll(req *cmds.Request, typeStr string, api coreiface.CoreAPI, store *pinmeta.Store, emit func(value interface{}) error) error {
 	enc, err := cmdenv.GetCidEncoder(req)
 	if err != nil {
 		return err
@@ -499,10 +696,74 @@ func pinLsAll(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit fun
 	}
 
 	for p := range pins {
+		meta, err := pinMeta(store, p.Path().Cid(), p.Type())
+		if err != nil {
+			return err
+		}
+
+		err = emit(&PinLsOutputWrapper{
+			PinLsObject: PinLsObject{
+				Type:   p.Type(),
+				Cid:    enc.Encode(p.Path().Cid()),
+				Name:   meta.Name,
+				Labels: meta.Labels,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pinLsMeta lists the pins whose name and labels match the given filter.
+func pinLsMeta(req *cmds.Request, typeStr string, api coreiface.CoreAPI, store *pinmeta.Store, filter pinmeta.Meta, emit func(value interface{}) error) error {
+	enc, err := cmdenv.GetCidEncoder(req)
+	if err != nil {
+		return err
+	}
+
+	switch typeStr {
+	case "all", "direct", "recursive":
+	case "indirect":
+		// indirect pins have no metadata
+		return nil
+	default:
+		return fmt.Errorf("invalid type '%s', must be one of {direct, indirect, recursive, all}", typeStr)
+	}
+
+	opt, err := options.Pin.IsPinned.Type(typeStr)
+	if err != nil {
+		panic("unhandled pin type")
+	}
+
+	cids, err := store.Find(filter.Name, filter.Labels)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cids {
+		pinType, pinned, err := api.Pin().IsPinned(req.Context, path.IpfsPath(c), opt)
+		if err != nil {
+			return err
+		}
+		// metadata may outlive pins removed without 'ipfs pin rm'
+		if !pinned || (pinType != "direct" && pinType != "recursive") {
+			continue
+		}
+
+		meta, err := store.Get(c)
+		if err != nil {
+			return err
+		}
+
 		err = emit(&PinLsOutputWrapper{
 			PinLsObject: PinLsObject{
-				Type: p.Type(),
-				Cid:  enc.Encode(p.Path().Cid()),
+				Type:   pinType,
+				Cid:    enc.Encode(c),
+				Name:   meta.Name,
+				Labels: meta.Labels,
 			},
 		})
 		if err != nil {
@@ -522,7 +783,8 @@ var updatePinCmd = &cmds.Command{
 		Tagline: "Update a recursive pin",
 		ShortDescription: `
 Efficiently pins a new object based on differences from an existing one and,
-by default, removes the old pin.
+by default, removes the old pin. The name and labels of the old pin are
+carried over to the new one.
 
 This command is useful when the new pin contains many similarities or is a
 derivative of an existing one, particularly for large objects. This allows a more
@@ -541,6 +803,11 @@ pin.
 	},
 	Type: PinOutput{},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
@@ -568,6 +835,10 @@ pin.
 			return err
 		}
 
+		if err := n.PinMeta.Update(from.Cid(), to.Cid(), unpin); err != nil {
+			return err
+		}
+
 		return cmds.EmitOnce(res, &PinOutput{Pins: []string{enc.Encode(from.Cid()), enc.Encode(to.Cid())}})
 	},
 	Encoders: cmds.EncoderMap{
@@ -578,6 +849,87 @@ pin.
 	},
 }
 
+const (
+	pinClearOptionName = "clear"
+)
+
+// PinQueueStatus describes a pin being processed in the background
+type PinQueueStatus struct {
+	Cid       string
+	Recursive bool
+	Status    string
+	Progress  int    `json:",omitempty"`
+	Name      string `json:",omitempty"`
+	Error     string `json:",omitempty"`
+}
+
+var statusPinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the pins being processed in the background.",
+		ShortDescription: `
+Lists the pins added with 'ipfs pin add --background' that are not done yet,
+with the number of nodes fetched so far. Pins are removed from the list once
+done, unless they failed. Use --clear to forget about the failed pins.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(pinClearOptionName, "Remove the failed pins from the list."),
+	},
+	Type: PinQueueStatus{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		clear, _ := req.Options[pinClearOptionName].(bool)
+
+		jobs, err := n.PinQueue.Jobs()
+		if err != nil {
+			return err
+		}
+		for _, j := range jobs {
+			if clear && j.Status == pinqueue.StatusFailed {
+				if err := n.PinQueue.Remove(j.ID); err != nil {
+					return err
+				}
+				continue
+			}
+
+			err := res.Emit(&PinQueueStatus{
+				Cid:       enc.Encode(j.Cid),
+				Recursive: j.Recursive,
+				Status:    string(j.Status),
+				Progress:  j.Progress,
+				Name:      j.Meta.Name,
+				Error:     j.Error,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PinQueueStatus) error {
+			fmt.Fprintf(w, "%s %s", out.Cid, out.Status)
+			if out.Progress > 0 {
+				fmt.Fprintf(w, " (%d nodes fetched)", out.Progress)
+			}
+			if out.Error != "" {
+				fmt.Fprintf(w, ": %s", out.Error)
+			}
+			fmt.Fprintln(w)
+			return nil
+		}),
+	},
+}
+
 const (
 	pinVerboseOptionName = "verbose"
 )
@@ -0,0 +1,505 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+	ma "github.com/multiformats/go-multiaddr"
+
+	core "github.com/ipfs/go-ipfs/core"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/pinsvc"
+	repo "github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+// RemoteServicesConfigKey is the config section holding the remote pinning
+// services.
+const RemoteServicesConfigKey = "Pinning.RemoteServices"
+
+const (
+	pinServiceOptionName    = "service"
+	pinBackgroundOptionName = "background"
+	pinCidOptionName        = "cid"
+	pinStatusOptionName     = "status"
+	pinForceOptionName      = "force"
+)
+
+// how often the status of a remote pin is checked while waiting for it
+var remotePinPollInterval = time.Second
+
+var remotePinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Pin (and unpin) objects to remote pinning services.",
+		ShortDescription: `
+Asks remote services implementing the IPFS Pinning Service API to pin objects.
+
+Services are added with 'ipfs pin remote service add', which stores their
+endpoint and access token in the config, under Pinning.RemoteServices. The
+access tokens aren't shown by 'ipfs config'.
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"add":     addRemotePinCmd,
+		"ls":      listRemotePinCmd,
+		"rm":      rmRemotePinCmd,
+		"service": remotePinServiceCmd,
+	},
+}
+
+// RemotePinOutput describes a pin request made to a remote service.
+type RemotePinOutput struct {
+	RequestID string
+	Status    string
+	Cid       string
+	Name      string
+}
+
+func toRemotePinOutput(st *pinsvc.PinStatus) *RemotePinOutput {
+	return &RemotePinOutput{
+		RequestID: st.RequestID,
+		Status:    string(st.Status),
+		Cid:       st.Pin.Cid,
+		Name:      st.Pin.Name,
+	}
+}
+
+func encodeRemotePinOutput(req *cmds.Request, w io.Writer, out *RemotePinOutput) error {
+	if out.Name == "" {
+		_, err := fmt.Fprintf(w, "%s\t%s\n", out.Cid, out.Status)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s\t%s\t%s\n", out.Cid, out.Status, out.Name)
+	return err
+}
+
+var addRemotePinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Pin an object to a remote pinning service.",
+		ShortDescription: `
+Asks the given remote service to pin an object, and waits until it is pinned,
+unless --background is passed. The addresses of this node are sent along, so
+the service can fetch the object from it.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", true, false, "Path to the object to be pinned."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(pinServiceOptionName, "Name of the remote pinning service to use."),
+		cmds.StringOption(pinNameOptionName, "A name for the pin."),
+		cmds.BoolOption(pinBackgroundOptionName, "Don't wait for the object to be pinned.").WithDefault(false),
+	},
+	Type: RemotePinOutput{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		c, err := remotePinServiceClient(req, env)
+		if err != nil {
+			return err
+		}
+
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+
+		rp, err := api.ResolvePath(req.Context, path.New(req.Arguments[0]))
+		if err != nil {
+			return err
+		}
+
+		name, _ := req.Options[pinNameOptionName].(string)
+		st, err := c.Add(req.Context, pinsvc.Pin{
+			Cid:     rp.Cid().String(),
+			Name:    name,
+			Origins: nodeOrigins(n),
+		})
+		if err != nil {
+			return err
+		}
+
+		if background, _ := req.Options[pinBackgroundOptionName].(bool); !background {
+			st, err = waitRemotePin(req.Context, c, st)
+			if err != nil {
+				return err
+			}
+			if st.Status == pinsvc.StatusFailed {
+				return fmt.Errorf("remote pinning of %s failed: %s", st.Pin.Cid, st.Info["error"])
+			}
+		}
+
+		return cmds.EmitOnce(res, toRemotePinOutput(st))
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(encodeRemotePinOutput),
+	},
+}
+
+var listRemotePinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List objects pinned to a remote pinning service.",
+		ShortDescription: `
+Lists the pin requests made to a remote service, by default the ones that are
+pinned. Use --status to see the requests in other states, e.g.
+--status=queued,pinning,failed.
+`,
+	},
+
+	Options: []cmds.Option{
+		cmds.StringOption(pinServiceOptionName, "Name of the remote pinning service to use."),
+		cmds.StringOption(pinCidOptionName, "Only list pins of the given comma-separated CIDs."),
+		cmds.StringOption(pinNameOptionName, "Only list pins with the given name."),
+		cmds.StringOption(pinStatusOptionName, "Only list pins with the given comma-separated statuses: queued, pinning, pinned or failed.").WithDefault(string(pinsvc.StatusPinned)),
+	},
+	Type: RemotePinOutput{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		c, err := remotePinServiceClient(req, env)
+		if err != nil {
+			return err
+		}
+
+		opts, err := remotePinListOptions(req)
+		if err != nil {
+			return err
+		}
+
+		return lsRemotePins(req.Context, c, opts, func(st *pinsvc.PinStatus) error {
+			return res.Emit(toRemotePinOutput(st))
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(encodeRemotePinOutput),
+	},
+}
+
+var rmRemotePinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove pins from a remote pinning service.",
+		ShortDescription: `
+Removes the pin requests matching the given filters from a remote service,
+which lets it unpin the objects. Removing more than one request requires
+--force.
+`,
+	},
+
+	Options: []cmds.Option{
+		cmds.StringOption(pinServiceOptionName, "Name of the remote pinning service to use."),
+		cmds.StringOption(pinCidOptionName, "Only remove pins of the given comma-separated CIDs."),
+		cmds.StringOption(pinNameOptionName, "Only remove pins with the given name."),
+		cmds.StringOption(pinStatusOptionName, "Only remove pins with the given comma-separated statuses: queued, pinning, pinned or failed.").WithDefault(string(pinsvc.StatusPinned)),
+		cmds.BoolOption(pinForceOptionName, "Remove all the matching pins.").WithDefault(false),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		c, err := remotePinServiceClient(req, env)
+		if err != nil {
+			return err
+		}
+
+		opts, err := remotePinListOptions(req)
+		if err != nil {
+			return err
+		}
+		if len(opts.Cids) == 0 && opts.Name == "" {
+			return fmt.Errorf("pins to remove must be selected with --%s or --%s", pinCidOptionName, pinNameOptionName)
+		}
+
+		var ids []string
+		err = lsRemotePins(req.Context, c, opts, func(st *pinsvc.PinStatus) error {
+			ids = append(ids, st.RequestID)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if force, _ := req.Options[pinForceOptionName].(bool); len(ids) > 1 && !force {
+			return fmt.Errorf("%d remote pins match, pass --%s to remove them all", len(ids), pinForceOptionName)
+		}
+		for _, id := range ids {
+			if err := c.Rm(req.Context, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// lsRemotePins calls emit for all the pins matching opts, following the
+// pages of results.
+func lsRemotePins(ctx context.Context, c *pinsvc.Client, opts pinsvc.ListOptions, emit func(*pinsvc.PinStatus) error) error {
+	opts.Limit = pinsvc.MaxLimit
+	for {
+		res, err := c.Ls(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		for i := range res.Results {
+			if err := emit(&res.Results[i]); err != nil {
+				return err
+			}
+		}
+
+		// results are sorted by creation date, newest first
+		if len(res.Results) == 0 || len(res.Results) >= res.Count {
+			return nil
+		}
+		opts.Before = res.Results[len(res.Results)-1].Created
+	}
+}
+
+func remotePinListOptions(req *cmds.Request) (pinsvc.ListOptions, error) {
+	var opts pinsvc.ListOptions
+	cids, _ := req.Options[pinCidOptionName].(string)
+	opts.Cids = splitOptionList(cids)
+	opts.Name, _ = req.Options[pinNameOptionName].(string)
+
+	statuses, _ := req.Options[pinStatusOptionName].(string)
+	for _, s := range splitOptionList(statuses) {
+		st, err := pinsvc.ParseStatus(s)
+		if err != nil {
+			return opts, err
+		}
+		opts.Status = append(opts.Status, st)
+	}
+	return opts, nil
+}
+
+// waitRemotePin polls a pin request until it's pinned or failed.
+func waitRemotePin(ctx context.Context, c *pinsvc.Client, st *pinsvc.PinStatus) (*pinsvc.PinStatus, error) {
+	ticker := time.NewTicker(remotePinPollInterval)
+	defer ticker.Stop()
+
+	for st.Status != pinsvc.StatusPinned && st.Status != pinsvc.StatusFailed {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		var err error
+		st, err = c.Get(ctx, st.RequestID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// nodeOrigins returns the addresses remote services can fetch objects from.
+func nodeOrigins(n *core.IpfsNode) []string {
+	if !n.IsOnline {
+		return nil
+	}
+
+	p2p, err := ma.NewComponent("p2p", n.Identity.Pretty())
+	if err != nil {
+		return nil
+	}
+
+	var origins []string
+	for _, a := range n.PeerHost.Addrs() {
+		origins = append(origins, a.Encapsulate(p2p).String())
+	}
+	return origins
+}
+
+// remotePinService is the config of a remote pinning service.
+type remotePinService struct {
+	API struct {
+		Endpoint string
+		Key      string
+	}
+}
+
+func loadRemotePinServices(env cmds.Environment) (map[string]remotePinService, error) {
+	cfgRoot, err := cmdenv.GetConfigRoot(env)
+	if err != nil {
+		return nil, err
+	}
+	r, err := fsrepo.Open(cfgRoot)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	services := make(map[string]remotePinService)
+	// the section is missing until a service is added
+	if err := repo.LoadConfigSection(r, RemoteServicesConfigKey, &services); err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+func remotePinServiceClient(req *cmds.Request, env cmds.Environment) (*pinsvc.Client, error) {
+	name, _ := req.Options[pinServiceOptionName].(string)
+	if name == "" {
+		return nil, fmt.Errorf("a remote pinning service must be given with --%s", pinServiceOptionName)
+	}
+
+	services, err := loadRemotePinServices(env)
+	if err != nil {
+		return nil, err
+	}
+	svc, ok := services[name]
+	if !ok {
+		return nil, fmt.Errorf("remote pinning service %q not found, see 'ipfs pin remote service add'", name)
+	}
+	return pinsvc.NewClient(svc.API.Endpoint, svc.API.Key), nil
+}
+
+var remotePinServiceCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Configure remote pinning services.",
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"add": addRemotePinServiceCmd,
+		"ls":  lsRemotePinServiceCmd,
+		"rm":  rmRemotePinServiceCmd,
+	},
+}
+
+var addRemotePinServiceCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Add a remote pinning service.",
+		ShortDescription: `
+Adds a remote service implementing the IPFS Pinning Service API, given its
+endpoint (e.g. https://pinning.example.com/api/v1, under which /pins is
+served) and the access token to use. They are stored in the config, under
+Pinning.RemoteServices.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("service", true, false, "Service name."),
+		cmds.StringArg("endpoint", true, false, "Service endpoint."),
+		cmds.StringArg("key", true, false, "Service access token."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		name, endpoint, key := req.Arguments[0], req.Arguments[1], req.Arguments[2]
+
+		if name == "" || strings.Contains(name, ".") {
+			return fmt.Errorf("invalid service name %q", name)
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid service endpoint %q, must be an http(s) URL", endpoint)
+		}
+
+		services, err := loadRemotePinServices(env)
+		if err != nil {
+			return err
+		}
+		if _, ok := services[name]; ok {
+			return fmt.Errorf("remote pinning service %q already exists", name)
+		}
+
+		cfgRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+		r, err := fsrepo.Open(cfgRoot)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		return r.SetConfigKey(RemoteServicesConfigKey+"."+name, map[string]interface{}{
+			"API": map[string]interface{}{
+				"Endpoint": endpoint,
+				"Key":      key,
+			},
+		})
+	},
+}
+
+// RemotePinServiceOutput describes a remote pinning service.
+type RemotePinServiceOutput struct {
+	Service  string
+	Endpoint string
+}
+
+var lsRemotePinServiceCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List remote pinning services.",
+	},
+
+	Type: RemotePinServiceOutput{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		services, err := loadRemotePinServices(env)
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(services))
+		for name := range services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			err := res.Emit(&RemotePinServiceOutput{
+				Service:  name,
+				Endpoint: services[name].API.Endpoint,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *RemotePinServiceOutput) error {
+			_, err := fmt.Fprintf(w, "%s\t%s\n", out.Service, out.Endpoint)
+			return err
+		}),
+	},
+}
+
+var rmRemotePinServiceCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove a remote pinning service.",
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("service", true, false, "Service name."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		name := req.Arguments[0]
+
+		services, err := loadRemotePinServices(env)
+		if err != nil {
+			return err
+		}
+		if _, ok := services[name]; !ok {
+			return fmt.Errorf("remote pinning service %q not found", name)
+		}
+		delete(services, name)
+
+		cfgRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+		r, err := fsrepo.Open(cfgRoot)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		return r.SetConfigKey(RemoteServicesConfigKey, services)
+	},
+}
@@ -12,8 +12,10 @@ import (
 	"text/tabwriter"
 
 	humanize "github.com/dustin/go-humanize"
+	"github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	"github.com/ipfs/go-ipfs/gc"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
 	cid "github.com/ipfs/go-cid"
@@ -34,11 +36,12 @@ var RepoCmd = &cmds.Command{
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"stat":    repoStatCmd,
-		"gc":      repoGcCmd,
-		"fsck":    repoFsckCmd,
-		"version": repoVersionCmd,
-		"verify":  repoVerifyCmd,
+		"stat":             repoStatCmd,
+		"gc":               repoGcCmd,
+		"fsck":             repoFsckCmd,
+		"version":          repoVersionCmd,
+		"verify":           repoVerifyCmd,
+		"encrypt-keystore": repoEncryptKeystoreCmd,
 	},
 }
 
@@ -46,11 +49,23 @@ var RepoCmd = &cmds.Command{
 type GcResult struct {
 	Key   cid.Cid
 	Error string `json:",omitempty"`
+
+	// Size of the block that would be removed, and total size of the blocks
+	// that would be removed, with --dry-run.
+	Size  uint64 `json:",omitempty"`
+	Freed uint64 `json:",omitempty"`
+
+	// KeptBy tells why Key is kept, with --explain. It is nil when the
+	// block would be removed.
+	KeptBy *gc.Reason `json:",omitempty"`
 }
 
 const (
 	repoStreamErrorsOptionName = "stream-errors"
 	repoQuietOptionName        = "quiet"
+	repoConcurrentOptionName   = "concurrent"
+	repoDryRunOptionName       = "dry-run"
+	repoExplainOptionName      = "explain"
 )
 
 var repoGcCmd = &cmds.Command{
@@ -60,11 +75,33 @@ var repoGcCmd = &cmds.Command{
 'ipfs repo gc' is a plumbing command that will sweep the local
 set of stored objects and remove ones that are not pinned in
 order to reclaim hard disk space.
+`,
+		LongDescription: `
+'ipfs repo gc' is a plumbing command that will sweep the local
+set of stored objects and remove ones that are not pinned in
+order to reclaim hard disk space.
+
+By default, adding and pinning content is blocked for the whole
+duration of the garbage collection. With --concurrent, the node
+keeps accepting writes while the repo is being collected: blocks
+written or read during the collection are kept, and writes are
+only blocked briefly to account for pins added in the meantime.
+
+With --dry-run, nothing is removed: the blocks that would be
+removed are listed along with the total space that would be
+freed.
+
+With --explain <cid>, nothing is removed either: the command
+tells whether the given block would be kept and, if so, which
+pin or MFS root keeps it, and through which path.
 `,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(repoStreamErrorsOptionName, "Stream errors."),
 		cmds.BoolOption(repoQuietOptionName, "q", "Write minimal output."),
+		cmds.BoolOption(repoConcurrentOptionName, "Do not block writes to the repo while collecting."),
+		cmds.BoolOption(repoDryRunOptionName, "Only list the blocks that would be removed."),
+		cmds.StringOption(repoExplainOptionName, "Tell why the given block would be kept or removed."),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -73,8 +110,35 @@ order to reclaim hard disk space.
 		}
 
 		streamErrors, _ := req.Options[repoStreamErrorsOptionName].(bool)
+		concurrent, _ := req.Options[repoConcurrentOptionName].(bool)
+		dryRun, _ := req.Options[repoDryRunOptionName].(bool)
+
+		if explain, ok := req.Options[repoExplainOptionName].(string); ok {
+			c, err := cid.Decode(explain)
+			if err != nil {
+				return err
+			}
+			roots, err := corerepo.BestEffortRoots(n.FilesRoot)
+			if err != nil {
+				return err
+			}
+			reason, err := gc.Explain(req.Context, n.Blockstore, n.Pinning, roots, c)
+			if err != nil {
+				return err
+			}
+			return re.Emit(&GcResult{Key: c, KeptBy: reason})
+		}
+
+		if dryRun {
+			return gcDryRun(req, re, n, streamErrors)
+		}
 
-		gcOutChan := corerepo.GarbageCollectAsync(n, req.Context)
+		var gcOutChan <-chan gc.Result
+		if concurrent {
+			gcOutChan = corerepo.ConcurrentGarbageCollectAsync(n, req.Context)
+		} else {
+			gcOutChan = corerepo.GarbageCollectAsync(n, req.Context)
+		}
 
 		if streamErrors {
 			errs := false
@@ -111,13 +175,30 @@ order to reclaim hard disk space.
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, gcr *GcResult) error {
 			quiet, _ := req.Options[repoQuietOptionName].(bool)
+			dryRun, _ := req.Options[repoDryRunOptionName].(bool)
+			_, explain := req.Options[repoExplainOptionName].(string)
 
 			if gcr.Error != "" {
 				_, err := fmt.Fprintf(w, "Error: %s\n", gcr.Error)
 				return err
 			}
 
+			if explain {
+				return writeGcExplanation(w, gcr)
+			}
+
+			if dryRun && !gcr.Key.Defined() {
+				if quiet {
+					return nil
+				}
+				_, err := fmt.Fprintf(w, "would free %s (%d bytes)\n", humanize.Bytes(gcr.Freed), gcr.Freed)
+				return err
+			}
+
 			prefix := "removed "
+			if dryRun {
+				prefix = "would remove "
+			}
 			if quiet {
 				prefix = ""
 			}
@@ -133,6 +214,75 @@ const (
 	repoHumanOptionName    = "human"
 )
 
+// gcDryRun emits the blocks a garbage collection would remove, followed by
+// the total size they use.
+func gcDryRun(req *cmds.Request, re cmds.ResponseEmitter, n *core.IpfsNode, streamErrors bool) error {
+	roots, err := corerepo.BestEffortRoots(n.FilesRoot)
+	if err != nil {
+		return err
+	}
+
+	var freed uint64
+	errs := false
+	for res := range gc.DryRun(req.Context, n.Blockstore, n.Pinning, roots) {
+		if res.Error != nil {
+			if !streamErrors {
+				return res.Error
+			}
+			if err := re.Emit(&GcResult{Error: res.Error.Error()}); err != nil {
+				return err
+			}
+			errs = true
+			continue
+		}
+
+		size, err := n.Blockstore.GetSize(res.KeyRemoved)
+		if err != nil {
+			if err == bstore.ErrNotFound {
+				// removed in the meantime
+				continue
+			}
+			return err
+		}
+		freed += uint64(size)
+		if err := re.Emit(&GcResult{Key: res.KeyRemoved, Size: uint64(size)}); err != nil {
+			return err
+		}
+	}
+	if errs {
+		return errors.New("encountered errors during gc run")
+	}
+
+	return re.Emit(&GcResult{Freed: freed})
+}
+
+func writeGcExplanation(w io.Writer, gcr *GcResult) error {
+	if gcr.KeptBy == nil {
+		_, err := fmt.Fprintf(w, "%s is not pinned and would be removed\n", gcr.Key)
+		return err
+	}
+
+	what := fmt.Sprintf("%s pin", gcr.KeptBy.Kind)
+	if gcr.KeptBy.Kind == gc.BestEffortRoot {
+		what = "MFS root"
+	}
+	if len(gcr.KeptBy.Path) == 0 {
+		_, err := fmt.Fprintf(w, "%s is kept by %s %s\n", gcr.Key, what, gcr.KeptBy.Root)
+		return err
+	}
+
+	path := gcr.KeptBy.Root.String()
+	for _, step := range gcr.KeptBy.Path {
+		if step.Name != "" {
+			path += "/" + step.Name
+		} else {
+			path += "/" + step.Cid.String()
+		}
+	}
+	_, err := fmt.Fprintf(w, "%s is kept by %s %s through %s\n", gcr.Key, what, gcr.KeptBy.Root, path)
+	return err
+}
+
 var repoStatCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Get stats for the currently used repo.",
@@ -229,6 +379,48 @@ var repoFsckCmd = &cmds.Command{
 	},
 }
 
+var repoEncryptKeystoreCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Encrypt the keystore in place.",
+		ShortDescription: `
+'ipfs repo encrypt-keystore' encrypts every key of a plaintext keystore with a
+passphrase and switches the repo to the encrypted keystore ('Keystore.Type'
+set to 'encrypted').
+
+The passphrase is read from the IPFS_KEYSTORE_PASSPHRASE environment variable,
+or prompted for when running in a terminal. The same passphrase must then be
+provided every time the keystore is used.
+
+The daemon must not be running. It is safe to run this command again if it
+was interrupted.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		cfgRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+
+		pass, err := fsrepo.KeystorePassphrase()
+		if err != nil {
+			return err
+		}
+
+		if err := fsrepo.EncryptKeystore(cfgRoot, pass); err != nil {
+			return err
+		}
+
+		return cmds.EmitOnce(res, &MessageOutput{"keystore encrypted\n"})
+	},
+	Type: MessageOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *MessageOutput) error {
+			fmt.Fprint(w, out.Message)
+			return nil
+		}),
+	},
+}
+
 type VerifyProgress struct {
 	Msg      string
 	Progress int
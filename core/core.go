@@ -43,10 +43,14 @@ import (
 	"github.com/ipfs/go-ipfs/core/bootstrap"
 	"github.com/ipfs/go-ipfs/core/node"
 	"github.com/ipfs/go-ipfs/core/node/libp2p"
+	"github.com/ipfs/go-ipfs/denylist"
 	"github.com/ipfs/go-ipfs/fuse/mount"
+	"github.com/ipfs/go-ipfs/gc"
 	"github.com/ipfs/go-ipfs/namesys"
 	ipnsrp "github.com/ipfs/go-ipfs/namesys/republisher"
 	"github.com/ipfs/go-ipfs/p2p"
+	"github.com/ipfs/go-ipfs/pinmeta"
+	"github.com/ipfs/go-ipfs/pinqueue"
 	"github.com/ipfs/go-ipfs/repo"
 )
 
@@ -62,6 +66,9 @@ type IpfsNode struct {
 
 	// Local node
 	Pinning         pin.Pinner             // the pinning manager
+	PinMeta         *pinmeta.Store         // names and labels of pins
+	PinQueue        *pinqueue.Queue        // pins processed in the background
+	Denylist        *denylist.Denylist     // content the node refuses to serve
 	Mounts          Mounts                 `optional:"true"` // current mount state, if any.
 	PrivateKey      ic.PrivKey             `optional:"true"` // the local node's private Key
 	PNetFingerprint libp2p.PNetFingerprint `optional:"true"` // fingerprint of private network
@@ -72,6 +79,8 @@ type IpfsNode struct {
 	Filestore       *filestore.Filestore      `optional:"true"` // the filestore blockstore
 	BaseBlocks      node.BaseBlocks           // the raw blockstore, no filestore wrapping
 	GCLocker        bstore.GCLocker           // the locker used to protect the blockstore during gc
+	GCBarrier       *gc.WriteBarrier          // records blockstore accesses during concurrent gc
+	BlockAccess     *gc.AccessTracker         // records when blocks were last used, for LRU eviction
 	Blocks          bserv.BlockService        // the block service, get/add blocks.
 	DAG             ipld.DAGService           // the merkle dag service, get/add objects.
 	Resolver        *resolver.Resolver        // the path resolution system
@@ -86,6 +95,7 @@ type IpfsNode struct {
 	Routing       routing.Routing         `optional:"true"` // the routing system. recommend ipfs-dht
 	Exchange      exchange.Interface      // the block exchange + strategy (bitswap)
 	Namesys       namesys.NameSystem      // the name system, resolves paths to hashes
+	DNSResolver   *namesys.DNSResolver    // the resolver of DNSLink names
 	Provider      provider.System         // the value provider system
 	IpnsRepub     *ipnsrp.Republisher     `optional:"true"`
 	GraphExchange graphsync.GraphExchange `optional:"true"`
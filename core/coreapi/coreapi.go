@@ -65,8 +65,9 @@ type CoreAPI struct {
 	recordValidator record.Validator
 	exchange        exchange.Interface
 
-	namesys namesys.NameSystem
-	routing routing.Routing
+	namesys     namesys.NameSystem
+	dnsResolver *namesys.DNSResolver
+	routing     routing.Routing
 
 	provider provider.System
 
@@ -174,6 +175,7 @@ func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, e
 		peerstore:       n.Peerstore,
 		peerHost:        n.PeerHost,
 		namesys:         n.Namesys,
+		dnsResolver:     n.DNSResolver,
 		recordValidator: n.RecordValidator,
 		exchange:        n.Exchange,
 		routing:         n.Routing,
@@ -215,7 +217,7 @@ func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, e
 		}
 
 		subApi.routing = offlineroute.NewOfflineRouter(subApi.repo.Datastore(), subApi.recordValidator)
-		subApi.namesys = namesys.NewNameSystem(subApi.routing, subApi.repo.Datastore(), cs)
+		subApi.namesys = namesys.NewNameSystem(subApi.routing, subApi.repo.Datastore(), cs, subApi.nameSystemOptions()...)
 		subApi.provider = provider.NewOfflineProvider()
 
 		subApi.peerstore = nil
@@ -232,6 +234,15 @@ func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, e
 	return subApi, nil
 }
 
+// nameSystemOptions returns the options of the name systems the api
+// constructs, resolving DNSLink names like the node.
+func (api *CoreAPI) nameSystemOptions() []namesys.Option {
+	if api.dnsResolver == nil {
+		return nil
+	}
+	return []namesys.Option{namesys.WithDNSResolver(api.dnsResolver)}
+}
+
 // getSession returns new api backed by the same node with a read-only session DAG
 func (api *CoreAPI) getSession(ctx context.Context) *CoreAPI {
 	sesApi := *api
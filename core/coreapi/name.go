@@ -2,7 +2,6 @@ package coreapi
 
 import (
 	"context"
-	"fmt"
 	"strings"
 	"time"
 
@@ -13,7 +12,6 @@ import (
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	caopts "github.com/ipfs/interface-go-ipfs-core/options"
 	path "github.com/ipfs/interface-go-ipfs-core/path"
-	ci "github.com/libp2p/go-libp2p-core/crypto"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 )
 
@@ -55,7 +53,7 @@ func (api *NameAPI) Publish(ctx context.Context, p path.Path, opts ...caopts.Nam
 		return nil, err
 	}
 
-	k, err := keylookup(api.privateKey, api.repo.Keystore(), options.Key)
+	k, err := keystore.Lookup(api.privateKey, api.repo.Keystore(), options.Key)
 	if err != nil {
 		return nil, err
 	}
@@ -95,7 +93,7 @@ func (api *NameAPI) Search(ctx context.Context, name string, opts ...caopts.Name
 	var resolver namesys.Resolver = api.namesys
 
 	if !options.Cache {
-		resolver = namesys.NewNameSystem(api.routing, api.repo.Datastore(), 0)
+		resolver = namesys.NewNameSystem(api.routing, api.repo.Datastore(), 0, (*CoreAPI)(api).nameSystemOptions()...)
 	}
 
 	if !strings.HasPrefix(name, "/ipns/") {
@@ -137,65 +135,3 @@ func (api *NameAPI) Resolve(ctx context.Context, name string, opts ...caopts.Nam
 
 	return p, err
 }
-
-func keylookup(self ci.PrivKey, kstore keystore.Keystore, k string) (ci.PrivKey, error) {
-	////////////////////
-	// Lookup by name //
-	////////////////////
-
-	// First, lookup self.
-	if k == "self" {
-		return self, nil
-	}
-
-	// Then, look in the keystore.
-	res, err := kstore.Get(k)
-	if res != nil {
-		return res, nil
-	}
-
-	if err != nil && err != keystore.ErrNoSuchKey {
-		return nil, err
-	}
-
-	keys, err := kstore.List()
-	if err != nil {
-		return nil, err
-	}
-
-	//////////////////
-	// Lookup by ID //
-	//////////////////
-	targetPid, err := peer.Decode(k)
-	if err != nil {
-		return nil, keystore.ErrNoSuchKey
-	}
-
-	// First, check self.
-	pid, err := peer.IDFromPrivateKey(self)
-	if err != nil {
-		return nil, fmt.Errorf("failed to determine peer ID for private key: %w", err)
-	}
-	if pid == targetPid {
-		return self, nil
-	}
-
-	// Then, look in the keystore.
-	for _, key := range keys {
-		privKey, err := kstore.Get(key)
-		if err != nil {
-			return nil, err
-		}
-
-		pid, err := peer.IDFromPrivateKey(privKey)
-		if err != nil {
-			return nil, err
-		}
-
-		if targetPid == pid {
-			return privKey, nil
-		}
-	}
-
-	return nil, fmt.Errorf("no key by the given name or PeerID was found")
-}
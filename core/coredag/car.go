@@ -0,0 +1,17 @@
+package coredag
+
+import (
+	"context"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	mdag "github.com/ipfs/go-merkledag"
+	gocar "github.com/ipld/go-car"
+)
+
+// ExportCar writes the DAG under root to w as a CARv1 stream, with the blocks
+// in strict DAG-traversal, first-seen, order.
+func ExportCar(ctx context.Context, ng ipld.NodeGetter, root cid.Cid, w io.Writer) error {
+	return gocar.WriteCar(ctx, mdag.NewSession(ctx, ng), []cid.Cid{root}, w)
+}
@@ -57,7 +57,8 @@ func makeHandler(n *core.IpfsNode, l net.Listener, options ...ServeOption) (http
 }
 
 // ListenAndServe runs an HTTP server listening at |listeningMultiAddr| with
-// the given serve options. The address must be provided in multiaddr format.
+// the given serve options. The address must be provided in multiaddr format,
+// ending with /tls or /https for HTTPS, with the certificates of GatewayTLS.
 //
 // TODO intelligently parse address strings in other formats so long as they
 // unambiguously map to a valid multiaddr. e.g. for convenience, ":8080" should
@@ -68,16 +69,31 @@ func ListenAndServe(n *core.IpfsNode, listeningMultiAddr string, options ...Serv
 		return err
 	}
 
-	list, err := manet.Listen(addr)
+	listenAddr, isTLS := SplitTLS(addr)
+	var gwTLS *GatewayTLS
+	if isTLS {
+		if gwTLS, err = LoadGatewayTLS(n); err != nil {
+			return err
+		}
+	}
+
+	list, err := manet.Listen(listenAddr)
 	if err != nil {
 		return err
 	}
 
 	// we might have listened to /tcp/0 - let's see what we are listing on
-	addr = list.Multiaddr()
+	lis := manet.NetListener(list)
+	if isTLS {
+		_, suffix := ma.SplitLast(addr)
+		addr = list.Multiaddr().Encapsulate(suffix)
+		lis = gwTLS.NewListener(lis)
+	} else {
+		addr = list.Multiaddr()
+	}
 	fmt.Printf("API server listening on %s\n", addr)
 
-	return Serve(n, manet.NetListener(list), options...)
+	return Serve(n, lis, options...)
 }
 
 // Serve accepts incoming HTTP connections on the listener and pass them
@@ -9,6 +9,8 @@ import (
 	version "github.com/ipfs/go-ipfs"
 	core "github.com/ipfs/go-ipfs/core"
 	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/denylist"
+	"github.com/ipfs/go-ipfs/namesys"
 
 	options "github.com/ipfs/interface-go-ipfs-core/options"
 	id "github.com/libp2p/go-libp2p/p2p/protocol/identify"
@@ -18,6 +20,20 @@ type GatewayConfig struct {
 	Headers      map[string][]string
 	Writable     bool
 	PathPrefixes []string
+	// Denylist is the content the gateway refuses to serve, with a 410.
+	Denylist *denylist.Denylist
+	// Namesys resolves the /ipns/ paths with the TTLs of their records,
+	// which they are cached for. The API resolves them, without caching,
+	// if nil.
+	Namesys namesys.NameSystem
+	// Cache configures the cache of resolved paths and listings.
+	Cache GatewayCacheConfig
+	// MaxArchiveSize is the size of the largest directories served as
+	// archives. Archives are disabled if it's zero.
+	MaxArchiveSize int64
+	// WriteTokens are the tokens allowed to write through the writable
+	// gateway, by name. Writes aren't authenticated if there are none.
+	WriteTokens map[string]GatewayWriteToken
 }
 
 // A helper function to clean up a set of headers:
@@ -52,6 +68,21 @@ func GatewayOption(writable bool, paths ...string) ServeOption {
 			return nil, err
 		}
 
+		cacheCfg, err := LoadGatewayCacheConfig(n.Repo)
+		if err != nil {
+			return nil, err
+		}
+
+		writeTokens, err := LoadGatewayWriteTokensConfig(n.Repo)
+		if err != nil {
+			return nil, err
+		}
+
+		maxArchiveSize, err := LoadGatewayArchivesConfig(n.Repo)
+		if err != nil {
+			return nil, err
+		}
+
 		headers := make(map[string][]string, len(cfg.Gateway.HTTPHeaders))
 		for h, v := range cfg.Gateway.HTTPHeaders {
 			headers[http.CanonicalHeaderKey(h)] = v
@@ -91,6 +122,12 @@ func GatewayOption(writable bool, paths ...string) ServeOption {
 			Headers:      headers,
 			Writable:     writable,
 			PathPrefixes: cfg.Gateway.PathPrefixes,
+			Denylist:     n.Denylist,
+			Namesys:      n.Namesys,
+			Cache:        cacheCfg,
+			WriteTokens:  writeTokens,
+
+			MaxArchiveSize: maxArchiveSize,
 		}, api)
 
 		for _, p := range paths {
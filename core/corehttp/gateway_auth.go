@@ -0,0 +1,154 @@
+package corehttp
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// GatewayWriteTokensConfigKey is the config section listing the tokens
+// allowed to write through the writable gateway.
+const GatewayWriteTokensConfigKey = "GatewayWriteTokens"
+
+// GatewayWriteToken authorizes writes through the writable gateway.
+type GatewayWriteToken struct {
+	// Secret is the bearer token presented in the Authorization header.
+	Secret string
+	// Methods are the HTTP methods allowed, among POST, PUT and DELETE, or
+	// all of them if empty.
+	Methods []string
+	// PathPrefixes are the request paths allowed, like "/ipfs/", or all of
+	// them if empty.
+	PathPrefixes []string
+	// RateLimit is the number of requests allowed per minute, in bursts of
+	// up to as many requests, or unlimited if zero.
+	RateLimit int
+}
+
+// LoadGatewayWriteTokensConfig reads the GatewayWriteTokens section of the
+// config of the given repo, mapping the names of the tokens to their
+// settings. Writes aren't authenticated if the section is missing.
+func LoadGatewayWriteTokensConfig(r repo.Repo) (map[string]GatewayWriteToken, error) {
+	var tokens map[string]GatewayWriteToken
+
+	if err := repo.LoadConfigSection(r, GatewayWriteTokensConfigKey, &tokens); err != nil {
+		return nil, err
+	}
+	for name, t := range tokens {
+		if err := t.validate(); err != nil {
+			return nil, fmt.Errorf("invalid %s config: token %q: %s", GatewayWriteTokensConfigKey, name, err)
+		}
+	}
+	return tokens, nil
+}
+
+func (t GatewayWriteToken) validate() error {
+	if t.Secret == "" {
+		return errors.New("missing secret")
+	}
+	for _, m := range t.Methods {
+		switch strings.ToUpper(m) {
+		case http.MethodPost, http.MethodPut, http.MethodDelete:
+		default:
+			return fmt.Errorf("unsupported method %q", m)
+		}
+	}
+	if t.RateLimit < 0 {
+		return fmt.Errorf("negative rate limit %d", t.RateLimit)
+	}
+	return nil
+}
+
+// writeToken is a token of the gateway, with its rate limiter.
+type writeToken struct {
+	name string
+	GatewayWriteToken
+	limiter *rateLimiter
+}
+
+func newWriteTokens(tokens map[string]GatewayWriteToken) []*writeToken {
+	var ts []*writeToken
+	for name, t := range tokens {
+		wt := &writeToken{name: name, GatewayWriteToken: t}
+		if t.RateLimit > 0 {
+			wt.limiter = newRateLimiter(float64(t.RateLimit)/60, t.RateLimit)
+		}
+		ts = append(ts, wt)
+	}
+	return ts
+}
+
+// allows returns whether the token can be used for the method on the path.
+func (t *writeToken) allows(method, urlPath string) bool {
+	methodOk := len(t.Methods) == 0
+	for _, m := range t.Methods {
+		if strings.EqualFold(m, method) {
+			methodOk = true
+		}
+	}
+	if !methodOk {
+		return false
+	}
+
+	if len(t.PathPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range t.PathPrefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTokenOf returns the token of the request, if valid.
+func (i *gatewayHandler) writeTokenOf(r *http.Request) *writeToken {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil
+	}
+	secret := []byte(strings.TrimPrefix(auth, "Bearer "))
+
+	var token *writeToken
+	for _, t := range i.writeTokens {
+		if subtle.ConstantTimeCompare(secret, []byte(t.Secret)) == 1 {
+			token = t
+		}
+	}
+	return token
+}
+
+// authorizeWrite checks that the write request presents a token allowing it,
+// when tokens are configured, and responds with an error otherwise.
+func (i *gatewayHandler) authorizeWrite(w http.ResponseWriter, r *http.Request) bool {
+	if len(i.writeTokens) == 0 {
+		return true
+	}
+
+	t := i.writeTokenOf(r)
+	if t == nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "WritableGateway: a valid write token is required", http.StatusUnauthorized)
+		return false
+	}
+	if !t.allows(r.Method, r.URL.Path) {
+		http.Error(w, fmt.Sprintf("WritableGateway: token %q can't %s %s", t.name, r.Method, r.URL.Path), http.StatusForbidden)
+		return false
+	}
+	if t.limiter != nil {
+		if ok, wait := t.limiter.allow(time.Now()); !ok {
+			w.Header().Set("Retry-After", retryAfter(wait))
+			http.Error(w, fmt.Sprintf("WritableGateway: rate limit of token %q exceeded", t.name), http.StatusTooManyRequests)
+			return false
+		}
+	}
+
+	log.Debugf("%s %s with token %q", r.Method, r.URL.Path, t.name)
+	return true
+}
@@ -0,0 +1,98 @@
+package corehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+func TestGatewayWriteTokens(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+	ts.Close()
+
+	dir, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"a.txt": files.NewBytesFile([]byte("a")),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"b.txt": files.NewBytesFile([]byte("b")),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticated := httptest.NewServer(newGatewayHandler(GatewayConfig{
+		Writable: true,
+		WriteTokens: map[string]GatewayWriteToken{
+			"poster": {Secret: "post-secret", Methods: []string{"post"}, RateLimit: 2},
+			"ci":     {Secret: "ci-secret", Methods: []string{http.MethodPut}, PathPrefixes: []string{dir.String() + "/uploads/"}},
+		},
+	}, api))
+	defer authenticated.Close()
+
+	for i, test := range []struct {
+		method, path, secret string
+		status               int
+	}{
+		{http.MethodPost, "/ipfs/", "", http.StatusUnauthorized},
+		{http.MethodPost, "/ipfs/", "wrong-secret", http.StatusUnauthorized},
+		{http.MethodPost, "/ipfs/", "ci-secret", http.StatusForbidden},
+		{http.MethodPost, "/ipfs/", "post-secret", http.StatusCreated},
+		{http.MethodPost, "/ipfs/", "post-secret", http.StatusCreated},
+		{http.MethodPost, "/ipfs/", "post-secret", http.StatusTooManyRequests},
+		{http.MethodPut, dir.String() + "/uploads/file.txt", "post-secret", http.StatusForbidden},
+		{http.MethodPut, dir.String() + "/uploads/file.txt", "ci-secret", http.StatusCreated},
+		{http.MethodPut, dir.String() + "/a.txt", "ci-secret", http.StatusForbidden},
+		{http.MethodPut, other.String() + "/uploads/file.txt", "ci-secret", http.StatusForbidden},
+		{http.MethodDelete, dir.String() + "/uploads/a.txt", "ci-secret", http.StatusForbidden},
+		// reads don't need tokens
+		{http.MethodGet, dir.String() + "/a.txt", "", http.StatusOK},
+	} {
+		header := http.Header{}
+		if test.secret != "" {
+			header.Set("Authorization", "Bearer "+test.secret)
+		}
+		res, _ := doRequest(t, test.method, authenticated.URL+test.path, strings.NewReader("content"), header)
+		if res.StatusCode != test.status {
+			t.Fatalf("(%d) %s %s: expected %d, got %d", i, test.method, test.path, test.status, res.StatusCode)
+		}
+		switch res.StatusCode {
+		case http.StatusUnauthorized:
+			if res.Header.Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("(%d) expected a WWW-Authenticate header", i)
+			}
+		case http.StatusTooManyRequests:
+			if res.Header.Get("Retry-After") != "30" {
+				t.Errorf("(%d) expected to retry after 30s, got %q", i, res.Header.Get("Retry-After"))
+			}
+		}
+	}
+
+	// writes aren't authenticated without tokens
+	open := httptest.NewServer(newGatewayHandler(GatewayConfig{Writable: true}, api))
+	defer open.Close()
+	if res, _ := doRequest(t, http.MethodPost, open.URL+"/ipfs/", strings.NewReader("content"), nil); res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected the write to succeed, got %d", res.StatusCode)
+	}
+}
+
+func TestGatewayWriteTokenValidation(t *testing.T) {
+	for _, token := range []GatewayWriteToken{
+		{},
+		{Secret: "secret", Methods: []string{http.MethodGet}},
+		{Secret: "secret", RateLimit: -1},
+	} {
+		if token.validate() == nil {
+			t.Errorf("%+v should be invalid", token)
+		}
+	}
+	if err := (GatewayWriteToken{Secret: "secret", Methods: []string{"put"}}).validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,136 @@
+package corehttp
+
+import (
+	"time"
+
+	"github.com/ipfs/go-ipfs/repo"
+
+	lru "github.com/hashicorp/golang-lru"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// GatewayCacheConfigKey is the config section configuring the cache of the
+// gateway.
+const GatewayCacheConfigKey = "GatewayCache"
+
+const (
+	// DefaultGatewayResolveCacheSize is the number of resolved /ipns/ paths
+	// cached by default.
+	DefaultGatewayResolveCacheSize = 1024
+	// DefaultGatewayListingCacheSize is the number of rendered directory
+	// listings cached by default.
+	DefaultGatewayListingCacheSize = 128
+)
+
+// GatewayCacheConfig configures the in-memory cache of the gateway.
+type GatewayCacheConfig struct {
+	// ResolveSize is the number of resolved /ipns/ paths cached for the
+	// TTL of their records, DefaultGatewayResolveCacheSize if zero. A
+	// negative size disables the cache.
+	ResolveSize int
+	// ListingSize is the number of rendered HTML directory listings
+	// cached, DefaultGatewayListingCacheSize if zero. A negative size
+	// disables the cache.
+	ListingSize int
+}
+
+// LoadGatewayCacheConfig reads the GatewayCache section of the config of the
+// given repo. The defaults apply if the section is missing.
+func LoadGatewayCacheConfig(r repo.Repo) (GatewayCacheConfig, error) {
+	var cfg GatewayCacheConfig
+
+	if err := repo.LoadConfigSection(r, GatewayCacheConfigKey, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// gatewayCache caches the resolved /ipns/ paths, and the rendered directory
+// listings, which only depend on the CID of the directory and the request.
+// The caches are nil when disabled.
+type gatewayCache struct {
+	paths    *lru.Cache
+	listings *lru.Cache
+}
+
+func newGatewayCache(cfg GatewayCacheConfig) *gatewayCache {
+	return &gatewayCache{
+		paths:    newLRU(cfg.ResolveSize, DefaultGatewayResolveCacheSize),
+		listings: newLRU(cfg.ListingSize, DefaultGatewayListingCacheSize),
+	}
+}
+
+func newLRU(size, defaultSize int) *lru.Cache {
+	if size == 0 {
+		size = defaultSize
+	}
+	if size < 0 {
+		return nil
+	}
+	c, _ := lru.New(size)
+	return c
+}
+
+type resolvedPathEntry struct {
+	path ipath.Resolved
+	eol  time.Time
+}
+
+// getPath returns the cached resolution of the /ipns/ path, and for how long
+// it remains cached.
+func (c *gatewayCache) getPath(p string) (ipath.Resolved, time.Duration, bool) {
+	if c.paths == nil {
+		return nil, 0, false
+	}
+	v, ok := c.paths.Get(p)
+	if !ok {
+		return nil, 0, false
+	}
+	entry := v.(resolvedPathEntry)
+	if ttl := time.Until(entry.eol); ttl > 0 {
+		return entry.path, ttl, true
+	}
+	c.paths.Remove(p)
+	return nil, 0, false
+}
+
+// addPath caches the resolution of the /ipns/ path for the TTL, if any.
+func (c *gatewayCache) addPath(p string, resolved ipath.Resolved, ttl time.Duration) {
+	if c.paths == nil || ttl <= 0 {
+		return
+	}
+	c.paths.Add(p, resolvedPathEntry{resolved, time.Now().Add(ttl)})
+}
+
+// listingKey identifies a rendered directory listing.
+type listingKey struct {
+	cid             string
+	urlPath         string
+	originalUrlPath string
+	query           string
+}
+
+// renderedListing is an HTML directory listing, and the URL of its next page
+// if any.
+type renderedListing struct {
+	html []byte
+	next string
+}
+
+func (c *gatewayCache) getListing(key listingKey) (renderedListing, bool) {
+	if c.listings == nil {
+		return renderedListing{}, false
+	}
+	v, ok := c.listings.Get(key)
+	if !ok {
+		return renderedListing{}, false
+	}
+	return v.(renderedListing), true
+}
+
+func (c *gatewayCache) addListing(key listingKey, listing renderedListing) {
+	if c.listings == nil {
+		return
+	}
+	c.listings.Add(key, listing)
+}
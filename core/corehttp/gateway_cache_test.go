@@ -0,0 +1,185 @@
+package corehttp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-ipfs/namesys"
+
+	datastore "github.com/ipfs/go-datastore"
+	syncds "github.com/ipfs/go-datastore/sync"
+	files "github.com/ipfs/go-ipfs-files"
+	offroute "github.com/ipfs/go-ipfs-routing/offline"
+	path "github.com/ipfs/go-path"
+	nsopts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// ttlNamesys resolves names like mockNamesys, with a TTL.
+type ttlNamesys struct {
+	mockNamesys
+	ttl time.Duration
+}
+
+func (m ttlNamesys) ResolveAsync(ctx context.Context, name string, opts ...nsopts.ResolveOpt) <-chan namesys.Result {
+	out := make(chan namesys.Result, 1)
+	v, err := m.Resolve(ctx, name, opts...)
+	out <- namesys.Result{Path: v, Err: err, TTL: m.ttl}
+	close(out)
+	return out
+}
+
+func TestGatewayCache(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+	ts.Close()
+
+	a, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("b")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newServer := func(ttl time.Duration) *httptest.Server {
+		return httptest.NewServer(newGatewayHandler(GatewayConfig{Namesys: ttlNamesys{ns, ttl}}, api))
+	}
+
+	ns["/ipns/example.com"] = path.FromString(a.String())
+	cached := newServer(time.Minute)
+	defer cached.Close()
+	res, body := doRequest(t, http.MethodGet, cached.URL+"/ipns/example.com", nil, nil)
+	if string(body) != "a" {
+		t.Fatalf("unexpected response %d: %s", res.StatusCode, body)
+	}
+	if cc := res.Header.Get("Cache-Control"); cc != "public, max-age=60" && cc != "public, max-age=59" {
+		t.Fatalf("expected the TTL in the Cache-Control header, got %q", cc)
+	}
+
+	// the resolution is cached for the TTL
+	ns["/ipns/example.com"] = path.FromString(b.String())
+	if res, body = doRequest(t, http.MethodGet, cached.URL+"/ipns/example.com", nil, nil); string(body) != "a" {
+		t.Fatalf("expected the cached resolution, got %d: %s", res.StatusCode, body)
+	}
+	res, body = doRequest(t, http.MethodGet, cached.URL+"/ipns/example.com?format=raw", nil, nil)
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Cache-Control"), "public, max-age=") {
+		t.Fatalf("expected the TTL in the Cache-Control header of raw blocks, got %d %q", res.StatusCode, res.Header.Get("Cache-Control"))
+	}
+
+	expiring := newServer(50 * time.Millisecond)
+	defer expiring.Close()
+	if _, body = doRequest(t, http.MethodGet, expiring.URL+"/ipns/example.com", nil, nil); string(body) != "b" {
+		t.Fatalf("unexpected response %s", body)
+	}
+	ns["/ipns/example.com"] = path.FromString(a.String())
+	time.Sleep(100 * time.Millisecond)
+	if _, body = doRequest(t, http.MethodGet, expiring.URL+"/ipns/example.com", nil, nil); string(body) != "a" {
+		t.Fatalf("expected the expired resolution to be renewed, got %s", body)
+	}
+
+	// nothing is cached without a TTL
+	uncached := newServer(0)
+	defer uncached.Close()
+	res, body = doRequest(t, http.MethodGet, uncached.URL+"/ipns/example.com", nil, nil)
+	if string(body) != "a" || res.Header.Get("Cache-Control") != "" {
+		t.Fatalf("unexpected response %s with Cache-Control %q", body, res.Header.Get("Cache-Control"))
+	}
+	ns["/ipns/example.com"] = path.FromString(b.String())
+	if _, body = doRequest(t, http.MethodGet, uncached.URL+"/ipns/example.com", nil, nil); string(body) != "b" {
+		t.Fatalf("expected the resolution not to be cached, got %s", body)
+	}
+}
+
+func TestGatewayDNSLinkCache(t *testing.T) {
+	ts, api, ctx := newTestServerAndNode(t, mockNamesys{})
+	ts.Close()
+
+	a, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("b")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the system resolver doesn't report the TTL of the records
+	var (
+		mu     sync.Mutex
+		target = a
+	)
+	lookup := func(name string) ([]string, error) {
+		if name != "_dnslink.example.com." {
+			return nil, fmt.Errorf("no TXT records for %s", name)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return []string{"dnslink=" + target.String()}, nil
+	}
+	dstore := syncds.MutexWrap(datastore.NewMapDatastore())
+	nsys := namesys.NewNameSystem(offroute.NewOfflineRouter(dstore, nil), dstore, 0,
+		namesys.WithDNSResolver(namesys.NewDNSResolverWithLookup(lookup)))
+	gw := httptest.NewServer(newGatewayHandler(GatewayConfig{Namesys: nsys}, api))
+	defer gw.Close()
+
+	res, body := doRequest(t, http.MethodGet, gw.URL+"/ipns/example.com", nil, nil)
+	if string(body) != "a" {
+		t.Fatalf("unexpected response %d: %s", res.StatusCode, body)
+	}
+	if cc := res.Header.Get("Cache-Control"); cc != "public, max-age=60" && cc != "public, max-age=59" {
+		t.Fatalf("expected the default TTL in the Cache-Control header, got %q", cc)
+	}
+
+	// so the resolution is cached for the default TTL
+	mu.Lock()
+	target = b
+	mu.Unlock()
+	if res, body = doRequest(t, http.MethodGet, gw.URL+"/ipns/example.com", nil, nil); string(body) != "a" {
+		t.Fatalf("expected the cached resolution, got %d: %s", res.StatusCode, body)
+	}
+}
+
+func TestGatewayListingCache(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+	defer ts.Close()
+
+	dir, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"a.txt": files.NewBytesFile([]byte("a")),
+		"b.txt": files.NewBytesFile([]byte("b")),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, listing := doRequest(t, http.MethodGet, ts.URL+dir.String()+"/", nil, nil)
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(listing), "a.txt") {
+		t.Fatalf("unexpected listing %d: %s", res.StatusCode, listing)
+	}
+
+	// the cached listing doesn't need the entries anymore
+	a, err := api.ResolvePath(ctx, ipath.Join(dir, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Block().Rm(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if res, body := doRequest(t, http.MethodGet, ts.URL+dir.String()+"/", nil, nil); res.StatusCode != http.StatusOK || !bytes.Equal(body, listing) {
+		t.Fatalf("expected the cached listing, got %d: %s", res.StatusCode, body)
+	}
+
+	// other pages are rendered again
+	if res, _ := doRequest(t, http.MethodGet, ts.URL+dir.String()+"/?limit=1", nil, nil); res.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected the listing to be rendered again, got %d", res.StatusCode)
+	}
+}
@@ -1,6 +1,7 @@
 package corehttp
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -25,6 +26,9 @@ import (
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	ipath "github.com/ipfs/interface-go-ipfs-core/path"
 	routing "github.com/libp2p/go-libp2p-core/routing"
+
+	"github.com/ipfs/go-ipfs/denylist"
+	"github.com/ipfs/go-ipfs/namesys/resolve"
 )
 
 const (
@@ -37,6 +41,9 @@ const (
 type gatewayHandler struct {
 	config GatewayConfig
 	api    coreiface.CoreAPI
+	cache  *gatewayCache
+
+	writeTokens []*writeToken
 }
 
 // StatusResponseWriter enables us to override HTTP Status Code passed to
@@ -62,6 +69,9 @@ func newGatewayHandler(c GatewayConfig, api coreiface.CoreAPI) *gatewayHandler {
 	i := &gatewayHandler{
 		config: c,
 		api:    api,
+		cache:  newGatewayCache(c.Cache),
+
+		writeTokens: newWriteTokens(c.WriteTokens),
 	}
 	return i
 }
@@ -94,13 +104,31 @@ func (i *gatewayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	defer func() {
 		if r := recover(); r != nil {
+			if r == http.ErrAbortHandler {
+				// let net/http abort the response
+				panic(r)
+			}
 			log.Error("A panic occurred in the gateway handler!")
 			log.Error(r)
 			debug.PrintStack()
 		}
 	}()
 
+	// blocked content is refused before spending any time resolving it
+	if i.config.Denylist.IsPathDenied(r.URL.Path) {
+		webError(w, "ipfs resolve -r "+r.URL.EscapedPath(), denylist.ErrBlocked, http.StatusGone)
+		return
+	}
+
 	if i.config.Writable {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodDelete:
+			// writes may be restricted to the holders of tokens
+			if !i.authorizeWrite(w, r) {
+				return
+			}
+		}
+
 		switch r.Method {
 		case http.MethodPost:
 			i.postHandler(w, r)
@@ -196,17 +224,45 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	// Resolve path to the final DAG node for the ETag
-	resolvedPath, err := i.api.ResolvePath(r.Context(), parsedPath)
+	resolvedPath, ttl, err := i.resolvePath(r.Context(), parsedPath)
 	switch err {
 	case nil:
 	case coreiface.ErrOffline:
 		webError(w, "ipfs resolve -r "+escapedURLPath, err, http.StatusServiceUnavailable)
 		return
+	case denylist.ErrBlocked:
+		webError(w, "ipfs resolve -r "+escapedURLPath, err, http.StatusGone)
+		return
 	default:
+		// paths missing from websites may be handled by their _redirects
+		if _, ok := err.(resolver.ErrNoLink); ok && i.serveRedirects(w, r, urlPath, requestURI.Path) {
+			return
+		}
 		webError(w, "ipfs resolve -r "+escapedURLPath, err, http.StatusNotFound)
 		return
 	}
 
+	// the path may resolve to blocked content through IPNS or links
+	if i.isDenied(resolvedPath) {
+		webError(w, "ipfs resolve -r "+escapedURLPath, denylist.ErrBlocked, http.StatusGone)
+		return
+	}
+
+	// verifiable responses of the blocks themselves
+	format, err := responseFormat(r)
+	if err != nil {
+		webError(w, "invalid format", err, http.StatusBadRequest)
+		return
+	}
+	switch format {
+	case rawResponseFormat:
+		i.serveRawBlock(w, r, resolvedPath, urlPath, ttl)
+		return
+	case carResponseFormat:
+		i.serveCar(w, r, resolvedPath, urlPath, ttl)
+		return
+	}
+
 	dr, err := i.api.Unixfs().Get(r.Context(), resolvedPath)
 	if err != nil {
 		webError(w, "ipfs cat "+escapedURLPath, err, http.StatusNotFound)
@@ -217,6 +273,14 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 
 	defer dr.Close()
 
+	// directories can be downloaded as archives
+	if download := r.URL.Query().Get("download"); download != "" {
+		if dir, ok := dr.(files.Directory); ok {
+			i.serveArchive(w, r, dir, resolvedPath, urlPath, ttl, download)
+			return
+		}
+	}
+
 	// Check etag send back to us
 	etag := "\"" + resolvedPath.Cid().String() + "\""
 	if r.Header.Get("If-None-Match") == etag || r.Header.Get("If-None-Match") == "W/"+etag {
@@ -227,6 +291,7 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 	i.addUserHeaders(w) // ok, _now_ write user's headers.
 	w.Header().Set("X-IPFS-Path", urlPath)
 	w.Header().Set("Etag", etag)
+	setIpnsCacheControl(w, urlPath, ttl)
 
 	// set these headers _after_ the error, for we may just not have it
 	// and don't want the client to cache a 500 response...
@@ -253,36 +318,50 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		i.serveFile(w, r, name, modtime, f)
 		return
 	}
-	dir, ok := dr.(files.Directory)
-	if !ok {
+	if _, ok := dr.(files.Directory); !ok {
 		internalWebError(w, fmt.Errorf("unsupported file type"))
 		return
 	}
 
-	idx, err := i.api.Unixfs().Get(r.Context(), ipath.Join(resolvedPath, "index.html"))
-	switch err.(type) {
-	case nil:
-		dirwithoutslash := urlPath[len(urlPath)-1] != '/'
-		goget := r.URL.Query().Get("go-get") == "1"
-		if dirwithoutslash && !goget {
-			// See comment above where originalUrlPath is declared.
-			http.Redirect(w, r, originalUrlPath+"/", 302)
-			return
-		}
+	// JSON listings are returned even for directories with an index.html
+	if format != jsonResponseFormat {
+		idx, err := i.api.Unixfs().Get(r.Context(), ipath.Join(resolvedPath, "index.html"))
+		switch err.(type) {
+		case nil:
+			dirwithoutslash := urlPath[len(urlPath)-1] != '/'
+			goget := r.URL.Query().Get("go-get") == "1"
+			if dirwithoutslash && !goget {
+				// See comment above where originalUrlPath is declared.
+				http.Redirect(w, r, originalUrlPath+"/", 302)
+				return
+			}
+
+			f, ok := idx.(files.File)
+			if !ok {
+				internalWebError(w, files.ErrNotReader)
+				return
+			}
 
-		f, ok := idx.(files.File)
-		if !ok {
-			internalWebError(w, files.ErrNotReader)
+			// write to request
+			i.serveFile(w, r, "index.html", modtime, f)
+			return
+		case resolver.ErrNoLink:
+			// no index.html; noop
+		default:
+			internalWebError(w, err)
 			return
 		}
+	}
 
-		// write to request
-		i.serveFile(w, r, "index.html", modtime, f)
+	page, err := parseListingPage(r.URL.Query())
+	if err != nil {
+		webError(w, "invalid listing page", err, http.StatusBadRequest)
 		return
-	case resolver.ErrNoLink:
-		// no index.html; noop
-	default:
-		internalWebError(w, err)
+	}
+	w.Header().Add("Vary", "Accept")
+
+	if format == jsonResponseFormat {
+		i.serveJSONListing(w, r, resolvedPath, urlPath, originalUrlPath, page)
 		return
 	}
 
@@ -290,23 +369,53 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// the listing only depends on the directory and the request
+	key := listingKey{resolvedPath.Cid().String(), urlPath, originalUrlPath, r.URL.RawQuery}
+	listing, ok := i.cache.getListing(key)
+	if !ok {
+		listing, err = i.renderListing(r.Context(), resolvedPath, urlPath, originalUrlPath, page, r.URL.Query())
+		if err != nil {
+			internalWebError(w, err)
+			return
+		}
+		i.cache.addListing(key, listing)
+	}
+	if listing.next != "" {
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", listing.next))
+	}
+
+	// See statusResponseWriter.WriteHeader
+	// and https://github.com/ipfs/go-ipfs/issues/7164
+	// Note: this needs to occur before writing the listing otherwise we get
+	// superfluous response.WriteHeader call from prometheus/client_golang
+	if w.Header().Get("Location") != "" {
+		w.WriteHeader(http.StatusMovedPermanently)
+		return
+	}
+
+	w.Write(listing.html)
+}
+
+// renderListing renders the page of the HTML listing of the directory.
+func (i *gatewayHandler) renderListing(ctx context.Context, resolvedPath ipath.Resolved, urlPath, originalUrlPath string, page listingPage, q url.Values) (renderedListing, error) {
 	// storage for directory listing
 	var dirListing []directoryItem
-	dirit := dir.Entries()
-	for dirit.Next() {
+	// See comment above where originalUrlPath is declared.
+	more, err := i.listDirectory(ctx, resolvedPath, originalUrlPath, page, func(entry directoryEntry) error {
 		size := "?"
-		if s, err := dirit.Node().Size(); err == nil {
-			// Size may not be defined/supported. Continue anyways.
-			size = humanize.Bytes(uint64(s))
+		if entry.Size >= 0 {
+			size = humanize.Bytes(uint64(entry.Size))
 		}
-
-		// See comment above where originalUrlPath is declared.
-		di := directoryItem{size, dirit.Name(), gopath.Join(originalUrlPath, dirit.Name())}
-		dirListing = append(dirListing, di)
+		dirListing = append(dirListing, directoryItem{size, entry.Name, entry.Path})
+		return nil
+	})
+	if err != nil {
+		return renderedListing{}, err
 	}
-	if dirit.Err() != nil {
-		internalWebError(w, dirit.Err())
-		return
+
+	var listing renderedListing
+	if more {
+		listing.next = page.next(originalUrlPath, q)
 	}
 
 	// construct the correct back link
@@ -341,20 +450,80 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		Hash:     hash,
 	}
 
-	// See statusResponseWriter.WriteHeader
-	// and https://github.com/ipfs/go-ipfs/issues/7164
-	// Note: this needs to occur before listingTemplate.Execute otherwise we get
-	// superfluous response.WriteHeader call from prometheus/client_golang
-	if w.Header().Get("Location") != "" {
-		w.WriteHeader(http.StatusMovedPermanently)
-		return
+	var buf bytes.Buffer
+	if err := listingTemplate.Execute(&buf, tplData); err != nil {
+		return renderedListing{}, err
+	}
+	listing.html = buf.Bytes()
+	return listing, nil
+}
+
+// resolvePath resolves the path to the final DAG node, also returning how
+// long the result may be cached: the TTL of the records of /ipns/ paths,
+// zero when unknown. Resolved /ipns/ paths are cached for their TTL.
+//
+// The /ipfs/ paths /ipns/ paths resolve to are checked against the denylist
+// before resolving their remainder, failing with denylist.ErrBlocked.
+func (i *gatewayHandler) resolvePath(ctx context.Context, p ipath.Path) (ipath.Resolved, time.Duration, error) {
+	if p.Namespace() != "ipns" {
+		resolvedPath, err := i.api.ResolvePath(ctx, p)
+		return resolvedPath, 0, err
 	}
 
-	err = listingTemplate.Execute(w, tplData)
+	if resolvedPath, ttl, ok := i.cache.getPath(p.String()); ok {
+		return resolvedPath, ttl, nil
+	}
+
+	ipfsPath, ttl, err := i.resolveIPNS(ctx, p)
 	if err != nil {
-		internalWebError(w, err)
-		return
+		return nil, 0, err
+	}
+	if i.config.Denylist.IsPathDenied(ipfsPath.String()) {
+		return nil, 0, denylist.ErrBlocked
+	}
+	resolvedPath, err := i.api.ResolvePath(ctx, ipfsPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	i.cache.addPath(p.String(), resolvedPath, ttl)
+	return resolvedPath, ttl, nil
+}
+
+// resolveIPNS resolves the name of an /ipns/ path, returning the /ipfs/ path
+// it resolves to and how long it may be cached, zero when unknown.
+func (i *gatewayHandler) resolveIPNS(ctx context.Context, p ipath.Path) (ipath.Path, time.Duration, error) {
+	if i.config.Namesys == nil {
+		name := strings.TrimPrefix(p.String(), ipnsPathPrefix)
+		var rest string
+		if idx := strings.IndexByte(name, '/'); idx >= 0 {
+			name, rest = name[:idx], name[idx+1:]
+		}
+		ipfsPath, err := i.api.Name().Resolve(ctx, name)
+		if err != nil || rest == "" {
+			return ipfsPath, 0, err
+		}
+		return ipath.Join(ipfsPath, rest), 0, nil
+	}
+
+	ipfsPath, ttl, err := resolve.ResolveIPNSWithTTL(ctx, i.config.Namesys, path.Path(p.String()))
+	if err != nil {
+		return nil, 0, err
 	}
+	return ipath.New(ipfsPath.String()), ttl, nil
+}
+
+// setIpnsCacheControl lets clients cache the content of /ipns/ paths for the
+// TTL of their records.
+func setIpnsCacheControl(w http.ResponseWriter, urlPath string, ttl time.Duration) {
+	if ttl > 0 && strings.HasPrefix(urlPath, ipnsPathPrefix) {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(ttl.Seconds())))
+	}
+}
+
+// isDenied returns whether the denylist blocks the content at the resolved
+// path.
+func (i *gatewayHandler) isDenied(resolvedPath ipath.Resolved) bool {
+	return i.config.Denylist.IsPathDenied(resolvedPath.String()) || i.config.Denylist.IsCidDenied(resolvedPath.Cid())
 }
 
 func (i *gatewayHandler) serveFile(w http.ResponseWriter, req *http.Request, name string, modtime time.Time, file files.File) {
@@ -377,6 +546,9 @@ func (i *gatewayHandler) serveFile(w http.ResponseWriter, req *http.Request, nam
 	} else {
 		ctype = mime.TypeByExtension(gopath.Ext(name))
 		if ctype == "" {
+			// HEAD requests are sniffed too, to get the Content-Type of GET
+			// requests. Only the first blocks of the file are fetched.
+			//
 			// uses https://github.com/gabriel-vasile/mimetype library to determine the content type.
 			// Fixes https://github.com/ipfs/go-ipfs/issues/7252
 			mimeType, err := mimetype.DetectReader(content)
@@ -400,10 +572,12 @@ func (i *gatewayHandler) serveFile(w http.ResponseWriter, req *http.Request, nam
 			ctype = "text/html"
 		}
 	}
-	w.Header().Set("Content-Type", ctype)
+	if ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
 
 	w = &statusResponseWriter{w}
-	http.ServeContent(w, req, name, modtime, content)
+	serveContent(w, req, modtime, size, content)
 }
 
 func (i *gatewayHandler) postHandler(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,241 @@
+package corehttp
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	gopath "path"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-ipfs/repo"
+
+	humanize "github.com/dustin/go-humanize"
+	files "github.com/ipfs/go-ipfs-files"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// GatewayArchivesConfigKey is the config section configuring the archives of
+// directories served by the gateway.
+const GatewayArchivesConfigKey = "GatewayArchives"
+
+// DefaultMaxArchiveSize is the size of the largest directories archived by
+// default.
+const DefaultMaxArchiveSize = "1GB"
+
+// GatewayArchivesConfig configures the archives of directories served by the
+// gateway.
+type GatewayArchivesConfig struct {
+	// MaxSize is the size of the largest directories archived, like "1GB",
+	// DefaultMaxArchiveSize if empty. Archives are disabled if it's 0.
+	MaxSize string
+}
+
+// LoadGatewayArchivesConfig reads the GatewayArchives section of the config
+// of the given repo, returning the size of the largest directories archived.
+func LoadGatewayArchivesConfig(r repo.Repo) (int64, error) {
+	var cfg GatewayArchivesConfig
+
+	if err := repo.LoadConfigSection(r, GatewayArchivesConfigKey, &cfg); err != nil {
+		return 0, err
+	}
+
+	if cfg.MaxSize == "" {
+		cfg.MaxSize = DefaultMaxArchiveSize
+	}
+	size, err := humanize.ParseBytes(cfg.MaxSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s config: MaxSize %q: %s", GatewayArchivesConfigKey, cfg.MaxSize, err)
+	}
+	return int64(size), nil
+}
+
+var errArchiveTooLarge = errors.New("the archive exceeds the maximum size")
+
+// archiveFormats maps the formats of the download query parameter to their
+// content types.
+var archiveFormats = map[string]string{
+	"tar": "application/x-tar",
+	"zip": "application/zip",
+}
+
+// serveArchive streams the directory as a TAR or ZIP archive, written as
+// 'ipfs get --archive' writes TARs. Directories larger than the maximum
+// archive size are refused.
+func (i *gatewayHandler) serveArchive(w http.ResponseWriter, r *http.Request, dir files.Directory, resolvedPath ipath.Resolved, urlPath string, ttl time.Duration, format string) {
+	contentType, ok := archiveFormats[format]
+	if !ok {
+		webError(w, "invalid download", fmt.Errorf("unsupported archive format %q", format), http.StatusBadRequest)
+		return
+	}
+	if i.config.MaxArchiveSize <= 0 {
+		webError(w, "ipfs get "+urlPath, errors.New("archives are disabled"), http.StatusForbidden)
+		return
+	}
+	// the cumulative size of the directory is an upper bound of the size of
+	// its content, which is limited while streaming too
+	if size, err := dir.Size(); err != nil || size > i.config.MaxArchiveSize {
+		webError(w, "ipfs get "+urlPath, errArchiveTooLarge, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	c := resolvedPath.Cid()
+	etag := "\"" + c.String() + "." + format + "\""
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	name := r.URL.Query().Get("filename")
+	if name == "" {
+		name = getFilename(urlPath)
+	}
+	if name == "" {
+		name = c.String()
+	}
+	name = gopath.Base(name)
+	if !isSafeEntryName(name) {
+		name = c.String()
+	}
+
+	i.setVerifiableHeaders(w, urlPath, ttl, etag, contentType, name+"."+format)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// the content blocked under the directory is left out, and so are the
+	// entries whose names would escape the archive
+	dir = i.config.Denylist.FilterDirectory(r.Context(), i.api.Dag(), dir, c, urlPath, resolvedPath.String())
+	dir = &safeDirectory{dir}
+
+	// as for CARs, errors can only be reported by aborting the response
+	w.WriteHeader(http.StatusOK)
+	lw := &limitedWriter{w: w, n: i.config.MaxArchiveSize}
+	var err error
+	switch format {
+	case "tar":
+		err = writeTar(lw, dir, name)
+	case "zip":
+		err = writeZip(lw, dir, name)
+	}
+	if err != nil {
+		log.Errorf("aborting the archive of %s: %s", urlPath, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// isSafeEntryName returns whether the name of a directory entry can be a path
+// element of the entries of archives. Names with separators, "." and ".."
+// would place the entries outside of the directory archives are extracted to.
+func isSafeEntryName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// safeDirectory is a directory without the entries with unsafe names, at any
+// depth.
+type safeDirectory struct {
+	files.Directory
+}
+
+func (d *safeDirectory) Entries() files.DirIterator {
+	return &safeIterator{d.Directory.Entries()}
+}
+
+type safeIterator struct {
+	files.DirIterator
+}
+
+func (it *safeIterator) Next() bool {
+	for it.DirIterator.Next() {
+		if isSafeEntryName(it.Name()) {
+			return true
+		}
+		log.Debugf("leaving the entry %q out of the archive", it.Name())
+	}
+	return false
+}
+
+func (it *safeIterator) Node() files.Node {
+	if sub, ok := it.DirIterator.Node().(files.Directory); ok {
+		return &safeDirectory{sub}
+	}
+	return it.DirIterator.Node()
+}
+
+// limitedWriter fails the writes past n bytes.
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > lw.n {
+		return 0, errArchiveTooLarge
+	}
+	n, err := lw.w.Write(p)
+	lw.n -= int64(n)
+	return n, err
+}
+
+func writeTar(w io.Writer, nd files.Node, name string) error {
+	tw, err := files.NewTarWriter(w)
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteFile(nd, name); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func writeZip(w io.Writer, nd files.Node, name string) error {
+	zw := zip.NewWriter(w)
+	if err := writeZipNode(zw, nd, name); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeZipNode adds the node to the archive, recursively, as
+// files.TarWriter does for TARs.
+func writeZipNode(zw *zip.Writer, nd files.Node, fpath string) error {
+	header := &zip.FileHeader{Name: fpath, Method: zip.Deflate, Modified: time.Now()}
+	switch nd := nd.(type) {
+	case *files.Symlink:
+		header.Method = zip.Store
+		header.SetMode(os.ModeSymlink | 0777) // symlinks hold their target
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(fw, nd.Target)
+		return err
+	case files.File:
+		header.SetMode(0644)
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fw, nd)
+		return err
+	case files.Directory:
+		header.Name += "/"
+		header.Method = zip.Store
+		header.SetMode(os.ModeDir | 0755)
+		if _, err := zw.CreateHeader(header); err != nil {
+			return err
+		}
+		it := nd.Entries()
+		for it.Next() {
+			if err := writeZipNode(zw, it.Node(), gopath.Join(fpath, it.Name())); err != nil {
+				return err
+			}
+		}
+		return it.Err()
+	default:
+		return fmt.Errorf("file type %T is not supported", nd)
+	}
+}
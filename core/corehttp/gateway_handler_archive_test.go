@@ -0,0 +1,217 @@
+package corehttp
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/denylist"
+
+	files "github.com/ipfs/go-ipfs-files"
+	ft "github.com/ipfs/go-unixfs"
+)
+
+func TestGatewayArchives(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+	defer ts.Close()
+
+	dir, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"a.txt": files.NewBytesFile([]byte("a")),
+		"sub": files.NewMapDirectory(map[string]files.Node{
+			"b.txt":   files.NewBytesFile([]byte("b")),
+			"private": files.NewBytesFile([]byte("private")),
+			"listed":  files.NewBytesFile([]byte("listed")),
+		}),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("listed")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := ioutil.TempFile("", "denylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(list.Name())
+	fmt.Fprintf(list, "%s/sub/private\n%s\n", dir.Cid(), listed.Cid())
+	list.Close()
+	d, err := denylist.New(list.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newServer := func(max int64) *httptest.Server {
+		return httptest.NewServer(newGatewayHandler(GatewayConfig{MaxArchiveSize: max, Denylist: d}, api))
+	}
+	gw := newServer(1 << 20)
+	defer gw.Close()
+	expected := []string{"archive/", "archive/a.txt:a", "archive/sub/", "archive/sub/b.txt:b"}
+
+	res, body := doRequest(t, http.MethodGet, gw.URL+dir.String()+"?download=tar&filename=archive", nil, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected a TAR, got %d: %s", res.StatusCode, body)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "application/x-tar" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if cd := res.Header.Get("Content-Disposition"); !strings.Contains(cd, `filename="archive.tar"`) {
+		t.Errorf("unexpected content disposition %q", cd)
+	}
+	checkArchiveEntries(t, "tar", tarEntries(t, body), expected)
+
+	res, body = doRequest(t, http.MethodGet, gw.URL+dir.String()+"?download=zip&filename=archive", nil, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected a ZIP, got %d: %s", res.StatusCode, body)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	checkArchiveEntries(t, "zip", zipEntries(t, body), expected)
+
+	// the name defaults to the CID, or the last segment of the path
+	res, _ = doRequest(t, http.MethodHead, gw.URL+dir.String()+"?download=tar", nil, nil)
+	if cd := res.Header.Get("Content-Disposition"); !strings.Contains(cd, dir.Cid().String()+".tar") {
+		t.Errorf("unexpected content disposition %q", cd)
+	}
+	res, body = doRequest(t, http.MethodHead, gw.URL+dir.String()+"/sub?download=zip", nil, nil)
+	if cd := res.Header.Get("Content-Disposition"); !strings.Contains(cd, `filename="sub.zip"`) || len(body) != 0 {
+		t.Errorf("unexpected HEAD response %q: %q", cd, body)
+	}
+
+	res, _ = doRequest(t, http.MethodGet, gw.URL+dir.String()+"?download=tar", nil, http.Header{"If-None-Match": {`"` + dir.Cid().String() + `.tar"`}})
+	if res.StatusCode != http.StatusNotModified {
+		t.Errorf("expected the archive not to be modified, got %d", res.StatusCode)
+	}
+
+	// files aren't archived
+	if res, _ := doRequest(t, http.MethodGet, gw.URL+dir.String()+"/a.txt?download=tar", nil, nil); res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") == "application/x-tar" {
+		t.Errorf("expected the file to be served as is")
+	}
+
+	for _, test := range []struct {
+		max    int64
+		query  string
+		status int
+	}{
+		{1 << 20, "?download=rar", http.StatusBadRequest},
+		{10, "?download=tar", http.StatusRequestEntityTooLarge},
+		{0, "?download=zip", http.StatusForbidden},
+	} {
+		gw := newServer(test.max)
+		res, body := doRequest(t, http.MethodGet, gw.URL+dir.String()+test.query, nil, nil)
+		gw.Close()
+		if res.StatusCode != test.status {
+			t.Errorf("%s with a max size of %d: expected %d, got %d: %s", test.query, test.max, test.status, res.StatusCode, body)
+		}
+	}
+}
+
+func TestGatewayArchivesUnsafeNames(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+	defer ts.Close()
+
+	// unixfs doesn't restrict the names of the links of directories
+	file, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("x")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileNode, err := api.Dag().Get(ctx, file.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := ft.EmptyDirNode()
+	for _, name := range []string{"ok", "..", ".", "", "../escape", "a/../../x", `..\x`} {
+		if err := dir.AddNodeLink(name, fileNode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := api.Dag().Add(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	gw := httptest.NewServer(newGatewayHandler(GatewayConfig{MaxArchiveSize: 1 << 20}, api))
+	defer gw.Close()
+	get := func(query string) []byte {
+		t.Helper()
+		res, body := doRequest(t, http.MethodGet, gw.URL+"/ipfs/"+dir.Cid().String()+query, nil, nil)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected an archive, got %d: %s", query, res.StatusCode, body)
+		}
+		return body
+	}
+
+	// the entries escaping the archive are left out, and so is the name
+	expected := []string{dir.Cid().String() + "/", dir.Cid().String() + "/ok:x"}
+	checkArchiveEntries(t, "tar", tarEntries(t, get("?download=tar&filename=..")), expected)
+	checkArchiveEntries(t, "zip", zipEntries(t, get("?download=zip&filename=..")), expected)
+}
+
+// tarEntries returns the entries of the TAR archive, with their content.
+func tarEntries(t *testing.T, body []byte) []string {
+	t.Helper()
+	var entries []string
+	tr := tar.NewReader(bytes.NewReader(body))
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry := h.Name
+		if h.Typeflag == tar.TypeDir {
+			entry = strings.TrimSuffix(entry, "/") + "/"
+		} else {
+			content, _ := ioutil.ReadAll(tr)
+			entry += ":" + string(content)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// zipEntries returns the entries of the ZIP archive, with their content.
+func zipEntries(t *testing.T, body []byte) []string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []string
+	for _, f := range zr.File {
+		entry := f.Name
+		if !f.FileInfo().IsDir() {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, _ := ioutil.ReadAll(rc)
+			rc.Close()
+			entry += ":" + string(content)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func checkArchiveEntries(t *testing.T, format string, entries, expected []string) {
+	t.Helper()
+	sort.Strings(entries)
+	if strings.Join(entries, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected %s entries %v, expected %v", format, entries, expected)
+	}
+}
@@ -0,0 +1,176 @@
+package corehttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	gopath "path"
+	"strconv"
+
+	files "github.com/ipfs/go-ipfs-files"
+	ipld "github.com/ipfs/go-ipld-format"
+	uio "github.com/ipfs/go-unixfs/io"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	jsonResponseFormat = "json"
+	jsonContentType    = "application/json"
+)
+
+// listingPage is the page of a directory listing requested with the offset
+// and limit query parameters. A zero limit lists all the entries.
+type listingPage struct {
+	offset, limit int
+}
+
+func parseListingPage(q url.Values) (listingPage, error) {
+	var page listingPage
+	for _, param := range []struct {
+		name string
+		v    *int
+	}{{"offset", &page.offset}, {"limit", &page.limit}} {
+		s := q.Get(param.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return listingPage{}, fmt.Errorf("invalid %s %q", param.name, s)
+		}
+		*param.v = n
+	}
+	return page, nil
+}
+
+// next returns the URL of the following page.
+func (page listingPage) next(urlPath string, q url.Values) string {
+	next := make(url.Values, len(q))
+	for k, v := range q {
+		next[k] = v
+	}
+	next.Set("offset", strconv.Itoa(page.offset+page.limit))
+	next.Set("limit", strconv.Itoa(page.limit))
+	return (&url.URL{Path: urlPath, RawQuery: next.Encode()}).String()
+}
+
+// directoryEntry is an entry of a directory listing.
+type directoryEntry struct {
+	Name string
+	Hash string
+	// Size is -1 when it's unknown.
+	Size int64
+	Type string
+	Path string
+}
+
+var errEndOfPage = errors.New("end of the page")
+
+// listDirectory calls fn with the entries of the directory in the page, and
+// returns whether the directory has entries after the page.
+//
+// The links of the directory are walked in order, fetching only the nodes
+// of the entries in the page: the entries before the page only cost the
+// blocks of the directory itself, which can be sharded.
+func (i *gatewayHandler) listDirectory(ctx context.Context, resolvedPath ipath.Resolved, urlPath string, page listingPage, fn func(directoryEntry) error) (bool, error) {
+	nd, err := i.api.Dag().Get(ctx, resolvedPath.Cid())
+	if err != nil {
+		return false, err
+	}
+	dir, err := uio.NewDirectoryFromNode(i.api.Dag(), nd)
+	if err != nil {
+		return false, err
+	}
+
+	n := 0
+	more := false
+	err = dir.ForEachLink(ctx, func(l *ipld.Link) error {
+		defer func() { n++ }()
+		if n < page.offset {
+			return nil
+		}
+		if page.limit > 0 && n >= page.offset+page.limit {
+			more = true
+			return errEndOfPage
+		}
+
+		entry, err := i.directoryEntry(ctx, l)
+		if err != nil {
+			return err
+		}
+		entry.Path = gopath.Join(urlPath, l.Name)
+		return fn(entry)
+	})
+	if err != nil && err != errEndOfPage {
+		return false, err
+	}
+	return more, nil
+}
+
+func (i *gatewayHandler) directoryEntry(ctx context.Context, l *ipld.Link) (directoryEntry, error) {
+	nd, err := i.api.Unixfs().Get(ctx, ipath.IpfsPath(l.Cid))
+	if err != nil {
+		return directoryEntry{}, err
+	}
+	defer nd.Close()
+
+	entry := directoryEntry{Name: l.Name, Hash: l.Cid.String(), Size: -1, Type: "file"}
+	// Size may not be defined/supported.
+	if s, err := nd.Size(); err == nil {
+		entry.Size = s
+	}
+	switch nd.(type) {
+	case files.Directory:
+		entry.Type = "directory"
+	case *files.Symlink:
+		entry.Type = "symlink"
+	}
+	return entry, nil
+}
+
+// serveJSONListing streams the page of the directory listing as JSON:
+//
+//	{"Path": ..., "Hash": ..., "Entries": [...], "Next": ...}
+//
+// where Next, the URL of the following page, is only set if the directory
+// has more entries. The listing is written as it's walked, so errors abort
+// the response.
+func (i *gatewayHandler) serveJSONListing(w http.ResponseWriter, r *http.Request, resolvedPath ipath.Resolved, urlPath, originalUrlPath string, page listingPage) {
+	w.Header().Set("Content-Type", jsonContentType)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	quote := func(s string) []byte {
+		b, _ := json.Marshal(s)
+		return b
+	}
+	fmt.Fprintf(w, `{"Path":%s,"Hash":%s,"Entries":[`, quote(urlPath), quote(resolvedPath.Cid().String()))
+
+	first := true
+	more, err := i.listDirectory(r.Context(), resolvedPath, originalUrlPath, page, func(entry directoryEntry) error {
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if !first {
+			b = append([]byte(","), b...)
+		}
+		first = false
+		_, err = w.Write(b)
+		return err
+	})
+	if err != nil {
+		log.Errorf("aborting the listing of %s: %s", urlPath, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	w.Write([]byte("]"))
+	if more {
+		fmt.Fprintf(w, `,"Next":%s`, quote(page.next(originalUrlPath, r.URL.Query())))
+	}
+	w.Write([]byte("}\n"))
+}
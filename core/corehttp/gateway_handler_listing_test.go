@@ -0,0 +1,172 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	files "github.com/ipfs/go-ipfs-files"
+	uio "github.com/ipfs/go-unixfs/io"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+type jsonListing struct {
+	Path    string
+	Hash    string
+	Entries []directoryEntry
+	Next    string
+}
+
+func TestGatewayJSONListing(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+	defer ts.Close()
+
+	dir, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"a.txt":      files.NewBytesFile([]byte("a")),
+		"b.txt":      files.NewBytesFile([]byte("bb")),
+		"c.txt":      files.NewBytesFile([]byte("ccc")),
+		"index.html": files.NewBytesFile([]byte("index")),
+		"sub": files.NewMapDirectory(map[string]files.Node{
+			"d.txt": files.NewBytesFile([]byte("dddd")),
+		}),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getListing := func(p, accept string) jsonListing {
+		t.Helper()
+		res, body := doRequest(t, http.MethodGet, ts.URL+p, nil, http.Header{"Accept": {accept}})
+		if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != jsonContentType {
+			t.Fatalf("%s: unexpected response %d %s: %s", p, res.StatusCode, res.Header.Get("Content-Type"), body)
+		}
+		var listing jsonListing
+		if err := json.Unmarshal(body, &listing); err != nil {
+			t.Fatalf("%s: invalid listing %q: %s", p, body, err)
+		}
+		return listing
+	}
+
+	// the listing is returned despite the index.html
+	listing := getListing(dir.String()+"/", jsonContentType)
+	if listing.Path != dir.String()+"/" || listing.Hash != dir.Cid().String() || listing.Next != "" {
+		t.Fatalf("unexpected listing: %+v", listing)
+	}
+	var names []string
+	for _, e := range listing.Entries {
+		names = append(names, e.Name)
+	}
+	if strings.Join(names, " ") != "a.txt b.txt c.txt index.html sub" {
+		t.Fatalf("unexpected entries: %v", names)
+	}
+	sub, err := api.ResolvePath(ctx, ipath.Join(dir, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := listing.Entries[4]; e.Type != "directory" || e.Hash != sub.Cid().String() || e.Path != dir.String()+"/sub" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+	if e := listing.Entries[1]; e.Type != "file" || e.Size != 2 {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+
+	// pages
+	listing = getListing(dir.String()+"/?format=json&offset=1&limit=2", "")
+	if len(listing.Entries) != 2 || listing.Entries[0].Name != "b.txt" || listing.Entries[1].Name != "c.txt" {
+		t.Fatalf("unexpected page: %+v", listing.Entries)
+	}
+	if listing.Next != dir.String()+"/?format=json&limit=2&offset=3" {
+		t.Fatalf("unexpected next page %s", listing.Next)
+	}
+	listing = getListing(listing.Next, "")
+	if len(listing.Entries) != 2 || listing.Entries[0].Name != "index.html" || listing.Next != "" {
+		t.Fatalf("unexpected last page: %+v", listing)
+	}
+
+	// HTML listings are paginated too
+	res, body := doRequest(t, http.MethodGet, ts.URL+sub.String()+"?limit=1", nil, nil)
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(body), "d.txt") || res.Header.Get("Link") != "" {
+		t.Fatalf("unexpected HTML listing %d: %s", res.StatusCode, res.Header.Get("Link"))
+	}
+
+	res, _ = doRequest(t, http.MethodGet, ts.URL+dir.String()+"/?format=json&offset=-1", nil, nil)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an invalid offset to be rejected, got %d", res.StatusCode)
+	}
+
+	// files are served as usual
+	res, body = doRequest(t, http.MethodGet, ts.URL+dir.String()+"/a.txt", nil, http.Header{"Accept": {jsonContentType}})
+	if res.StatusCode != http.StatusOK || string(body) != "a" {
+		t.Fatalf("unexpected file response %d: %s", res.StatusCode, body)
+	}
+}
+
+func TestGatewayShardedListing(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+	defer ts.Close()
+
+	uio.UseHAMTSharding = true
+	defer func() { uio.UseHAMTSharding = false }()
+
+	entries := make(map[string]files.Node)
+	for i := 0; i < 300; i++ {
+		entries[fmt.Sprintf("file-%03d", i)] = files.NewBytesFile([]byte(fmt.Sprintf("content %d", i)))
+	}
+	dir, err := api.Unixfs().Add(ctx, files.NewMapDirectory(entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links, err := api.Object().Links(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) == 300 {
+		t.Fatal("the directory should be sharded")
+	}
+
+	getListing := func(p string) (*http.Response, jsonListing) {
+		t.Helper()
+		res, body := doRequest(t, http.MethodGet, ts.URL+p, nil, nil)
+		var listing jsonListing
+		if err := json.Unmarshal(body, &listing); err != nil {
+			t.Fatal(err)
+		}
+		return res, listing
+	}
+
+	res, _ := doRequest(t, http.MethodGet, ts.URL+dir.String()+"?limit=10", nil, nil)
+	if link := res.Header.Get("Link"); link != "<"+dir.String()+"?limit=10&offset=10>; rel=\"next\"" {
+		t.Fatalf("unexpected link to the next page of the HTML listing: %s", link)
+	}
+
+	// walk the pages, removing the files listed, which the following pages
+	// must not need
+	seen := make(map[string]bool)
+	next := dir.String() + "?format=json&limit=64"
+	pages := 0
+	for next != "" {
+		res, listing := getListing(next)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d", res.StatusCode)
+		}
+		for _, e := range listing.Entries {
+			if seen[e.Name] {
+				t.Fatalf("%s was listed twice", e.Name)
+			}
+			seen[e.Name] = true
+			if err := api.Block().Rm(ctx, ipath.New("/ipfs/"+e.Hash)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		next = listing.Next
+		pages++
+	}
+	if len(seen) != 300 || pages != 5 {
+		t.Fatalf("expected 300 entries in 5 pages, got %d in %d", len(seen), pages)
+	}
+}
@@ -0,0 +1,303 @@
+package corehttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxByteRanges bounds the number of ranges served in a response. Each range
+// is a separate walk of the DAG, so requests with more ranges are served the
+// whole file instead, as RFC 7233 allows.
+const maxByteRanges = 16
+
+// byteRange is a range of bytes of a file, [start, start+length).
+type byteRange struct {
+	start, length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+var (
+	errInvalidRange   = errors.New("invalid range")
+	errNoOverlapRange = errors.New("no range overlaps the content")
+)
+
+// parseByteRanges parses the value of a Range header for a file of the
+// given size. It returns no ranges if the header is empty, and
+// errNoOverlapRange if none of the ranges are satisfiable.
+func parseByteRanges(s string, size int64) ([]byteRange, error) {
+	if s == "" {
+		return nil, nil
+	}
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) {
+		return nil, errInvalidRange
+	}
+
+	var ranges []byteRange
+	noOverlap := false
+	for _, spec := range strings.Split(s[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		i := strings.Index(spec, "-")
+		if i < 0 {
+			return nil, errInvalidRange
+		}
+		first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+
+		var r byteRange
+		if first == "" {
+			// the last bytes of the file
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errInvalidRange
+			}
+			if n == 0 || size == 0 {
+				noOverlap = true
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errInvalidRange
+			}
+			if start >= size {
+				noOverlap = true
+				continue
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, errInvalidRange
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			r = byteRange{start: start, length: end - start + 1}
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 && noOverlap {
+		return nil, errNoOverlapRange
+	}
+	return ranges, nil
+}
+
+// serveContent serves the content of a file of the given size, as
+// http.ServeContent does, but mapping each requested range onto a seek of
+// the content so that only the blocks of the DAG covering the range are
+// fetched. HEAD requests never read the content.
+//
+// The ETag and Content-Type headers must already be set.
+func serveContent(w http.ResponseWriter, r *http.Request, modtime time.Time, size int64, content io.ReadSeeker) {
+	if !isZeroTime(modtime) {
+		w.Header().Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+	}
+	if code := checkPreconditions(w, r, modtime); code != 0 {
+		if code == http.StatusNotModified {
+			h := w.Header()
+			h.Del("Content-Type")
+			h.Del("Content-Length")
+		}
+		w.WriteHeader(code)
+		return
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	var ranges []byteRange
+	if checkIfRange(w, r, modtime) {
+		var err error
+		ranges, err = parseByteRanges(r.Header.Get("Range"), size)
+		if err != nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if len(ranges) > maxByteRanges || sumRangesSize(ranges) > size {
+			ranges = nil
+		}
+	}
+
+	switch len(ranges) {
+	case 0:
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			copyRange(w, content, byteRange{0, size})
+		}
+	case 1:
+		w.Header().Set("Content-Range", ranges[0].contentRange(size))
+		w.Header().Set("Content-Length", strconv.FormatInt(ranges[0].length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		if r.Method != http.MethodHead {
+			copyRange(w, content, ranges[0])
+		}
+	default:
+		serveMultipartRanges(w, r, ranges, size, content)
+	}
+}
+
+// serveMultipartRanges serves several ranges as a multipart/byteranges
+// response, whose length is computed upfront.
+func serveMultipartRanges(w http.ResponseWriter, r *http.Request, ranges []byteRange, size int64, content io.ReadSeeker) {
+	ctype := w.Header().Get("Content-Type")
+	partHeader := func(br byteRange) textproto.MIMEHeader {
+		h := textproto.MIMEHeader{"Content-Range": {br.contentRange(size)}}
+		if ctype != "" {
+			h.Set("Content-Type", ctype)
+		}
+		return h
+	}
+
+	var cw countingWriter
+	mw := multipart.NewWriter(&cw)
+	for _, br := range ranges {
+		if _, err := mw.CreatePart(partHeader(br)); err != nil {
+			internalWebError(w, err)
+			return
+		}
+		cw += countingWriter(br.length)
+	}
+	mw.Close()
+
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.Header().Set("Content-Length", strconv.FormatInt(int64(cw), 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	boundary := mw.Boundary()
+	mw = multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return
+	}
+	for _, br := range ranges {
+		part, err := mw.CreatePart(partHeader(br))
+		if err != nil {
+			return
+		}
+		if !copyRange(part, content, br) {
+			return
+		}
+	}
+	mw.Close()
+}
+
+// copyRange copies a range of the content to w. Errors happen after the
+// headers were sent, so they can only be logged.
+func copyRange(w io.Writer, content io.ReadSeeker, br byteRange) bool {
+	if _, err := content.Seek(br.start, io.SeekStart); err != nil {
+		log.Debugf("failed to seek to %d: %s", br.start, err)
+		return false
+	}
+	if _, err := io.CopyN(w, content, br.length); err != nil {
+		log.Debugf("failed to serve range %d-%d: %s", br.start, br.start+br.length-1, err)
+		return false
+	}
+	return true
+}
+
+func sumRangesSize(ranges []byteRange) (size int64) {
+	for _, br := range ranges {
+		size += br.length
+	}
+	return size
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+func isZeroTime(t time.Time) bool {
+	return t.IsZero() || t.Equal(time.Unix(0, 0))
+}
+
+// checkPreconditions evaluates the conditional headers of the request
+// against the ETag header of the response and modtime. It returns the status
+// to respond with if a condition fails, or 0.
+func checkPreconditions(w http.ResponseWriter, r *http.Request, modtime time.Time) int {
+	etag := w.Header().Get("Etag")
+
+	if im := r.Header.Get("If-Match"); im != "" {
+		if !etagListMatch(im, etag, true) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ius, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && !isZeroTime(modtime) {
+		if modtime.Truncate(time.Second).After(ius) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etagListMatch(inm, etag, false) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err == nil && !isZeroTime(modtime) && !modtime.Truncate(time.Second).After(ims) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// checkIfRange returns whether the Range header of the request applies,
+// according to its If-Range header.
+func checkIfRange(w http.ResponseWriter, r *http.Request, modtime time.Time) bool {
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return true
+	}
+	if strings.HasPrefix(ir, "\"") || strings.HasPrefix(ir, "W/") {
+		return etagListMatch(ir, w.Header().Get("Etag"), true)
+	}
+	t, err := http.ParseTime(ir)
+	return err == nil && !isZeroTime(modtime) && modtime.Truncate(time.Second).Equal(t)
+}
+
+// etagListMatch returns whether the list of entity tags of a conditional
+// header matches etag. Weak tags never match in strong comparisons.
+func etagListMatch(list, etag string, strong bool) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strong {
+			if candidate == etag && !strings.HasPrefix(etag, "W/") {
+				return true
+			}
+		} else if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package corehttp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+func TestParseByteRanges(t *testing.T) {
+	for _, test := range []struct {
+		header string
+		ranges []byteRange
+		err    error
+	}{
+		{"", nil, nil},
+		{"bytes=0-9", []byteRange{{0, 10}}, nil},
+		{"bytes=5-", []byteRange{{5, 95}}, nil},
+		{"bytes=-10", []byteRange{{90, 10}}, nil},
+		{"bytes=-1000", []byteRange{{0, 100}}, nil},
+		{"bytes=90-1000", []byteRange{{90, 10}}, nil},
+		{"bytes=0-0, 10-19,", []byteRange{{0, 1}, {10, 10}}, nil},
+		{"bytes=0-9,100-", []byteRange{{0, 10}}, nil},
+		{"bytes=100-", nil, errNoOverlapRange},
+		{"bytes=-0", nil, errNoOverlapRange},
+		{"bytes=9-0", nil, errInvalidRange},
+		{"bytes=a-b", nil, errInvalidRange},
+		{"bytes=5", nil, errInvalidRange},
+		{"items=0-9", nil, errInvalidRange},
+	} {
+		ranges, err := parseByteRanges(test.header, 100)
+		if err != test.err {
+			t.Errorf("%q: expected error %v, got %v", test.header, test.err, err)
+			continue
+		}
+		if len(ranges) != len(test.ranges) {
+			t.Errorf("%q: expected %v, got %v", test.header, test.ranges, ranges)
+			continue
+		}
+		for i := range ranges {
+			if ranges[i] != test.ranges[i] {
+				t.Errorf("%q: expected %v, got %v", test.header, test.ranges, ranges)
+			}
+		}
+	}
+}
+
+func TestGatewayRanges(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+	defer ts.Close()
+
+	content := make([]byte, 4096)
+	for i := range content {
+		content[i] = byte('a' + i/1024)
+	}
+	dir, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"file.txt": files.NewBytesFile(content),
+	}), options.Unixfs.Chunker("size-1024"), options.Unixfs.RawLeaves(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := api.ResolvePath(ctx, ipath.Join(dir, "file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaves, err := api.Object().Links(ctx, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaves) != 4 {
+		t.Fatalf("expected 4 leaves, got %d", len(leaves))
+	}
+
+	// files without an extension are sniffed to get their Content-Type, for
+	// HEAD requests as well as GET ones
+	contentType := func(method string) string {
+		t.Helper()
+		res, _ := doRequest(t, method, ts.URL+file.String(), nil, nil)
+		if res.StatusCode != http.StatusOK || res.ContentLength != 4096 {
+			t.Fatalf("unexpected %s response: %d (%d bytes)", method, res.StatusCode, res.ContentLength)
+		}
+		return res.Header.Get("Content-Type")
+	}
+	if head, get := contentType(http.MethodHead), contentType(http.MethodGet); head == "" || head != get {
+		t.Fatalf("expected HEAD to get the Content-Type of GET %q, got %q", get, head)
+	}
+
+	// only the blocks covering the ranges are needed
+	for _, l := range []int{0, 3} {
+		if err := api.Block().Rm(ctx, ipath.IpfsPath(leaves[l].Cid)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	url := ts.URL + dir.String() + "/file.txt"
+	res, body := doRequest(t, http.MethodGet, url, nil, http.Header{"Range": {"bytes=2040-2049"}})
+	if res.StatusCode != http.StatusPartialContent {
+		t.Fatalf("expected a partial response, got %d: %s", res.StatusCode, body)
+	}
+	if res.Header.Get("Content-Range") != "bytes 2040-2049/4096" || !bytes.Equal(body, content[2040:2050]) {
+		t.Fatalf("unexpected range %s: %q", res.Header.Get("Content-Range"), body)
+	}
+
+	res, body = doRequest(t, http.MethodGet, url, nil, http.Header{"Range": {"bytes=1024-1033, 2048-2057"}})
+	if res.StatusCode != http.StatusPartialContent {
+		t.Fatalf("expected a partial response, got %d: %s", res.StatusCode, body)
+	}
+	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("unexpected content type %s", res.Header.Get("Content-Type"))
+	}
+	if res.ContentLength != int64(len(body)) {
+		t.Fatalf("the content length %d doesn't match the body (%d bytes)", res.ContentLength, len(body))
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for _, expected := range []struct {
+		contentRange string
+		data         []byte
+	}{
+		{"bytes 1024-1033/4096", content[1024:1034]},
+		{"bytes 2048-2057/4096", content[2048:2058]},
+	} {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if part.Header.Get("Content-Range") != expected.contentRange || !bytes.Equal(data, expected.data) {
+			t.Fatalf("unexpected part %s: %q", part.Header.Get("Content-Range"), data)
+		}
+		if !strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain") {
+			t.Fatalf("unexpected part content type %s", part.Header.Get("Content-Type"))
+		}
+	}
+
+	// HEAD requests don't read the content
+	res, _ = doRequest(t, http.MethodHead, url, nil, nil)
+	if res.StatusCode != http.StatusOK || res.ContentLength != 4096 || res.Header.Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("unexpected HEAD response: %d (%d bytes)", res.StatusCode, res.ContentLength)
+	}
+	res, _ = doRequest(t, http.MethodHead, url, nil, http.Header{"Range": {"bytes=0-99"}})
+	if res.StatusCode != http.StatusPartialContent || res.Header.Get("Content-Range") != "bytes 0-99/4096" {
+		t.Fatalf("unexpected HEAD response: %d %s", res.StatusCode, res.Header.Get("Content-Range"))
+	}
+
+	res, _ = doRequest(t, http.MethodGet, url, nil, http.Header{"Range": {"bytes=5000-"}})
+	if res.StatusCode != http.StatusRequestedRangeNotSatisfiable || res.Header.Get("Content-Range") != "bytes */4096" {
+		t.Fatalf("unexpected response to an unsatisfiable range: %d %s", res.StatusCode, res.Header.Get("Content-Range"))
+	}
+}
@@ -0,0 +1,149 @@
+package corehttp
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-ipfs/core/coredag"
+
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// Response formats of verifiable gateway responses, which clients can check
+// against the requested CID.
+const (
+	rawResponseFormat = "raw"
+	carResponseFormat = "car"
+
+	rawContentType = "application/vnd.ipld.raw"
+	carContentType = "application/vnd.ipld.car"
+)
+
+// responseFormat returns the format requested with the format query
+// parameter or, failing that, the media type with the highest quality value
+// in the Accept header, the verifiable ones winning ties. It returns an empty
+// string for the regular, deserialized, responses.
+//
+// The json format only applies to directories, whose listing it returns.
+func responseFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		switch format {
+		case rawResponseFormat, carResponseFormat, jsonResponseFormat:
+			return format, nil
+		default:
+			return "", fmt.Errorf("unsupported format %q", format)
+		}
+	}
+
+	var (
+		best     string
+		bestQ    float64
+		accepted bool
+	)
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		if q == 0 {
+			// not acceptable
+			continue
+		}
+
+		var format string
+		switch mediaType {
+		case rawContentType:
+			format = rawResponseFormat
+		case carContentType:
+			format = carResponseFormat
+		case jsonContentType:
+			format = jsonResponseFormat
+		}
+		if !accepted || q > bestQ || (q == bestQ && best == "" && format != "") {
+			best, bestQ, accepted = format, q, true
+		}
+	}
+	return best, nil
+}
+
+// setVerifiableHeaders sets the headers shared by the raw block and CAR
+// responses.
+func (i *gatewayHandler) setVerifiableHeaders(w http.ResponseWriter, urlPath string, ttl time.Duration, etag, contentType, filename string) {
+	i.addUserHeaders(w)
+	w.Header().Set("X-IPFS-Path", urlPath)
+	w.Header().Set("Etag", etag)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Add("Vary", "Accept")
+	if strings.HasPrefix(urlPath, ipfsPathPrefix) {
+		w.Header().Set("Cache-Control", "public, max-age=29030400, immutable")
+	}
+	setIpnsCacheControl(w, urlPath, ttl)
+}
+
+// serveRawBlock responds with the bytes of the block at resolvedPath.
+func (i *gatewayHandler) serveRawBlock(w http.ResponseWriter, r *http.Request, resolvedPath ipath.Resolved, urlPath string, ttl time.Duration) {
+	c := resolvedPath.Cid()
+
+	etag := "\"" + c.String() + ".raw\""
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	rd, err := i.api.Block().Get(r.Context(), resolvedPath)
+	if err != nil {
+		webError(w, "ipfs block get "+c.String(), err, http.StatusNotFound)
+		return
+	}
+	data, err := ioutil.ReadAll(rd)
+	if err != nil {
+		internalWebError(w, err)
+		return
+	}
+
+	name := c.String() + ".bin"
+	i.setVerifiableHeaders(w, urlPath, ttl, etag, rawContentType, name)
+	http.ServeContent(w, r, name, time.Unix(1, 0), bytes.NewReader(data))
+}
+
+// serveCar streams the DAG under resolvedPath as a CARv1, as 'ipfs dag
+// export' does.
+func (i *gatewayHandler) serveCar(w http.ResponseWriter, r *http.Request, resolvedPath ipath.Resolved, urlPath string, ttl time.Duration) {
+	c := resolvedPath.Cid()
+
+	etag := "\"" + c.String() + ".car\""
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	i.setVerifiableHeaders(w, urlPath, ttl, etag, carContentType+"; version=1", c.String()+".car")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// the response is streamed, so an incomplete DAG can only be reported
+	// by aborting it, for clients not to mistake it for a complete CAR. So
+	// are DAGs with blocked content, which can't be left out of them.
+	w.WriteHeader(http.StatusOK)
+	ng := i.config.Denylist.NodeGetter(r.Context(), i.api.Dag(), c, urlPath, resolvedPath.String())
+	if err := coredag.ExportCar(r.Context(), ng, c, w); err != nil {
+		log.Errorf("aborting the CAR export of %s: %s", c, err)
+		panic(http.ErrAbortHandler)
+	}
+}
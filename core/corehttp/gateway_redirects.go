@@ -0,0 +1,337 @@
+package corehttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	gopath "path"
+	"strconv"
+	"strings"
+	"time"
+
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-path/resolver"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+
+	"github.com/ipfs/go-ipfs/denylist"
+)
+
+// redirectsFile is the name of the file, at the root of a website, holding
+// the rules applied to the paths that don't resolve.
+const redirectsFile = "_redirects"
+
+// maxRedirectsFileSize bounds the size of the _redirects files parsed.
+const maxRedirectsFileSize = 64 << 10
+
+// redirectRule is a rule of a _redirects file:
+//
+//	/from/:placeholder/*  /to/:placeholder/:splat  [status]
+//
+// The status defaults to 301. Rules with a 200 status rewrite the request
+// to another path of the website, and rules with a 404 status serve it as
+// a custom "not found" page.
+type redirectRule struct {
+	from   []string
+	to     string
+	status int
+}
+
+// redirectStatuses are the statuses rules can have.
+var redirectStatuses = map[int]bool{
+	200: true,
+	301: true,
+	302: true,
+	303: true,
+	307: true,
+	308: true,
+	404: true,
+	410: true,
+	451: true,
+}
+
+// isRewrite returns whether the rule serves another path of the website,
+// instead of redirecting to it.
+func (rule *redirectRule) isRewrite() bool {
+	return rule.status == 200 || rule.status >= 400
+}
+
+// parseRedirects parses the rules of a _redirects file, in order. Files
+// larger than maxRedirectsFileSize are rejected.
+func parseRedirects(r io.Reader) ([]redirectRule, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxRedirectsFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxRedirectsFileSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", redirectsFile, maxRedirectsFileSize)
+	}
+
+	var rules []redirectRule
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(make([]byte, 0, 4096), maxRedirectsFileSize)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseRedirectRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %s", redirectsFile, n, err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func parseRedirectRule(line string) (redirectRule, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return redirectRule{}, fmt.Errorf("missing the path to redirect to")
+	}
+	if len(fields) > 3 {
+		return redirectRule{}, fmt.Errorf("unexpected %q", fields[3])
+	}
+
+	from, to := fields[0], fields[1]
+	if !strings.HasPrefix(from, "/") {
+		return redirectRule{}, fmt.Errorf("%q is not an absolute path", from)
+	}
+	segs := redirectSegments(from)
+	for i, seg := range segs {
+		if strings.Contains(seg, "*") && (seg != "*" || i != len(segs)-1) {
+			return redirectRule{}, fmt.Errorf("%q: * can only be the last segment", from)
+		}
+	}
+
+	rule := redirectRule{from: segs, to: to, status: 301}
+	if len(fields) == 3 {
+		// Netlify allows forcing rules with a ! suffix; the rules only ever
+		// apply to paths that don't resolve here
+		status, err := strconv.Atoi(strings.TrimSuffix(fields[2], "!"))
+		if err != nil || !redirectStatuses[status] {
+			return redirectRule{}, fmt.Errorf("unsupported status %q", fields[2])
+		}
+		rule.status = status
+	}
+
+	if rule.isRewrite() {
+		if !strings.HasPrefix(to, "/") {
+			return redirectRule{}, fmt.Errorf("%q: the target of status %d rules must be a path of the website", to, rule.status)
+		}
+	} else if !strings.HasPrefix(to, "/") {
+		u, err := url.Parse(to)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return redirectRule{}, fmt.Errorf("%q is neither a path nor an http(s) URL", to)
+		}
+	}
+	return rule, nil
+}
+
+// redirectSegments splits a path into its segments, ignoring the trailing
+// slash.
+func redirectSegments(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// match returns the target of the rule for the given path of the website,
+// with its placeholders and splat substituted.
+func (rule *redirectRule) match(sitePath string) (string, bool) {
+	segs := redirectSegments(sitePath)
+
+	vars := make(map[string]string)
+	for i, pattern := range rule.from {
+		if pattern == "*" {
+			if i > len(segs) {
+				return "", false
+			}
+			vars["splat"] = strings.Join(segs[i:], "/")
+			return rule.expand(vars), true
+		}
+		if i >= len(segs) {
+			return "", false
+		}
+		if strings.HasPrefix(pattern, ":") && len(pattern) > 1 {
+			vars[pattern[1:]] = segs[i]
+		} else if pattern != segs[i] {
+			return "", false
+		}
+	}
+	if len(segs) != len(rule.from) {
+		return "", false
+	}
+	return rule.expand(vars), true
+}
+
+// expand substitutes the :name placeholders of the target, longest names
+// first so that :id doesn't replace the start of :identifier.
+func (rule *redirectRule) expand(vars map[string]string) string {
+	to := rule.to
+	for len(vars) > 0 {
+		var longest string
+		for name := range vars {
+			if len(name) > len(longest) {
+				longest = name
+			}
+		}
+		to = strings.ReplaceAll(to, ":"+longest, vars[longest])
+		delete(vars, longest)
+	}
+	return to
+}
+
+// serveRedirects applies the rules of the _redirects file of the website
+// urlPath belongs to, when urlPath doesn't resolve. It returns whether one of
+// the rules handled the request.
+//
+// The rules only apply to the websites HostnameOption serves at their own
+// origin, with subdomains or DNSLink: on path gateways, the paths of the
+// rules aren't the paths the website is served at.
+func (i *gatewayHandler) serveRedirects(w http.ResponseWriter, r *http.Request, urlPath, requestPath string) bool {
+	if urlPath == requestPath {
+		return false
+	}
+
+	segs := strings.SplitN(strings.TrimPrefix(urlPath, "/"), "/", 3)
+	if len(segs) < 2 {
+		return false
+	}
+	root := "/" + segs[0] + "/" + segs[1]
+	sitePath := "/"
+	if len(segs) == 3 {
+		sitePath += segs[2]
+	}
+
+	rules, err := i.redirectRules(r.Context(), root)
+	if err != nil {
+		webError(w, "failed to parse "+redirectsFile, err, http.StatusInternalServerError)
+		return true
+	}
+	for _, rule := range rules {
+		to, ok := rule.match(sitePath)
+		if !ok {
+			continue
+		}
+		if rule.isRewrite() {
+			i.serveRewrite(w, r, root, to, rule.status)
+		} else {
+			http.Redirect(w, r, to, rule.status)
+		}
+		return true
+	}
+	return false
+}
+
+// redirectRules returns the rules of the _redirects file at the root of the
+// website, if any.
+func (i *gatewayHandler) redirectRules(ctx context.Context, root string) ([]redirectRule, error) {
+	nd, err := i.api.Unixfs().Get(ctx, ipath.New(root+"/"+redirectsFile))
+	if err != nil {
+		if _, ok := err.(resolver.ErrNoLink); !ok {
+			log.Debugf("failed to get the %s file of %s: %s", redirectsFile, root, err)
+		}
+		return nil, nil
+	}
+	defer nd.Close()
+
+	f, ok := nd.(files.File)
+	if !ok {
+		return nil, nil
+	}
+	return parseRedirects(f)
+}
+
+// serveRewrite serves the file at the given path of the website, or its
+// index.html if it's a directory, with the status of the rule.
+func (i *gatewayHandler) serveRewrite(w http.ResponseWriter, r *http.Request, root, to string, status int) {
+	if idx := strings.IndexAny(to, "?#"); idx >= 0 {
+		to = to[:idx]
+	}
+	// cleaning the path keeps it inside of the website
+	p := ipath.New(root + gopath.Clean("/"+to))
+
+	resolvedPath, _, err := i.resolvePath(r.Context(), p)
+	if err != nil && err != denylist.ErrBlocked {
+		webError(w, "ipfs resolve -r "+p.String(), err, http.StatusNotFound)
+		return
+	}
+	if err == denylist.ErrBlocked || i.isDenied(resolvedPath) {
+		webError(w, "ipfs resolve -r "+p.String(), denylist.ErrBlocked, http.StatusGone)
+		return
+	}
+	nd, err := i.api.Unixfs().Get(r.Context(), resolvedPath)
+	if err != nil {
+		webError(w, "ipfs cat "+p.String(), err, http.StatusNotFound)
+		return
+	}
+	defer nd.Close()
+
+	name := gopath.Base(p.String())
+	if _, ok := nd.(files.Directory); ok {
+		resolvedPath, err = i.api.ResolvePath(r.Context(), ipath.Join(resolvedPath, "index.html"))
+		if err != nil {
+			webError(w, "ipfs resolve -r "+p.String()+"/index.html", err, http.StatusNotFound)
+			return
+		}
+		if nd, err = i.api.Unixfs().Get(r.Context(), resolvedPath); err != nil {
+			webError(w, "ipfs cat "+p.String()+"/index.html", err, http.StatusNotFound)
+			return
+		}
+		defer nd.Close()
+		name = "index.html"
+	}
+	f, ok := nd.(files.File)
+	if !ok {
+		internalWebError(w, files.ErrNotReader)
+		return
+	}
+
+	i.addUserHeaders(w)
+	w.Header().Set("X-IPFS-Path", p.String())
+
+	modtime := time.Now()
+	if status == http.StatusOK {
+		etag := "\"" + resolvedPath.Cid().String() + "\""
+		if r.Header.Get("If-None-Match") == etag || r.Header.Get("If-None-Match") == "W/"+etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Etag", etag)
+		if strings.HasPrefix(root, ipfsPathPrefix) {
+			w.Header().Set("Cache-Control", "public, max-age=29030400, immutable")
+			modtime = time.Unix(1, 0)
+		}
+	} else {
+		// error pages are served whole, whatever the request asked for
+		r = r.Clone(r.Context())
+		for _, h := range []string{"Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "If-Range"} {
+			r.Header.Del(h)
+		}
+	}
+	i.serveFile(&rewriteStatusWriter{w, status}, r, name, modtime, f)
+}
+
+// rewriteStatusWriter replaces the 200 status written by http.ServeContent
+// with the status of the rule serving the file.
+type rewriteStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *rewriteStatusWriter) WriteHeader(code int) {
+	if code == http.StatusOK {
+		code = sw.status
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,151 @@
+package corehttp
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	files "github.com/ipfs/go-ipfs-files"
+	path "github.com/ipfs/go-path"
+)
+
+func TestParseRedirects(t *testing.T) {
+	rules, err := parseRedirects(strings.NewReader(`
+# comments and blank lines are ignored
+
+/old          /new
+/temp         /new                     302
+/blog/:year/:month/:id  /posts/:year-:month/:id
+/docs/*       https://docs.example.com/:splat  301!
+/*            /index.html              200
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 5 {
+		t.Fatalf("expected 5 rules, got %d", len(rules))
+	}
+
+	for _, test := range []struct {
+		rule   int
+		path   string
+		to     string
+		status int
+	}{
+		{0, "/old", "/new", 301},
+		{0, "/old/", "/new", 301},
+		{0, "/old/more", "", 0},
+		{1, "/temp", "/new", 302},
+		{2, "/blog/2020/06/hello", "/posts/2020-06/hello", 301},
+		{2, "/blog/2020/06", "", 0},
+		{3, "/docs", "https://docs.example.com/", 301},
+		{3, "/docs/a/b", "https://docs.example.com/a/b", 301},
+		{4, "/", "/index.html", 200},
+		{4, "/any/path", "/index.html", 200},
+	} {
+		rule := rules[test.rule]
+		to, ok := rule.match(test.path)
+		if ok != (test.to != "") {
+			t.Errorf("rule %d: unexpected match of %s: %t", test.rule, test.path, ok)
+			continue
+		}
+		if ok && (to != test.to || rule.status != test.status) {
+			t.Errorf("rule %d: expected %s to go to %s (%d), got %s (%d)", test.rule, test.path, test.to, test.status, to, rule.status)
+		}
+	}
+}
+
+func TestParseRedirectsErrors(t *testing.T) {
+	for _, content := range []string{
+		"/only-from",
+		"relative /to",
+		"/a /b 200 extra",
+		"/a /b 500",
+		"/a /b three",
+		"/a/*/b /c",
+		"/a* /c",
+		"/a ftp://example.com",
+		"/a https://example.com 200",
+		strings.Repeat("/a /b\n", maxRedirectsFileSize),
+	} {
+		if _, err := parseRedirects(strings.NewReader(content)); err == nil {
+			t.Errorf("expected %q to be rejected", content)
+		}
+	}
+}
+
+func TestGatewayRedirects(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+	defer ts.Close()
+
+	site, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"_redirects": files.NewBytesFile([]byte(`
+/redirect-one       /one.html
+/redirect-found     /one.html  302
+/external/*         https://example.net/:splat
+/posts/:id          /articles/:id  301
+/app/*              /app/index.html  200
+/not-found/*        /missing.html  404
+/*                  /404.html  404
+`)),
+		"one.html": files.NewBytesFile([]byte("one")),
+		"404.html": files.NewBytesFile([]byte("custom not found")),
+		"app": files.NewMapDirectory(map[string]files.Node{
+			"index.html": files.NewBytesFile([]byte("spa")),
+		}),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/example.com"] = path.FromString(site.String())
+
+	for _, test := range []struct {
+		path     string
+		status   int
+		location string
+		body     string
+	}{
+		{"/one.html", http.StatusOK, "", "one"},
+		{"/redirect-one", http.StatusMovedPermanently, "/one.html", ""},
+		{"/redirect-found", http.StatusFound, "/one.html", ""},
+		{"/external/a/b", http.StatusMovedPermanently, "https://example.net/a/b", ""},
+		{"/posts/42", http.StatusMovedPermanently, "/articles/42", ""},
+		{"/app/some/route", http.StatusOK, "", "spa"},
+		{"/app", http.StatusFound, "/app/", ""},
+		{"/app/", http.StatusOK, "", "spa"},
+		{"/not-found/x", http.StatusNotFound, "", "no link named \"missing.html\""},
+		{"/anything/else", http.StatusNotFound, "", "custom not found"},
+	} {
+		res, body := doRequest(t, http.MethodGet, ts.URL+test.path, nil, http.Header{"Host": {"example.com"}})
+		if res.StatusCode != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.path, test.status, res.StatusCode)
+		}
+		if loc := res.Header.Get("Location"); loc != test.location {
+			t.Errorf("%s: expected location %q, got %q", test.path, test.location, loc)
+		}
+		if test.body != "" && !strings.Contains(string(body), test.body) {
+			t.Errorf("%s: unexpected body %q", test.path, body)
+		}
+	}
+
+	// the rules don't apply on path gateways, where the website isn't at the
+	// root of the origin
+	res, _ := doRequest(t, http.MethodGet, ts.URL+"/ipfs/"+site.Cid().String()+"/redirect-one", nil, http.Header{"Host": {"localhost"}})
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the rules to be ignored on path gateways, got %d", res.StatusCode)
+	}
+
+	// invalid rules are reported
+	broken, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"_redirects": files.NewBytesFile([]byte("/a /b 999")),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/broken.example.com"] = path.FromString(broken.String())
+	res, body := doRequest(t, http.MethodGet, ts.URL+"/a", nil, http.Header{"Host": {"broken.example.com"}})
+	if res.StatusCode != http.StatusInternalServerError || !strings.Contains(string(body), "line 1") {
+		t.Errorf("expected invalid rules to be reported, got %d: %s", res.StatusCode, body)
+	}
+}
@@ -1,11 +1,15 @@
 package corehttp
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -13,6 +17,7 @@ import (
 	version "github.com/ipfs/go-ipfs"
 	core "github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/denylist"
 	namesys "github.com/ipfs/go-ipfs/namesys"
 	repo "github.com/ipfs/go-ipfs/repo"
 
@@ -24,6 +29,7 @@ import (
 	iface "github.com/ipfs/interface-go-ipfs-core"
 	nsopts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
 	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	gocar "github.com/ipld/go-car"
 	ci "github.com/libp2p/go-libp2p-core/crypto"
 	id "github.com/libp2p/go-libp2p/p2p/protocol/identify"
 )
@@ -154,6 +160,39 @@ func newTestServerAndNode(t *testing.T, ns mockNamesys) (*httptest.Server, iface
 	return ts, api, n.Context()
 }
 
+// doRequest sends a request to a test server and returns the response along
+// with its body. The request gets the non-empty values of header, Host setting
+// its host, and redirects aren't followed.
+func doRequest(t *testing.T, method, url string, body io.Reader, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range header {
+		if v := header.Get(k); v != "" {
+			req.Header.Set(k, v)
+		}
+	}
+	req.Host = header.Get("Host")
+
+	c := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, data
+}
+
 func TestGatewayGet(t *testing.T) {
 	ns := mockNamesys{}
 	ts, api, ctx := newTestServerAndNode(t, ns)
@@ -616,3 +655,187 @@ func TestVersion(t *testing.T) {
 		t.Fatalf("response doesn't contain protocol version:\n%s", s)
 	}
 }
+
+func TestGatewayRawAndCar(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+	defer ts.Close()
+
+	dir, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"a": files.NewBytesFile([]byte("aaa")),
+		"b": files.NewBytesFile([]byte("bbb")),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := api.ResolvePath(ctx, ipath.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// raw blocks, selected with the query or the Accept header
+	rd, err := api.Block().Get(ctx, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ioutil.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []struct{ path, accept string }{
+		{dir.String() + "/a?format=raw", ""},
+		{dir.String() + "/a", "text/html;q=0.5, application/vnd.ipld.raw;q=0.9"},
+		{dir.String() + "/a", "text/html, application/vnd.ipld.raw"},
+	} {
+		res, body := doRequest(t, http.MethodGet, ts.URL+q.path, nil, http.Header{"Accept": {q.accept}})
+		if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != rawContentType {
+			t.Fatalf("unexpected raw response: %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+		}
+		if string(body) != string(block) {
+			t.Fatal("the raw response should be the block")
+		}
+		if res.Header.Get("Etag") != "\""+file.Cid().String()+".raw\"" {
+			t.Fatalf("unexpected etag %s", res.Header.Get("Etag"))
+		}
+	}
+
+	// unless a deserialized response is preferred
+	for _, accept := range []string{
+		"text/html, application/vnd.ipld.raw;q=0.9",
+		"application/vnd.ipld.raw;q=0, */*",
+	} {
+		res, _ := doRequest(t, http.MethodGet, ts.URL+dir.String()+"/a", nil, http.Header{"Accept": {accept}})
+		if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") == rawContentType {
+			t.Fatalf("expected a deserialized response for %q, got %d %s", accept, res.StatusCode, res.Header.Get("Content-Type"))
+		}
+	}
+
+	res, _ := doRequest(t, http.MethodHead, ts.URL+dir.String()+"?format=car", nil, nil)
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != carContentType+"; version=1" {
+		t.Fatalf("unexpected HEAD response: %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	// a CAR of the whole DAG, whose blocks match their CIDs
+	_, body := doRequest(t, http.MethodGet, ts.URL+dir.String(), nil, http.Header{"Accept": {carContentType}})
+	car, err := gocar.NewCarReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(car.Header.Roots) != 1 || !car.Header.Roots[0].Equals(dir.Cid()) {
+		t.Fatalf("unexpected roots: %v", car.Header.Roots)
+	}
+	count := 0
+	for {
+		blk, err := car.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := blk.Cid().Prefix().Sum(blk.RawData())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !c.Equals(blk.Cid()) {
+			t.Fatalf("block %s doesn't match its CID", blk.Cid())
+		}
+		count++
+	}
+	if count != 3 {
+		t.Fatalf("expected the 3 blocks of the DAG, got %d", count)
+	}
+
+	res, _ = doRequest(t, http.MethodGet, ts.URL+dir.String()+"?format=tar", nil, nil)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected unsupported formats to be rejected, got %d", res.StatusCode)
+	}
+
+	// incomplete DAGs abort the response
+	if err := api.Block().Rm(ctx, file); err != nil {
+		t.Fatal(err)
+	}
+	res, err = http.Get(ts.URL + dir.String() + "?format=car")
+	if err == nil {
+		defer res.Body.Close()
+		_, err = ioutil.ReadAll(res.Body)
+	}
+	if err == nil {
+		t.Fatal("expected the CAR response to be aborted")
+	}
+}
+
+func TestGatewayDenylist(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+	defer ts.Close()
+
+	dir, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"public":  files.NewBytesFile([]byte("public")),
+		"private": files.NewBytesFile([]byte("private")),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocked, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("blocked")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/example.com"] = path.FromString(dir.String())
+	ns["/ipns/blocked.example.net"] = path.FromString(dir.String())
+	ns["/ipns/indirect.example.net"] = path.FromString(blocked.String())
+
+	list, err := ioutil.TempFile("", "denylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(list.Name())
+	fmt.Fprintf(list, "%s\n%s/private\n/ipns/blocked.example.net\n", blocked.Cid(), dir.Cid())
+	list.Close()
+
+	d, err := denylist.New(list.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := httptest.NewServer(newGatewayHandler(GatewayConfig{Denylist: d}, api))
+	defer gw.Close()
+	// resolves /ipns/ paths with its own name system, like the daemon
+	nsGw := httptest.NewServer(newGatewayHandler(GatewayConfig{Denylist: d, Namesys: ns}, api))
+	defer nsGw.Close()
+
+	for p, status := range map[string]int{
+		dir.String() + "/public":             http.StatusOK,
+		dir.String() + "/private":            http.StatusGone,
+		blocked.String():                     http.StatusGone,
+		"/ipns/example.com/public":           http.StatusOK,
+		"/ipns/example.com/private":          http.StatusGone,
+		"/ipns/example.com/private/missing":  http.StatusGone,
+		"/ipns/blocked.example.net":          http.StatusGone,
+		"/ipns/indirect.example.net":         http.StatusGone,
+		blocked.String() + "?format=raw":     http.StatusGone,
+		"/ipns/blocked.example.net?x=y":      http.StatusGone,
+		dir.String() + "/private?format=car": http.StatusGone,
+	} {
+		for _, url := range []string{gw.URL, nsGw.URL} {
+			res, body := doRequest(t, http.MethodGet, url+p, nil, nil)
+			if res.StatusCode != status {
+				t.Errorf("%s: expected status %d, got %d: %s", p, status, res.StatusCode, body)
+			}
+			if status == http.StatusGone && !strings.Contains(string(body), denylist.ErrBlocked.Error()) {
+				t.Errorf("%s: unexpected body %q", p, body)
+			}
+		}
+	}
+
+	// CARs of the DAGs with blocked content are aborted
+	for _, p := range []string{dir.String(), "/ipns/example.com"} {
+		res, err := http.Get(gw.URL + p + "?format=car")
+		if err == nil {
+			_, err = ioutil.ReadAll(res.Body)
+			res.Body.Close()
+		}
+		if err == nil {
+			t.Errorf("%s: expected the CAR response to be aborted", p)
+		}
+	}
+}
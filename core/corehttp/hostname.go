@@ -283,7 +283,7 @@ func toSubdomainURL(hostname, path string, r *http.Request) (redirURL string, ok
 	// Support X-Forwarded-Proto if added by a reverse proxy
 	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/X-Forwarded-Proto
 	xproto := r.Header.Get("X-Forwarded-Proto")
-	if xproto == "https" {
+	if xproto == "https" || r.TLS != nil {
 		scheme = "https:"
 	} else {
 		scheme = "http:"
@@ -34,6 +34,12 @@ func TestToSubdomainURL(t *testing.T) {
 			t.Errorf("(%s, %s) returned (%s, %t), expected (%s, %t)", test.hostname, test.path, url, ok, test.url, ok)
 		}
 	}
+
+	// HTTPS requests are redirected to HTTPS
+	r = httptest.NewRequest("GET", "https://request-stub.example.com", nil)
+	if url, _ := toSubdomainURL("localhost", "/ipns/dnslink.io", r); url != "https://dnslink.io.ipns.localhost/" {
+		t.Errorf("expected an HTTPS redirect, got %s", url)
+	}
 }
 
 func TestHasPrefix(t *testing.T) {
@@ -0,0 +1,324 @@
+package corehttp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/repo"
+
+	lru "github.com/hashicorp/golang-lru"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	prometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+// GatewayLimitsConfigKey is the config section configuring the admission
+// control of the gateway.
+const GatewayLimitsConfigKey = "GatewayLimits"
+
+// maximum number of clients whose request rates are tracked, the least
+// recent ones being forgotten
+const maxTrackedClients = 1 << 16
+
+// GatewayLimitsConfig configures the admission control of the gateway. The
+// zero values disable the limits.
+type GatewayLimitsConfig struct {
+	// ClientRate is the number of requests per second allowed from each
+	// IP address, in bursts of up to ClientBurst requests.
+	ClientRate  float64
+	ClientBurst int
+	// GlobalRate is the number of requests per second allowed from all the
+	// clients, in bursts of up to GlobalBurst requests.
+	GlobalRate  float64
+	GlobalBurst int
+	// MaxFetches is the number of requests served at the same time for
+	// content not in the local blockstore.
+	MaxFetches int
+	// MaxTimeToFirstByte is how long the requests for content not in the
+	// local blockstore can take before starting their response, like "30s".
+	MaxTimeToFirstByte string
+}
+
+// LoadGatewayLimitsConfig reads the GatewayLimits section of the config of
+// the given repo. Requests aren't limited if the section is missing.
+func LoadGatewayLimitsConfig(r repo.Repo) (GatewayLimitsConfig, error) {
+	var cfg GatewayLimitsConfig
+
+	if err := repo.LoadConfigSection(r, GatewayLimitsConfigKey, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+var (
+	rejectedRequestsMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ipfs",
+		Subsystem: "http",
+		Name:      "gateway_rejected_requests_total",
+		Help:      "Number of gateway requests rejected by the admission control, by reason.",
+	}, []string{"reason"})
+
+	fetchesMetric = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ipfs",
+		Subsystem: "http",
+		Name:      "gateway_fetches",
+		Help:      "Number of gateway requests being served for content not in the local blockstore.",
+	})
+)
+
+// reasons of the rejected requests
+const (
+	rejectedClientRate  = "client_rate"
+	rejectedGlobalRate  = "global_rate"
+	rejectedMaxFetches  = "max_fetches"
+	rejectedTimeToFirst = "time_to_first_byte"
+)
+
+// limits is the admission control state shared by the listeners.
+type limits struct {
+	clientRate  float64
+	clientBurst int
+	clients     *lru.Cache // client IP -> *rateLimiter
+
+	global *rateLimiter
+
+	fetches chan struct{}
+	ttfb    time.Duration
+}
+
+func newLimits(cfg GatewayLimitsConfig) (*limits, error) {
+	l := new(limits)
+	if cfg.ClientRate < 0 || cfg.GlobalRate < 0 || cfg.MaxFetches < 0 {
+		return nil, fmt.Errorf("invalid %s config: negative limit", GatewayLimitsConfigKey)
+	}
+	if cfg.ClientRate > 0 {
+		l.clientRate = cfg.ClientRate
+		l.clientBurst = burst(cfg.ClientRate, cfg.ClientBurst)
+		l.clients, _ = lru.New(maxTrackedClients)
+	}
+	if cfg.GlobalRate > 0 {
+		l.global = newRateLimiter(cfg.GlobalRate, burst(cfg.GlobalRate, cfg.GlobalBurst))
+	}
+	if cfg.MaxFetches > 0 {
+		l.fetches = make(chan struct{}, cfg.MaxFetches)
+	}
+	if cfg.MaxTimeToFirstByte != "" {
+		d, err := time.ParseDuration(cfg.MaxTimeToFirstByte)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid %s config: MaxTimeToFirstByte %q", GatewayLimitsConfigKey, cfg.MaxTimeToFirstByte)
+		}
+		l.ttfb = d
+	}
+	return l, nil
+}
+
+// burst defaults to the requests of a second.
+func burst(rate float64, burst int) int {
+	if burst > 0 {
+		return burst
+	}
+	return int(math.Max(1, math.Ceil(rate)))
+}
+
+// clientLimiter returns the rate limiter of the client of the request.
+func (l *limits) clientLimiter(r *http.Request) *rateLimiter {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	// the cache is only used to forget the least recent clients: a client
+	// getting two limiters when racing with itself is fine
+	if v, ok := l.clients.Get(ip); ok {
+		return v.(*rateLimiter)
+	}
+	rl := newRateLimiter(l.clientRate, l.clientBurst)
+	l.clients.Add(ip, rl)
+	return rl
+}
+
+// GatewayLimitsOption limits the rate of the requests, per client IP and
+// overall, answering the requests over the limits with a 429 error. Requests
+// for content not in the local blockstore, which needs to be fetched, are
+// also limited in number, and in the time they can take before starting their
+// response, after which they're answered with a 504 error.
+//
+// The option should follow HostnameOption, to see the paths of the requests
+// to subdomain and DNSLink gateways.
+func GatewayLimitsOption(cfg GatewayLimitsConfig) ServeOption {
+	l, err := newLimits(cfg)
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		if err != nil {
+			return nil, err
+		}
+		// resolves the paths of the requests from the local blocks only
+		localAPI, err := coreapi.NewCoreAPI(n, options.Api.FetchBlocks(false))
+		if err != nil {
+			return nil, err
+		}
+
+		childMux := http.NewServeMux()
+		mux.Handle("/", &limitsHandler{limits: l, node: n, localAPI: localAPI, next: childMux})
+		return childMux, nil
+	}
+}
+
+type limitsHandler struct {
+	*limits
+	node     *core.IpfsNode
+	localAPI coreiface.CoreAPI
+	next     http.Handler
+}
+
+func (h *limitsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	// clients over their limit don't consume the global rate
+	if h.clients != nil {
+		if ok, wait := h.clientLimiter(r).allow(now); !ok {
+			tooManyRequests(w, rejectedClientRate, wait)
+			return
+		}
+	}
+	if h.global != nil {
+		if ok, wait := h.global.allow(now); !ok {
+			tooManyRequests(w, rejectedGlobalRate, wait)
+			return
+		}
+	}
+
+	if (h.fetches == nil && h.ttfb == 0) || h.isLocal(r) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	if h.fetches != nil {
+		select {
+		case h.fetches <- struct{}{}:
+			defer func() { <-h.fetches }()
+		default:
+			tooManyRequests(w, rejectedMaxFetches, time.Second)
+			return
+		}
+	}
+	fetchesMetric.Inc()
+	defer fetchesMetric.Dec()
+
+	if h.ttfb == 0 {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	serveWithTimeToFirstByte(w, r, h.next, h.ttfb)
+}
+
+// isLocal returns whether the request is for an /ipfs/ path that resolves
+// from the blocks of the local blockstore, to a block in it. Other requests
+// may need fetching content. The blocks under the resolved one aren't checked,
+// for the cost of walking large files on every request.
+func (h *limitsHandler) isLocal(r *http.Request) bool {
+	p := ipath.New(r.URL.Path)
+	if p.Namespace() != "ipfs" || p.IsValid() != nil {
+		return false
+	}
+	rp, err := h.localAPI.ResolvePath(r.Context(), p)
+	if err != nil {
+		return false
+	}
+	has, err := h.node.Blockstore.Has(rp.Cid())
+	return err == nil && has
+}
+
+func tooManyRequests(w http.ResponseWriter, reason string, wait time.Duration) {
+	rejectedRequestsMetric.WithLabelValues(reason).Inc()
+	w.Header().Set("Retry-After", retryAfter(wait))
+	http.Error(w, "too many requests", http.StatusTooManyRequests)
+}
+
+// serveWithTimeToFirstByte serves the request, answering it with a 504 error
+// if the handler doesn't start its response within ttfb. The request is then
+// canceled, and the rest of the response discarded.
+func serveWithTimeToFirstByte(w http.ResponseWriter, r *http.Request, h http.Handler, ttfb time.Duration) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	tw := &ttfbWriter{w: w, h: w.Header().Clone()}
+	timer := time.AfterFunc(ttfb, func() {
+		tw.lk.Lock()
+		defer tw.lk.Unlock()
+		if tw.started || tw.done {
+			return
+		}
+		tw.timedOut = true
+		cancel()
+		rejectedRequestsMetric.WithLabelValues(rejectedTimeToFirst).Inc()
+		http.Error(w, fmt.Sprintf("no response within %s", ttfb), http.StatusGatewayTimeout)
+	})
+	defer timer.Stop()
+
+	h.ServeHTTP(tw, r.WithContext(ctx))
+
+	// the timer can't write the response after the handler returns
+	tw.lk.Lock()
+	tw.done = true
+	tw.lk.Unlock()
+}
+
+// ttfbWriter is the ResponseWriter of serveWithTimeToFirstByte, tracking
+// whether the response was started. The handler has its own headers until
+// then, since the timeout may write the response concurrently.
+type ttfbWriter struct {
+	w http.ResponseWriter
+	h http.Header
+
+	lk       sync.Mutex
+	started  bool
+	timedOut bool
+	done     bool
+}
+
+func (tw *ttfbWriter) Header() http.Header {
+	return tw.h
+}
+
+// start marks the response started, with the headers of the handler, unless
+// it timed out.
+func (tw *ttfbWriter) start() bool {
+	tw.lk.Lock()
+	defer tw.lk.Unlock()
+	if tw.timedOut {
+		return false
+	}
+	if !tw.started {
+		tw.started = true
+		dst := tw.w.Header()
+		for k, v := range tw.h {
+			dst[k] = v
+		}
+	}
+	return true
+}
+
+func (tw *ttfbWriter) WriteHeader(code int) {
+	if tw.start() {
+		tw.w.WriteHeader(code)
+	}
+}
+
+func (tw *ttfbWriter) Write(b []byte) (int, error) {
+	if !tw.start() {
+		return 0, http.ErrHandlerTimeout
+	}
+	return tw.w.Write(b)
+}
+
+func (tw *ttfbWriter) Flush() {
+	if f, ok := tw.w.(http.Flusher); ok && tw.start() {
+		f.Flush()
+	}
+}
@@ -0,0 +1,180 @@
+package corehttp
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	ipld "github.com/ipfs/go-ipld-format"
+	ft "github.com/ipfs/go-unixfs"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(2, 3)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow(now); !ok {
+			t.Fatalf("request %d should be allowed in the burst", i)
+		}
+	}
+	if ok, wait := l.allow(now); ok || wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms, got %t %s", ok, wait)
+	}
+	if ok, _ := l.allow(now.Add(500 * time.Millisecond)); !ok {
+		t.Fatal("the request should be allowed after the wait")
+	}
+	if ok, _ := l.allow(now.Add(time.Hour)); !ok {
+		t.Fatal("the request should be allowed after a while")
+	}
+	for i := 0; i < 2; i++ {
+		l.allow(now.Add(time.Hour))
+	}
+	if ok, _ := l.allow(now.Add(time.Hour)); ok {
+		t.Fatal("the tokens shouldn't accumulate over the burst")
+	}
+}
+
+func TestGatewayLimits(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := api.Unixfs().Add(n.Context(), files.NewBytesFile([]byte("local")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// not in the blockstore
+	remote := "/ipfs/QmWATWQ7fVPP2EFGu71UkfnqhYXDYH566qy47CnJDgvs8u"
+	stalled := "/ipfs/QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+	// a local directory linking to remote content
+	remoteCid, err := cid.Decode(remote[len("/ipfs/"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := ft.EmptyDirNode()
+	if err := dir.AddRawLink("remote", &ipld.Link{Cid: remoteCid}); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Dag().Add(n.Context(), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// the handler of the requests blocks for remote content until release
+	// is closed, and for stalled content until the request is canceled
+	release := make(chan struct{})
+	blocking := func(_ *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case remote:
+				<-release
+			case stalled:
+				<-r.Context().Done()
+				return
+			}
+			w.Write([]byte("ok"))
+		})
+		return mux, nil
+	}
+	newServer := func(cfg GatewayLimitsConfig) *httptest.Server {
+		t.Helper()
+		dh := &delegatedHandler{}
+		ts := httptest.NewServer(dh)
+		dh.Handler, err = makeHandler(n, ts.Listener, GatewayLimitsOption(cfg), blocking)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	t.Run("rates", func(t *testing.T) {
+		ts := newServer(GatewayLimitsConfig{ClientRate: 0.1, ClientBurst: 2})
+		defer ts.Close()
+		rejected := testutil.ToFloat64(rejectedRequestsMetric.WithLabelValues(rejectedClientRate))
+		for i, status := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+			res, _ := doRequest(t, http.MethodGet, ts.URL+local.String(), nil, nil)
+			if res.StatusCode != status {
+				t.Fatalf("(%d) expected %d, got %d", i, status, res.StatusCode)
+			}
+			if status == http.StatusTooManyRequests && res.Header.Get("Retry-After") != "10" {
+				t.Fatalf("expected to retry after 10s, got %q", res.Header.Get("Retry-After"))
+			}
+		}
+		if v := testutil.ToFloat64(rejectedRequestsMetric.WithLabelValues(rejectedClientRate)); v != rejected+1 {
+			t.Fatalf("expected a rejected request to be counted, got %f", v-rejected)
+		}
+
+		ts = newServer(GatewayLimitsConfig{GlobalRate: 0.1})
+		defer ts.Close()
+		for _, status := range []int{http.StatusOK, http.StatusTooManyRequests} {
+			if res, _ := doRequest(t, http.MethodGet, ts.URL+local.String(), nil, nil); res.StatusCode != status {
+				t.Fatal("expected the global rate to be limited")
+			}
+		}
+	})
+
+	t.Run("fetches", func(t *testing.T) {
+		ts := newServer(GatewayLimitsConfig{MaxFetches: 1})
+		defer ts.Close()
+
+		done := make(chan int)
+		go func() {
+			res, err := http.Get(ts.URL + remote)
+			if err != nil {
+				done <- 0
+				return
+			}
+			res.Body.Close()
+			done <- res.StatusCode
+		}()
+		for testutil.ToFloat64(fetchesMetric) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		if res, _ := doRequest(t, http.MethodGet, ts.URL+remote, nil, nil); res.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("expected the fetches to be limited, got %d", res.StatusCode)
+		}
+		// content in the blockstore isn't limited
+		if res, _ := doRequest(t, http.MethodGet, ts.URL+local.String(), nil, nil); res.StatusCode != http.StatusOK {
+			t.Fatalf("expected local content to be served, got %d", res.StatusCode)
+		}
+		if res, _ := doRequest(t, http.MethodGet, ts.URL+"/ipfs/"+dir.Cid().String(), nil, nil); res.StatusCode != http.StatusOK {
+			t.Fatalf("expected the local directory to be served, got %d", res.StatusCode)
+		}
+		// unlike remote content under local directories
+		if res, _ := doRequest(t, http.MethodGet, ts.URL+"/ipfs/"+dir.Cid().String()+"/remote", nil, nil); res.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("expected the fetches under local directories to be limited, got %d", res.StatusCode)
+		}
+
+		close(release)
+		if status := <-done; status != http.StatusOK {
+			t.Fatalf("expected the first fetch to succeed, got %d", status)
+		}
+	})
+
+	t.Run("time to first byte", func(t *testing.T) {
+		ts := newServer(GatewayLimitsConfig{MaxTimeToFirstByte: "50ms"})
+		defer ts.Close()
+
+		if res, _ := doRequest(t, http.MethodGet, ts.URL+stalled, nil, nil); res.StatusCode != http.StatusGatewayTimeout {
+			t.Fatalf("expected the fetch to time out, got %d", res.StatusCode)
+		}
+		if res, _ := doRequest(t, http.MethodGet, ts.URL+remote, nil, nil); res.StatusCode != http.StatusOK {
+			t.Fatalf("expected the fetch to succeed, got %d", res.StatusCode)
+		}
+	})
+
+	if _, err := newLimits(GatewayLimitsConfig{MaxTimeToFirstByte: "soon"}); err == nil {
+		t.Fatal("invalid durations should be rejected")
+	}
+}
@@ -3,6 +3,7 @@ package corehttp
 import (
 	"net"
 	"net/http"
+	"time"
 
 	core "github.com/ipfs/go-ipfs/core"
 
@@ -99,6 +100,14 @@ var (
 		prometheus.BuildFQName("ipfs", "p2p", "peers_total"),
 		"Number of connected peers", []string{"transport"}, nil)
 
+	ipnsRecordExpiryMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "ipns", "record_expiry_seconds"),
+		"Time until the IPNS records published by the node expire, by key.", []string{"key", "name"}, nil)
+
+	ipnsRecordsNearExpiryMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "ipns", "records_near_expiry"),
+		"Number of IPNS records the republisher should republish that expire within a republish period.", nil, nil)
+
 	unixfsGetMetric = prometheus.NewSummaryVec(prometheus.SummaryOpts{
 		Namespace: "ipfs",
 		Subsystem: "http",
@@ -113,6 +122,10 @@ type IpfsNodeCollector struct {
 
 func (_ IpfsNodeCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- peersTotalMetric
+	rejectedRequestsMetric.Describe(ch)
+	fetchesMetric.Describe(ch)
+	ch <- ipnsRecordExpiryMetric
+	ch <- ipnsRecordsNearExpiryMetric
 }
 
 func (c IpfsNodeCollector) Collect(ch chan<- prometheus.Metric) {
@@ -124,6 +137,37 @@ func (c IpfsNodeCollector) Collect(ch chan<- prometheus.Metric) {
 			tr,
 		)
 	}
+	rejectedRequestsMetric.Collect(ch)
+	fetchesMetric.Collect(ch)
+	c.collectIpnsRecords(ch)
+}
+
+// collectIpnsRecords reports the expiration of the records the republisher
+// knows about, if it runs.
+func (c IpfsNodeCollector) collectIpnsRecords(ch chan<- prometheus.Metric) {
+	rp := c.Node.IpnsRepub
+	if rp == nil {
+		return
+	}
+	st, err := rp.Status()
+	if err != nil {
+		log.Errorf("failed to collect the state of the IPNS republisher: %s", err)
+		return
+	}
+
+	var nearExpiry int
+	for _, k := range st.Keys {
+		if k.EOL.IsZero() {
+			continue
+		}
+		ttl := time.Until(k.EOL)
+		ch <- prometheus.MustNewConstMetric(ipnsRecordExpiryMetric, prometheus.GaugeValue, ttl.Seconds(), k.Key, k.Name)
+		// the records excluded from republishing are meant to expire
+		if !k.Excluded && ttl < rp.Interval {
+			nearExpiry++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(ipnsRecordsNearExpiryMetric, prometheus.GaugeValue, float64(nearExpiry))
 }
 
 func (c IpfsNodeCollector) PeersTotalValues() map[string]float64 {
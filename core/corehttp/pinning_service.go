@@ -0,0 +1,792 @@
+package corehttp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/pinmeta"
+	"github.com/ipfs/go-ipfs/pinsvc"
+	"github.com/ipfs/go-ipfs/repo"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// PinningServiceConfigKey is the config section configuring the pinning
+// service API.
+const PinningServiceConfigKey = "PinningService"
+
+// DefaultPinningServicePath is the path the pinning service API is served
+// under by default.
+const DefaultPinningServicePath = "/pinning"
+
+// maximum number of objects being pinned at the same time
+const pinningServiceWorkers = 4
+
+// maximum size of pin request bodies
+const maxPinRequestSize = 1 << 20
+
+// datastore namespace holding the pin requests
+var pinRequestsPrefix = ds.NewKey("/local/pinsvc/requests")
+
+// PinningServiceConfig configures the pinning service API.
+type PinningServiceConfig struct {
+	Enabled bool
+	// Path the API is served under, DefaultPinningServicePath if empty.
+	Path string
+	// AccessTokens lists the bearer tokens allowed to use the API.
+	AccessTokens []string
+}
+
+// LoadPinningServiceConfig reads the PinningService section of the config of
+// the given repo. The pinning service is disabled if the section is missing.
+func LoadPinningServiceConfig(r repo.Repo) (PinningServiceConfig, error) {
+	var cfg PinningServiceConfig
+
+	if err := repo.LoadConfigSection(r, PinningServiceConfigKey, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// PinningServiceOption serves the IPFS Pinning Service HTTP API, backed by the
+// node's pinner. Requests must be authenticated with one of the configured
+// bearer tokens.
+func PinningServiceOption(cfg PinningServiceConfig) ServeOption {
+	prefix := strings.TrimSuffix(cfg.Path, "/")
+	if prefix == "" {
+		prefix = DefaultPinningServicePath
+	}
+
+	// the service is shared by all the listeners
+	var (
+		once   sync.Once
+		svc    *pinningService
+		svcErr error
+	)
+
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		if len(cfg.AccessTokens) == 0 {
+			return nil, fmt.Errorf("the pinning service API requires at least one access token")
+		}
+
+		once.Do(func() {
+			svc, svcErr = newPinningService(n)
+		})
+		if svcErr != nil {
+			return nil, svcErr
+		}
+
+		h := &pinningServiceHandler{
+			svc:    svc,
+			prefix: prefix + "/pins",
+			tokens: cfg.AccessTokens,
+		}
+		mux.Handle(h.prefix, h)
+		mux.Handle(h.prefix+"/", h)
+		return mux, nil
+	}
+}
+
+// pinRecord is the persisted state of a pin request.
+type pinRecord struct {
+	pinsvc.PinStatus
+
+	// Existing is set when the object was already pinned when the request
+	// was processed, in which case it is left pinned when the request is
+	// removed.
+	Existing bool `json:",omitempty"`
+
+	// Replaced holds the object pinned by the request this one replaced,
+	// to be unpinned once this one is processed.
+	Replaced         string `json:",omitempty"`
+	ReplacedExisting bool   `json:",omitempty"`
+}
+
+// errPinRequestNotFound is returned when a pin request doesn't exist.
+var errPinRequestNotFound = errors.New("pin request not found")
+
+type pinningService struct {
+	node *core.IpfsNode
+	api  coreiface.CoreAPI
+	ctx  context.Context
+
+	// lk serializes changes to the pin requests
+	lk   sync.Mutex
+	jobs map[string]context.CancelFunc
+
+	workers chan struct{}
+}
+
+func newPinningService(n *core.IpfsNode) (*pinningService, error) {
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &pinningService{
+		node:    n,
+		api:     api,
+		ctx:     n.Context(),
+		jobs:    make(map[string]context.CancelFunc),
+		workers: make(chan struct{}, pinningServiceWorkers),
+	}
+
+	// resume the requests that were not processed before the node stopped
+	records, err := s.records()
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		if rec.Status == pinsvc.StatusQueued || rec.Status == pinsvc.StatusPinning {
+			s.lk.Lock()
+			s.start(rec)
+			s.lk.Unlock()
+		}
+	}
+
+	return s, nil
+}
+
+func pinRequestKey(id string) ds.Key {
+	return pinRequestsPrefix.ChildString(id)
+}
+
+func newPinRequestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (s *pinningService) load(id string) (*pinRecord, error) {
+	data, err := s.node.Repo.Datastore().Get(pinRequestKey(id))
+	if err == ds.ErrNotFound {
+		return nil, errPinRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rec := new(pinRecord)
+	if err := json.Unmarshal(data, rec); err != nil {
+		return nil, fmt.Errorf("invalid pin request %s: %s", id, err)
+	}
+	return rec, nil
+}
+
+func (s *pinningService) store(rec *pinRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.node.Repo.Datastore().Put(pinRequestKey(rec.RequestID), data)
+}
+
+// records returns all the pin requests.
+func (s *pinningService) records() ([]*pinRecord, error) {
+	res, err := s.node.Repo.Datastore().Query(dsq.Query{Prefix: pinRequestsPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var out []*pinRecord
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+		rec := new(pinRecord)
+		if err := json.Unmarshal(e.Value, rec); err != nil {
+			log.Errorf("ignoring invalid pin request %s: %s", e.Key, err)
+			continue
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+// update applies fn to a pin request and persists it.
+func (s *pinningService) update(id string, fn func(*pinRecord)) (*pinRecord, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	rec, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	fn(rec)
+	return rec, s.store(rec)
+}
+
+// add creates a new pin request, replacing the given one if not empty.
+func (s *pinningService) add(p pinsvc.Pin, replace string) (*pinRecord, error) {
+	id, err := newPinRequestID()
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &pinRecord{
+		PinStatus: pinsvc.PinStatus{
+			RequestID: id,
+			Status:    pinsvc.StatusQueued,
+			Created:   time.Now().UTC(),
+			Pin:       p,
+		},
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if replace != "" {
+		old, err := s.load(replace)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.node.Repo.Datastore().Delete(pinRequestKey(replace)); err != nil {
+			return nil, err
+		}
+		if cancel, ok := s.jobs[replace]; ok {
+			cancel()
+		}
+		// if the old request was not pinned yet, its job unpins whatever
+		// it pinned when noticing the request is gone
+		if old.Status == pinsvc.StatusPinned {
+			rec.Replaced = old.Pin.Cid
+			rec.ReplacedExisting = old.Existing
+		}
+	}
+
+	if err := s.store(rec); err != nil {
+		return nil, err
+	}
+	s.start(rec)
+	return rec, nil
+}
+
+// remove deletes a pin request, unpinning its object if no other request
+// needs it.
+func (s *pinningService) remove(id string) error {
+	s.lk.Lock()
+	rec, err := s.load(id)
+	if err == nil {
+		err = s.node.Repo.Datastore().Delete(pinRequestKey(id))
+	}
+	if cancel, ok := s.jobs[id]; ok {
+		cancel()
+	}
+	s.lk.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if rec.Status == pinsvc.StatusPinned && !rec.Existing {
+		return s.unpinIfUnused(rec.Pin.Cid)
+	}
+	return nil
+}
+
+// unpinIfUnused unpins an object unless a pin request still needs it.
+func (s *pinningService) unpinIfUnused(c string) error {
+	records, err := s.records()
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if rec.Pin.Cid == c && rec.Status != pinsvc.StatusFailed {
+			return nil
+		}
+	}
+
+	k, err := cid.Decode(c)
+	if err != nil {
+		return err
+	}
+
+	_, pinned, err := s.node.Pinning.IsPinnedWithType(s.ctx, k, pin.Recursive)
+	if err != nil || !pinned {
+		return err
+	}
+	if err := s.api.Pin().Rm(s.ctx, path.IpfsPath(k)); err != nil {
+		return err
+	}
+	return s.node.PinMeta.Delete(k)
+}
+
+// start processes a pin request in the background. It must be called with
+// the lock held.
+func (s *pinningService) start(rec *pinRecord) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.jobs[rec.RequestID] = cancel
+
+	go func() {
+		defer func() {
+			s.lk.Lock()
+			delete(s.jobs, rec.RequestID)
+			s.lk.Unlock()
+			cancel()
+		}()
+
+		select {
+		case s.workers <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		defer func() { <-s.workers }()
+
+		s.process(ctx, rec)
+	}()
+}
+
+func (s *pinningService) process(ctx context.Context, rec *pinRecord) {
+	id := rec.RequestID
+	c, err := cid.Decode(rec.Pin.Cid)
+	if err != nil {
+		s.fail(id, err)
+		return
+	}
+
+	if rec.Status == pinsvc.StatusQueued {
+		_, existing, err := s.node.Pinning.IsPinnedWithType(ctx, c, pin.Recursive)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.fail(id, err)
+			}
+			return
+		}
+		rec, err = s.update(id, func(r *pinRecord) {
+			r.Status = pinsvc.StatusPinning
+			r.Existing = existing
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	s.connectOrigins(ctx, rec.Pin.Origins)
+
+	err = s.api.Pin().Add(ctx, path.IpfsPath(c))
+	if err == nil {
+		err = s.setPinMeta(c, rec.Pin)
+	}
+	if err != nil && ctx.Err() != nil {
+		// the request was removed, or the node is stopping and the request
+		// will be resumed next time
+		return
+	}
+
+	var done *pinRecord
+	if err != nil {
+		done, err = s.update(id, func(r *pinRecord) {
+			r.Status = pinsvc.StatusFailed
+			r.Info = map[string]string{"error": err.Error()}
+		})
+	} else {
+		done, err = s.update(id, func(r *pinRecord) {
+			r.Status = pinsvc.StatusPinned
+		})
+	}
+	switch err {
+	case nil:
+	case errPinRequestNotFound:
+		// the request was removed while being processed
+		if !rec.Existing {
+			if err := s.unpinIfUnused(rec.Pin.Cid); err != nil {
+				log.Errorf("pinning service: failed to unpin %s: %s", rec.Pin.Cid, err)
+			}
+		}
+		return
+	default:
+		log.Errorf("pinning service: failed to update pin request %s: %s", id, err)
+		return
+	}
+
+	if done.Replaced != "" && !done.ReplacedExisting {
+		if err := s.unpinIfUnused(done.Replaced); err != nil {
+			log.Errorf("pinning service: failed to unpin %s: %s", done.Replaced, err)
+		}
+	}
+}
+
+func (s *pinningService) fail(id string, err error) {
+	_, uerr := s.update(id, func(r *pinRecord) {
+		r.Status = pinsvc.StatusFailed
+		r.Info = map[string]string{"error": err.Error()}
+	})
+	if uerr != nil && uerr != errPinRequestNotFound {
+		log.Errorf("pinning service: failed to update pin request %s: %s", id, uerr)
+	}
+}
+
+// setPinMeta names the pin after the request, unless it already has a name.
+func (s *pinningService) setPinMeta(c cid.Cid, p pinsvc.Pin) error {
+	meta := pinmeta.Meta{Name: p.Name, Labels: p.Meta}
+	if meta.IsEmpty() {
+		return nil
+	}
+
+	existing, err := s.node.PinMeta.Get(c)
+	if err != nil || !existing.IsEmpty() {
+		return err
+	}
+	return s.node.PinMeta.Put(c, meta)
+}
+
+// connectOrigins tries to connect to the peers that are known to provide the
+// object, to speed up pinning.
+func (s *pinningService) connectOrigins(ctx context.Context, origins []string) {
+	if s.node.PeerHost == nil || len(origins) == 0 {
+		return
+	}
+
+	var addrs []ma.Multiaddr
+	for _, o := range origins {
+		a, err := ma.NewMultiaddr(o)
+		if err != nil {
+			continue
+		}
+		addrs = append(addrs, a)
+	}
+	infos, err := peer.AddrInfosFromP2pAddrs(addrs...)
+	if err != nil {
+		log.Debugf("pinning service: invalid origins: %s", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, pi := range infos {
+		wg.Add(1)
+		go func(pi peer.AddrInfo) {
+			defer wg.Done()
+			if err := s.node.PeerHost.Connect(ctx, pi); err != nil {
+				log.Debugf("pinning service: failed to connect to origin %s: %s", pi.ID, err)
+			}
+		}(pi)
+	}
+	wg.Wait()
+}
+
+// delegates returns the addresses other peers can fetch pinned objects from.
+func (s *pinningService) delegates() []string {
+	out := []string{}
+	if s.node.PeerHost == nil {
+		return out
+	}
+
+	p2p, err := ma.NewComponent("p2p", s.node.Identity.Pretty())
+	if err != nil {
+		return out
+	}
+	for _, a := range s.node.PeerHost.Addrs() {
+		out = append(out, a.Encapsulate(p2p).String())
+	}
+	return out
+}
+
+func (s *pinningService) status(rec *pinRecord) pinsvc.PinStatus {
+	st := rec.PinStatus
+	st.Delegates = s.delegates()
+	return st
+}
+
+type pinningServiceHandler struct {
+	svc    *pinningService
+	prefix string
+	tokens []string
+}
+
+func (h *pinningServiceHandler) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := []byte(strings.TrimPrefix(auth, "Bearer "))
+
+	ok := false
+	for _, t := range h.tokens {
+		if subtle.ConstantTimeCompare(token, []byte(t)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+func (h *pinningServiceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writePinningServiceError(w, http.StatusUnauthorized, "UNAUTHORIZED", "a valid access token is required")
+		return
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, h.prefix), "/")
+	if strings.Contains(id, "/") {
+		writePinningServiceError(w, http.StatusNotFound, "NOT_FOUND", "no such endpoint")
+		return
+	}
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		h.list(w, r)
+	case id == "" && r.Method == http.MethodPost:
+		h.add(w, r, "")
+	case id != "" && r.Method == http.MethodGet:
+		h.get(w, id)
+	case id != "" && r.Method == http.MethodPost:
+		h.add(w, r, id)
+	case id != "" && r.Method == http.MethodDelete:
+		h.remove(w, id)
+	default:
+		writePinningServiceError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", r.Method+" is not allowed here")
+	}
+}
+
+func (h *pinningServiceHandler) list(w http.ResponseWriter, r *http.Request) {
+	filter, err := parsePinListFilter(r)
+	if err != nil {
+		writePinningServiceError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+
+	records, err := h.svc.records()
+	if err != nil {
+		writePinningServiceError(w, http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", err.Error())
+		return
+	}
+
+	var matching []*pinRecord
+	for _, rec := range records {
+		if filter.matches(rec) {
+			matching = append(matching, rec)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].Created.After(matching[j].Created)
+	})
+
+	res := pinsvc.PinResults{
+		Count:   len(matching),
+		Results: []pinsvc.PinStatus{},
+	}
+	for i, rec := range matching {
+		if i >= filter.limit {
+			break
+		}
+		res.Results = append(res.Results, h.svc.status(rec))
+	}
+	writePinningServiceJSON(w, http.StatusOK, res)
+}
+
+func (h *pinningServiceHandler) add(w http.ResponseWriter, r *http.Request, replace string) {
+	var p pinsvc.Pin
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPinRequestSize)).Decode(&p); err != nil {
+		writePinningServiceError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid pin: "+err.Error())
+		return
+	}
+	if err := validatePin(p); err != nil {
+		writePinningServiceError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+
+	rec, err := h.svc.add(p, replace)
+	switch err {
+	case nil:
+	case errPinRequestNotFound:
+		writePinningServiceError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+		return
+	default:
+		writePinningServiceError(w, http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", err.Error())
+		return
+	}
+	writePinningServiceJSON(w, http.StatusAccepted, h.svc.status(rec))
+}
+
+func (h *pinningServiceHandler) get(w http.ResponseWriter, id string) {
+	rec, err := h.svc.load(id)
+	switch err {
+	case nil:
+	case errPinRequestNotFound:
+		writePinningServiceError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+		return
+	default:
+		writePinningServiceError(w, http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", err.Error())
+		return
+	}
+	writePinningServiceJSON(w, http.StatusOK, h.svc.status(rec))
+}
+
+func (h *pinningServiceHandler) remove(w http.ResponseWriter, id string) {
+	switch err := h.svc.remove(id); err {
+	case nil:
+		w.WriteHeader(http.StatusAccepted)
+	case errPinRequestNotFound:
+		writePinningServiceError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+	default:
+		writePinningServiceError(w, http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", err.Error())
+	}
+}
+
+func validatePin(p pinsvc.Pin) error {
+	if _, err := cid.Decode(p.Cid); err != nil {
+		return fmt.Errorf("invalid cid %q: %s", p.Cid, err)
+	}
+	if len(p.Name) > 255 {
+		return fmt.Errorf("pin name is longer than 255 characters")
+	}
+	for _, o := range p.Origins {
+		if _, err := ma.NewMultiaddr(o); err != nil {
+			return fmt.Errorf("invalid origin %q: %s", o, err)
+		}
+	}
+	return nil
+}
+
+type pinListFilter struct {
+	cids     map[string]bool
+	name     string
+	match    string
+	statuses map[pinsvc.Status]bool
+	before   time.Time
+	after    time.Time
+	limit    int
+	meta     map[string]string
+}
+
+func parsePinListFilter(r *http.Request) (*pinListFilter, error) {
+	q := r.URL.Query()
+	f := &pinListFilter{
+		name:     q.Get("name"),
+		match:    q.Get("match"),
+		statuses: map[pinsvc.Status]bool{pinsvc.StatusPinned: true},
+		limit:    pinsvc.DefaultLimit,
+	}
+
+	if v := q.Get("cid"); v != "" {
+		cids := strings.Split(v, ",")
+		if len(cids) > 10 {
+			return nil, fmt.Errorf("at most 10 cids can be requested at once")
+		}
+		f.cids = make(map[string]bool, len(cids))
+		for _, c := range cids {
+			f.cids[c] = true
+		}
+	}
+
+	switch f.match {
+	case "":
+		f.match = pinsvc.MatchExact
+	case pinsvc.MatchExact, pinsvc.MatchIExact, pinsvc.MatchPartial, pinsvc.MatchIPartial:
+	default:
+		return nil, fmt.Errorf("invalid match %q", f.match)
+	}
+
+	if v := q.Get("status"); v != "" {
+		f.statuses = make(map[pinsvc.Status]bool)
+		for _, s := range strings.Split(v, ",") {
+			st, err := pinsvc.ParseStatus(s)
+			if err != nil {
+				return nil, err
+			}
+			f.statuses[st] = true
+		}
+	}
+
+	var err error
+	if v := q.Get("before"); v != "" {
+		if f.before, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, fmt.Errorf("invalid before: %s", err)
+		}
+	}
+	if v := q.Get("after"); v != "" {
+		if f.after, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, fmt.Errorf("invalid after: %s", err)
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		f.limit, err = strconv.Atoi(v)
+		if err != nil || f.limit < 1 || f.limit > pinsvc.MaxLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", pinsvc.MaxLimit)
+		}
+	}
+
+	if v := q.Get("meta"); v != "" {
+		if err := json.Unmarshal([]byte(v), &f.meta); err != nil {
+			return nil, fmt.Errorf("invalid meta: %s", err)
+		}
+	}
+
+	return f, nil
+}
+
+func (f *pinListFilter) matches(rec *pinRecord) bool {
+	if f.cids != nil && !f.cids[rec.Pin.Cid] {
+		return false
+	}
+	if !f.statuses[rec.Status] {
+		return false
+	}
+	if !f.before.IsZero() && !rec.Created.Before(f.before) {
+		return false
+	}
+	if !f.after.IsZero() && !rec.Created.After(f.after) {
+		return false
+	}
+	for k, v := range f.meta {
+		if rec.Pin.Meta[k] != v {
+			return false
+		}
+	}
+	if f.name == "" {
+		return true
+	}
+
+	name, query := rec.Pin.Name, f.name
+	switch f.match {
+	case pinsvc.MatchIExact, pinsvc.MatchIPartial:
+		name, query = strings.ToLower(name), strings.ToLower(query)
+	}
+	switch f.match {
+	case pinsvc.MatchPartial, pinsvc.MatchIPartial:
+		return strings.Contains(name, query)
+	default:
+		return name == query
+	}
+}
+
+func writePinningServiceJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debugf("pinning service: failed to write response: %s", err)
+	}
+}
+
+func writePinningServiceError(w http.ResponseWriter, code int, reason, details string) {
+	writePinningServiceJSON(w, code, pinsvc.ErrorResponse{
+		Error: pinsvc.Failure{Reason: reason, Details: details},
+	})
+}
@@ -0,0 +1,291 @@
+package corehttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/pinsvc"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+)
+
+const testPinningToken = "secret"
+
+type pinningServiceClient struct {
+	t   *testing.T
+	url string
+}
+
+func (c *pinningServiceClient) do(method, p, token string, body interface{}, out interface{}) int {
+	c.t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, c.url+"/pinning/pins"+p, &buf)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if out != nil && res.StatusCode < 300 {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	return res.StatusCode
+}
+
+// waitStatus polls a pin request until it's done being processed.
+func (c *pinningServiceClient) waitStatus(id string) pinsvc.PinStatus {
+	c.t.Helper()
+
+	for i := 0; i < 100; i++ {
+		var st pinsvc.PinStatus
+		if code := c.do("GET", "/"+id, testPinningToken, nil, &st); code != http.StatusOK {
+			c.t.Fatalf("unexpected status code %d", code)
+		}
+		if st.Status == pinsvc.StatusPinned || st.Status == pinsvc.StatusFailed {
+			return st
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	c.t.Fatalf("pin request %s was not processed", id)
+	return pinsvc.PinStatus{}
+}
+
+func isPinned(t *testing.T, n *core.IpfsNode, c cid.Cid) bool {
+	t.Helper()
+	_, pinned, err := n.Pinning.IsPinnedWithType(context.Background(), c, pin.Recursive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pinned
+}
+
+func TestPinningService(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dh := &delegatedHandler{}
+	ts := httptest.NewServer(dh)
+	defer ts.Close()
+
+	dh.Handler, err = makeHandler(n, ts.Listener, PinningServiceOption(PinningServiceConfig{
+		Enabled:      true,
+		AccessTokens: []string{testPinningToken},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add := func(data string) cid.Cid {
+		p, err := api.Unixfs().Add(n.Context(), files.NewBytesFile([]byte(data)), options.Unixfs.Pin(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.Cid()
+	}
+	a, b := add("a"), add("b")
+
+	c := &pinningServiceClient{t: t, url: ts.URL}
+
+	if code := c.do("GET", "", "", nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", code)
+	}
+	if code := c.do("GET", "", "wrong", nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with a bad token, got %d", code)
+	}
+	if code := c.do("POST", "", testPinningToken, pinsvc.Pin{Cid: "nope"}, nil); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid cid, got %d", code)
+	}
+
+	var st pinsvc.PinStatus
+	code := c.do("POST", "", testPinningToken, pinsvc.Pin{Cid: a.String(), Name: "Site A", Meta: map[string]string{"env": "prod"}}, &st)
+	if code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", code)
+	}
+	if st.RequestID == "" || st.Pin.Cid != a.String() {
+		t.Fatalf("unexpected pin status: %+v", st)
+	}
+	if st = c.waitStatus(st.RequestID); st.Status != pinsvc.StatusPinned {
+		t.Fatalf("pin failed: %+v", st)
+	}
+	if !isPinned(t, n, a) {
+		t.Fatal("object should have been pinned")
+	}
+	if m, _ := n.PinMeta.Get(a); m.Name != "Site A" {
+		t.Fatalf("pin should have been named, got %+v", m)
+	}
+
+	var res pinsvc.PinResults
+	for q, count := range map[string]int{
+		"":                             1,
+		"?name=site&match=ipartial":    1,
+		"?name=site":                   0,
+		"?status=queued,failed":        0,
+		"?cid=" + a.String():           1,
+		"?cid=" + b.String():           0,
+		`?meta={"env":"prod"}`:         1,
+		"?after=2000-01-01T00:00:00Z":  1,
+		"?before=2000-01-01T00:00:00Z": 0,
+	} {
+		if code := c.do("GET", q, testPinningToken, nil, &res); code != http.StatusOK {
+			t.Fatalf("listing %q: unexpected status code %d", q, code)
+		}
+		if res.Count != count || len(res.Results) != count {
+			t.Fatalf("listing %q: expected %d results, got %+v", q, count, res)
+		}
+	}
+	if code := c.do("GET", "?limit=0", testPinningToken, nil, nil); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid limit, got %d", code)
+	}
+
+	// replacing a pin request unpins the old object
+	var replaced pinsvc.PinStatus
+	if code := c.do("POST", "/"+st.RequestID, testPinningToken, pinsvc.Pin{Cid: b.String()}, &replaced); code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", code)
+	}
+	if replaced = c.waitStatus(replaced.RequestID); replaced.Status != pinsvc.StatusPinned {
+		t.Fatalf("pin failed: %+v", replaced)
+	}
+	if isPinned(t, n, a) || !isPinned(t, n, b) {
+		t.Fatal("replacing should have moved the pin")
+	}
+	if code := c.do("GET", "/"+st.RequestID, testPinningToken, nil, nil); code != http.StatusNotFound {
+		t.Fatalf("expected the replaced request to be gone, got %d", code)
+	}
+
+	if code := c.do("DELETE", "/"+replaced.RequestID, testPinningToken, nil, nil); code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", code)
+	}
+	if isPinned(t, n, b) {
+		t.Fatal("removing the request should have unpinned the object")
+	}
+	if code := c.do("DELETE", "/"+replaced.RequestID, testPinningToken, nil, nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", code)
+	}
+}
+
+func TestPinningServiceKeepsExistingPins(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dh := &delegatedHandler{}
+	ts := httptest.NewServer(dh)
+	defer ts.Close()
+
+	dh.Handler, err = makeHandler(n, ts.Listener, PinningServiceOption(PinningServiceConfig{
+		Enabled:      true,
+		AccessTokens: []string{testPinningToken},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := api.Unixfs().Add(n.Context(), files.NewBytesFile([]byte("pinned")), options.Unixfs.Pin(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &pinningServiceClient{t: t, url: ts.URL}
+	var st pinsvc.PinStatus
+	if code := c.do("POST", "", testPinningToken, pinsvc.Pin{Cid: p.Cid().String()}, &st); code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", code)
+	}
+	c.waitStatus(st.RequestID)
+
+	if code := c.do("DELETE", "/"+st.RequestID, testPinningToken, nil, nil); code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", code)
+	}
+	if !isPinned(t, n, p.Cid()) {
+		t.Fatal("objects pinned before the request should stay pinned")
+	}
+}
+
+func TestPinningServiceResumesInterruptedRequests(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := api.Unixfs().Add(n.Context(), files.NewBytesFile([]byte("interrupted")), options.Unixfs.Pin(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := newPinningService(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &pinRecord{
+		PinStatus: pinsvc.PinStatus{
+			RequestID: "interrupted",
+			Status:    pinsvc.StatusPinning,
+			Created:   time.Now().UTC(),
+			Pin:       pinsvc.Pin{Cid: p.Cid().String()},
+		},
+	}
+	if err := s.store(rec); err != nil {
+		t.Fatal(err)
+	}
+
+	// the node stops while the object is being pinned
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.process(ctx, rec)
+
+	if rec, err = s.load(rec.RequestID); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Status != pinsvc.StatusPinning {
+		t.Fatalf("expected the interrupted request to stay pinning, got %s", rec.Status)
+	}
+
+	// and resumes it when it starts again
+	if _, err := newPinningService(n); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; !isPinned(t, n, p.Cid()); i++ {
+		if i == 100 {
+			t.Fatal("expected the interrupted request to be resumed")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
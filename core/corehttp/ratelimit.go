@@ -0,0 +1,50 @@
+package corehttp
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket allowing rate events per second on average,
+// in bursts of up to burst events.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	lk     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// allow returns whether an event can happen now, and otherwise how long until
+// it can.
+func (l *rateLimiter) allow(now time.Time) (bool, time.Duration) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// retryAfter formats the delay for a Retry-After header, in whole seconds.
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,307 @@
+package corehttp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/repo"
+
+	config "github.com/ipfs/go-ipfs-config"
+	ma "github.com/multiformats/go-multiaddr"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// GatewayTLSConfigKey is the config section configuring the certificates of
+// the TLS listeners.
+const GatewayTLSConfigKey = "GatewayTLS"
+
+// protocolTLS is the code of the /tls multiaddr protocol, which the multiaddr
+// library doesn't know yet.
+const protocolTLS = 0x01c0
+
+func init() {
+	// registering fails if the library learned about the protocol
+	_ = ma.AddProtocol(ma.Protocol{
+		Name:  "tls",
+		Code:  protocolTLS,
+		VCode: ma.CodeToVarint(protocolTLS),
+	})
+}
+
+// GatewayTLSConfig configures the certificates of the listeners whose
+// multiaddr ends with /tls or /https.
+type GatewayTLSConfig struct {
+	// Certificates are the static certificates, served to the clients
+	// asking for a server name they're valid for. Wildcard certificates,
+	// like one for "*.ipfs.example.com", match the subdomains of subdomain
+	// gateways.
+	Certificates []GatewayCertificate
+	// ACME obtains and renews the certificates of the server names without
+	// a static certificate, if set.
+	ACME *GatewayACMEConfig
+}
+
+// GatewayCertificate is a certificate and its private key, in PEM files.
+type GatewayCertificate struct {
+	// CertFile is the certificate chain, relative to the repo unless
+	// absolute.
+	CertFile string
+	// KeyFile is the private key, relative to the repo unless absolute.
+	KeyFile string
+}
+
+// GatewayACMEConfig configures the certificates obtained from a CA with the
+// ACME protocol, proving the control of the domains with the tls-alpn-01
+// challenge on the TLS listeners, or the http-01 challenge on the listeners
+// on port 80.
+type GatewayACMEConfig struct {
+	// DirectoryURL is the ACME directory of the CA, the one of Let's
+	// Encrypt if empty.
+	DirectoryURL string
+	// CAFile is a PEM file of certificates trusted for the connections to
+	// the CA, like the root of a local Pebble server, relative to the repo
+	// unless absolute. The system roots are used if empty.
+	CAFile string
+	// Email is the contact of the account, for the notices of the CA.
+	Email string
+	// AcceptTermsOfService agrees to the terms of service of the CA, which
+	// is required.
+	AcceptTermsOfService bool
+	// Domains are the server names certificates are obtained for. The
+	// hostnames of Gateway.PublicGateways, without their subdomains, are used
+	// if empty. Wildcard domains aren't supported, as their certificates can
+	// only be obtained with DNS challenges.
+	Domains []string
+	// CacheDir is the directory storing the account and the certificates,
+	// relative to the repo unless absolute, "acme" if empty.
+	CacheDir string
+}
+
+// LoadGatewayTLSConfig reads the GatewayTLS section of the config of the given
+// repo, with the paths of the files made absolute.
+func LoadGatewayTLSConfig(r repo.Repo) (GatewayTLSConfig, error) {
+	var cfg GatewayTLSConfig
+
+	if err := repo.LoadConfigSection(r, GatewayTLSConfigKey, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if cfg.ACME != nil && cfg.ACME.CacheDir == "" {
+		cfg.ACME.CacheDir = "acme"
+	}
+	if pr, ok := r.(interface{ Path() string }); ok && pr.Path() != "" {
+		abs := func(f *string) {
+			if *f != "" && !filepath.IsAbs(*f) {
+				*f = filepath.Join(pr.Path(), *f)
+			}
+		}
+		for i := range cfg.Certificates {
+			abs(&cfg.Certificates[i].CertFile)
+			abs(&cfg.Certificates[i].KeyFile)
+		}
+		if cfg.ACME != nil {
+			abs(&cfg.ACME.CAFile)
+			abs(&cfg.ACME.CacheDir)
+		}
+	}
+	return cfg, nil
+}
+
+// SplitTLS returns the multiaddr to listen on for a multiaddr ending with
+// /tls or /https, and whether it does.
+func SplitTLS(addr ma.Multiaddr) (ma.Multiaddr, bool) {
+	base, last := ma.SplitLast(addr)
+	if last == nil || base == nil {
+		return addr, false
+	}
+	switch last.Protocol().Code {
+	case protocolTLS, ma.P_HTTPS:
+		return base, true
+	}
+	return addr, false
+}
+
+// GatewayTLS terminates the TLS connections of the listeners, with the static
+// certificates or the ones obtained with ACME.
+type GatewayTLS struct {
+	certs []tls.Certificate
+	acme  *autocert.Manager
+
+	config *tls.Config
+}
+
+// LoadGatewayTLS returns the GatewayTLS configured for the node.
+func LoadGatewayTLS(n *core.IpfsNode) (*GatewayTLS, error) {
+	cfg, err := LoadGatewayTLSConfig(n.Repo)
+	if err != nil {
+		return nil, err
+	}
+	nodeCfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	return NewGatewayTLS(cfg, nodeCfg.Gateway.PublicGateways)
+}
+
+// NewGatewayTLS returns a GatewayTLS serving the certificates of the config.
+// The public gateways are the default domains of ACME certificates.
+func NewGatewayTLS(cfg GatewayTLSConfig, publicGateways map[string]*config.GatewaySpec) (*GatewayTLS, error) {
+	if len(cfg.Certificates) == 0 && cfg.ACME == nil {
+		return nil, fmt.Errorf("%s config: no certificates for the TLS listeners", GatewayTLSConfigKey)
+	}
+
+	t := new(GatewayTLS)
+	for _, c := range cfg.Certificates {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s config: %s", GatewayTLSConfigKey, err)
+		}
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, fmt.Errorf("invalid %s config: %s: %s", GatewayTLSConfigKey, c.CertFile, err)
+		}
+		t.certs = append(t.certs, cert)
+	}
+
+	t.config = &tls.Config{
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: t.getCertificate,
+	}
+
+	if cfg.ACME != nil {
+		m, err := newACMEManager(*cfg.ACME, publicGateways)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s config: %s", GatewayTLSConfigKey, err)
+		}
+		t.acme = m
+		// enables the tls-alpn-01 challenge
+		t.config.NextProtos = append(t.config.NextProtos, acme.ALPNProto)
+	}
+	return t, nil
+}
+
+func newACMEManager(cfg GatewayACMEConfig, publicGateways map[string]*config.GatewaySpec) (*autocert.Manager, error) {
+	if !cfg.AcceptTermsOfService {
+		return nil, errors.New("ACME requires accepting the terms of service of the CA")
+	}
+	for _, d := range cfg.Domains {
+		if strings.Contains(d, "*") {
+			return nil, fmt.Errorf("ACME domain %q: wildcard certificates need DNS challenges, which aren't supported, use a static certificate", d)
+		}
+	}
+
+	client := &acme.Client{DirectoryURL: cfg.DirectoryURL}
+	if client.DirectoryURL == "" {
+		client.DirectoryURL = autocert.DefaultACMEDirectory
+	}
+	if cfg.CAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", cfg.CAFile)
+		}
+		client.HTTPClient = &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: roots},
+		}}
+	}
+
+	gateways := make(map[string]config.GatewaySpec, len(publicGateways))
+	for hostname, gw := range publicGateways {
+		if gw != nil {
+			gateways[hostname] = *gw
+		}
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cfg.CacheDir),
+		HostPolicy: acmeHostPolicy(cfg.Domains, gateways),
+		Client:     client,
+		Email:      cfg.Email,
+	}, nil
+}
+
+// acmeHostPolicy allows obtaining certificates for the domains or, without
+// domains, for the known gateways. The subdomains of subdomain gateways aren't
+// allowed: each would get its own certificate on its first connection, so that
+// anyone could exhaust the rate limits of the CA by connecting to made up
+// subdomains.
+func acmeHostPolicy(domains []string, knownGateways map[string]config.GatewaySpec) autocert.HostPolicy {
+	return func(_ context.Context, hostname string) error {
+		if len(domains) == 0 {
+			if _, ok := isKnownHostname(hostname, knownGateways); ok {
+				return nil
+			}
+		}
+		for _, d := range domains {
+			if strings.EqualFold(d, hostname) {
+				return nil
+			}
+		}
+		return fmt.Errorf("no certificate for %q", hostname)
+	}
+}
+
+// getCertificate returns the static certificate valid for the server name,
+// if any, and the ACME one otherwise. Without ACME, clients not asking for a
+// known server name get the first certificate.
+func (t *GatewayTLS) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if t.acme != nil {
+		// the tls-alpn-01 challenges are answered by ACME, whatever the
+		// static certificates
+		for _, proto := range hello.SupportedProtos {
+			if proto == acme.ALPNProto {
+				return t.acme.GetCertificate(hello)
+			}
+		}
+	}
+
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if name != "" {
+		for i := range t.certs {
+			if t.certs[i].Leaf.VerifyHostname(name) == nil {
+				return &t.certs[i], nil
+			}
+		}
+	}
+	if t.acme != nil {
+		return t.acme.GetCertificate(hello)
+	}
+	return &t.certs[0], nil
+}
+
+// Config returns the configuration of the TLS servers.
+func (t *GatewayTLS) Config() *tls.Config {
+	return t.config
+}
+
+// NewListener returns a listener accepting the TLS connections of l.
+func (t *GatewayTLS) NewListener(l net.Listener) net.Listener {
+	return tls.NewListener(l, t.config)
+}
+
+// ACMEChallengeOption answers the http-01 challenges of ACME, which the CA
+// sends to port 80 of the domains. It does nothing without ACME.
+func (t *GatewayTLS) ACMEChallengeOption() ServeOption {
+	return func(_ *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		if t.acme == nil {
+			return mux, nil
+		}
+		childMux := http.NewServeMux()
+		mux.Handle("/", t.acme.HTTPHandler(childMux))
+		return childMux, nil
+	}
+}
@@ -0,0 +1,453 @@
+package corehttp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	config "github.com/ipfs/go-ipfs-config"
+	ma "github.com/multiformats/go-multiaddr"
+	"golang.org/x/crypto/acme"
+)
+
+func TestSplitTLS(t *testing.T) {
+	for addr, listen := range map[string]string{
+		"/ip4/127.0.0.1/tcp/443/tls":   "/ip4/127.0.0.1/tcp/443",
+		"/ip4/127.0.0.1/tcp/443/https": "/ip4/127.0.0.1/tcp/443",
+		"/ip4/127.0.0.1/tcp/8080":      "",
+	} {
+		maddr, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, ok := SplitTLS(maddr)
+		if ok != (listen != "") || (ok && out.String() != listen) || (!ok && !out.Equal(maddr)) {
+			t.Errorf("%s: unexpected (%s, %t)", addr, out, ok)
+		}
+	}
+}
+
+// testCA issues the certificates of the tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(90 * 24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns the PEM chain of a certificate for the names.
+func (ca *testCA) issue(t *testing.T, pub interface{}, names ...string) []byte {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour), // not renewed yet
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, pub, ca.key)
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})...)
+}
+
+// serveTLS serves the TLS connections of the listener, returning a client
+// connecting to it whatever the hostname of the URLs.
+func serveTLS(t *testing.T, gwTLS *GatewayTLS, roots *x509.CertPool) (net.Listener, *http.Client) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello %s", r.Host)
+	})}
+	go srv.Serve(gwTLS.NewListener(l))
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, l.Addr().String())
+		},
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}}
+	return l, client
+}
+
+func TestGatewayTLSCertificates(t *testing.T) {
+	ca := newTestCA(t)
+	dir, err := ioutil.TempDir("", "gateway-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var cfg GatewayTLSConfig
+	for i, names := range [][]string{
+		{"example.com", "*.ipfs.example.com"},
+		{"other.example.net"},
+	} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDer, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := GatewayCertificate{
+			CertFile: filepath.Join(dir, fmt.Sprintf("%d.crt", i)),
+			KeyFile:  filepath.Join(dir, fmt.Sprintf("%d.key", i)),
+		}
+		if err := ioutil.WriteFile(c.CertFile, ca.issue(t, &key.PublicKey, names...), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(c.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		cfg.Certificates = append(cfg.Certificates, c)
+	}
+
+	gwTLS, err := NewGatewayTLS(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, client := serveTLS(t, gwTLS, ca.pool)
+	defer l.Close()
+
+	for _, host := range []string{"example.com", "bafy.ipfs.example.com", "other.example.net"} {
+		res, err := client.Get("https://" + host + "/")
+		if err != nil {
+			t.Fatalf("%s: %s", host, err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != "hello "+host {
+			t.Errorf("%s: unexpected response %q", host, body)
+		}
+	}
+	if _, err := client.Get("https://unknown.example.org/"); err == nil {
+		t.Error("the certificate of an unknown host shouldn't be valid")
+	}
+
+	if _, err := NewGatewayTLS(GatewayTLSConfig{}, nil); err == nil {
+		t.Error("expected an error without certificates")
+	}
+	if _, err := NewGatewayTLS(GatewayTLSConfig{ACME: &GatewayACMEConfig{}}, nil); err == nil {
+		t.Error("expected an error without accepting the terms of service")
+	}
+	if _, err := NewGatewayTLS(GatewayTLSConfig{ACME: &GatewayACMEConfig{
+		AcceptTermsOfService: true,
+		Domains:              []string{"*.ipfs.example.com"},
+	}}, nil); err == nil {
+		t.Error("expected an error with a wildcard ACME domain")
+	}
+}
+
+func TestACMEHostPolicy(t *testing.T) {
+	gateways := map[string]config.GatewaySpec{
+		"dweb.example.com": {Paths: defaultPaths, UseSubdomains: true},
+		"path.example.com": {Paths: defaultPaths},
+	}
+	policy := acmeHostPolicy(nil, gateways)
+	for hostname, allowed := range map[string]bool{
+		"dweb.example.com":                        true,
+		"bafy.ipfs.dweb.example.com":              false,
+		"en.wikipedia-on-ipfs.org.ipns.dweb.link": false,
+		"path.example.com":                        true,
+		"bafy.ipfs.path.example.com":              false,
+		"bafy.foo.dweb.example.com":               false,
+		"example.com":                             false,
+	} {
+		if err := policy(context.Background(), hostname); (err == nil) != allowed {
+			t.Errorf("%s: expected allowed %t, got %v", hostname, allowed, err)
+		}
+	}
+
+	policy = acmeHostPolicy([]string{"example.com", "dweb.example.com"}, gateways)
+	for hostname, allowed := range map[string]bool{
+		"example.com":                true,
+		"Dweb.Example.com":           true,
+		"bafy.ipfs.dweb.example.com": false,
+		"path.example.com":           false,
+	} {
+		if err := policy(context.Background(), hostname); (err == nil) != allowed {
+			t.Errorf("%s: expected allowed %t with domains, got %v", hostname, allowed, err)
+		}
+	}
+}
+
+// acmeStandIn is a minimal ACME CA, validating the tls-alpn-01 challenges on
+// the listener at addr.
+type acmeStandIn struct {
+	t    *testing.T
+	ca   *testCA
+	addr string
+	url  string
+
+	lk     sync.Mutex
+	orders []*acmeStandInOrder
+}
+
+type acmeStandInOrder struct {
+	domain string
+	status string
+	cert   []byte
+}
+
+// idOID is the id-pe-acmeIdentifier extension of tls-alpn-01 certificates.
+var idOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+func newACMEStandIn(t *testing.T, ca *testCA) *acmeStandIn {
+	s := &acmeStandIn{t: t, ca: ca}
+	ts := httptest.NewServer(s)
+	s.url = ts.URL
+	return s
+}
+
+func (s *acmeStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", time.Now().UnixNano()))
+	if r.URL.Path == "/directory" {
+		s.writeJSON(w, http.StatusOK, map[string]string{
+			"newNonce":   s.url + "/nonce",
+			"newAccount": s.url + "/account",
+			"newOrder":   s.url + "/order",
+		})
+		return
+	}
+	if r.Method != http.MethodPost {
+		return
+	}
+
+	// the signatures of the requests aren't checked
+	var jws struct{ Payload string }
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	var kind string
+	var i int
+	fmt.Sscanf(strings.Replace(r.URL.Path, "/", " ", -1), "%s %d", &kind, &i)
+	if kind != "account" && kind != "order" && (i < 0 || i >= len(s.orders)) {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case kind == "account":
+		w.Header().Set("Location", s.url+"/account/1")
+		s.writeJSON(w, http.StatusCreated, map[string]string{"status": "valid"})
+	case kind == "order" && r.URL.Path == "/order":
+		var req struct{ Identifiers []struct{ Value string } }
+		if err := json.Unmarshal(payload, &req); err != nil || len(req.Identifiers) != 1 {
+			http.Error(w, "invalid order", http.StatusBadRequest)
+			return
+		}
+		s.orders = append(s.orders, &acmeStandInOrder{domain: req.Identifiers[0].Value, status: "pending"})
+		s.writeOrder(w, http.StatusCreated, len(s.orders)-1)
+	case kind == "order":
+		s.writeOrder(w, http.StatusOK, i)
+	case kind == "authz":
+		s.writeJSON(w, http.StatusOK, s.authz(i))
+	case kind == "challenge":
+		if err := s.validate(s.orders[i].domain); err != nil {
+			s.t.Errorf("challenge of %s: %s", s.orders[i].domain, err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		s.orders[i].status = "ready"
+		s.writeJSON(w, http.StatusOK, s.authz(i)["challenges"].([]interface{})[0])
+	case kind == "finalize":
+		var req struct{ CSR string }
+		json.Unmarshal(payload, &req)
+		der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil || s.orders[i].status != "ready" {
+			http.Error(w, "invalid finalization", http.StatusForbidden)
+			return
+		}
+		s.orders[i].cert = s.ca.issue(s.t, csr.PublicKey, s.orders[i].domain)
+		s.orders[i].status = "valid"
+		s.writeOrder(w, http.StatusOK, i)
+	case kind == "cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(s.orders[i].cert)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *acmeStandIn) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *acmeStandIn) writeOrder(w http.ResponseWriter, status, i int) {
+	o := s.orders[i]
+	w.Header().Set("Location", fmt.Sprintf("%s/order/%d", s.url, i))
+	v := map[string]interface{}{
+		"status":         o.status,
+		"identifiers":    []map[string]string{{"type": "dns", "value": o.domain}},
+		"authorizations": []string{fmt.Sprintf("%s/authz/%d", s.url, i)},
+		"finalize":       fmt.Sprintf("%s/finalize/%d", s.url, i),
+	}
+	if o.status == "valid" {
+		v["certificate"] = fmt.Sprintf("%s/cert/%d", s.url, i)
+	}
+	s.writeJSON(w, status, v)
+}
+
+func (s *acmeStandIn) authz(i int) map[string]interface{} {
+	status := "pending"
+	if s.orders[i].status != "pending" {
+		status = "valid"
+	}
+	return map[string]interface{}{
+		"status":     status,
+		"identifier": map[string]string{"type": "dns", "value": s.orders[i].domain},
+		"challenges": []interface{}{map[string]string{
+			"type":   "tls-alpn-01",
+			"url":    fmt.Sprintf("%s/challenge/%d", s.url, i),
+			"token":  fmt.Sprintf("token-%d", i),
+			"status": status,
+		}},
+	}
+}
+
+// validate checks that the listener answers the tls-alpn-01 challenge of the
+// domain.
+func (s *acmeStandIn) validate(domain string) error {
+	conn, err := tls.Dial("tcp", s.addr, &tls.Config{
+		ServerName:         domain,
+		NextProtos:         []string{acme.ALPNProto},
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	state := conn.ConnectionState()
+	if state.NegotiatedProtocol != acme.ALPNProto {
+		return fmt.Errorf("negotiated %q", state.NegotiatedProtocol)
+	}
+	cert := state.PeerCertificates[0]
+	if cert.VerifyHostname(domain) != nil {
+		return fmt.Errorf("the challenge certificate isn't for %s", domain)
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(idOID) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no acmeIdentifier extension")
+}
+
+func TestGatewayTLSACME(t *testing.T) {
+	ca := newTestCA(t)
+	standIn := newACMEStandIn(t, ca)
+	dir, err := ioutil.TempDir("", "gateway-acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gwTLS, err := NewGatewayTLS(GatewayTLSConfig{ACME: &GatewayACMEConfig{
+		DirectoryURL:         standIn.url + "/directory",
+		AcceptTermsOfService: true,
+		Domains:              []string{"gateway.example.com", "www.gateway.example.com"},
+		CacheDir:             dir,
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, client := serveTLS(t, gwTLS, ca.pool)
+	defer l.Close()
+	standIn.addr = l.Addr().String()
+
+	hosts := []string{"gateway.example.com", "www.gateway.example.com", "gateway.example.com"}
+	for _, host := range hosts {
+		res, err := client.Get("https://" + host + "/")
+		if err != nil {
+			t.Fatalf("%s: %s", host, err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != "hello "+host {
+			t.Errorf("%s: unexpected response %q", host, body)
+		}
+	}
+	standIn.lk.Lock()
+	orders := len(standIn.orders)
+	standIn.lk.Unlock()
+	if orders != 2 {
+		t.Errorf("expected a certificate for each host, got %d orders", orders)
+	}
+
+	if _, err := client.Get("https://bafy.ipfs.gateway.example.com/"); err == nil {
+		t.Error("certificates shouldn't be obtained for subdomains")
+	}
+	if _, err := client.Get("https://other.example.com/"); err == nil {
+		t.Error("certificates shouldn't be obtained for other hosts")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/ipfs/go-ipfs/core"
@@ -20,6 +21,19 @@ var log = logging.Logger("corerepo")
 
 var ErrMaxStorageExceeded = errors.New("maximum storage limit exceeded. Try to unpin some files")
 
+// GCModeSelector is the config key selecting how automatic garbage
+// collections free space. It's in its own section, as the config keys unknown
+// to the Datastore section are dropped when the config is written.
+const GCModeSelector = "GC.Mode"
+
+const (
+	// GCModeFull removes every block that isn't pinned or in MFS.
+	GCModeFull = "full"
+	// GCModeLRU only removes the least recently used unpinned blocks, until
+	// the repo is back under the StorageGCWatermark.
+	GCModeLRU = "lru"
+)
+
 type GC struct {
 	Node       *core.IpfsNode
 	Repo       repo.Repo
@@ -27,6 +41,12 @@ type GC struct {
 	StorageGC  uint64
 	SlackGB    uint64
 	Storage    uint64
+
+	// Concurrent makes garbage collections run without blocking writes to
+	// the blockstore for their whole duration.
+	Concurrent bool
+	// Mode is either GCModeFull or GCModeLRU.
+	Mode string
 }
 
 func NewGC(n *core.IpfsNode) (*GC, error) {
@@ -65,12 +85,21 @@ func NewGC(n *core.IpfsNode) (*GC, error) {
 		slackGB = 1
 	}
 
+	mode := GCModeFull
+	if err := repo.LoadConfigSection(r, GCModeSelector, &mode); err != nil {
+		return nil, err
+	}
+	if mode != GCModeFull && mode != GCModeLRU {
+		return nil, fmt.Errorf("invalid %s %q, must be %q or %q", GCModeSelector, mode, GCModeFull, GCModeLRU)
+	}
+
 	return &GC{
 		Node:       n,
 		Repo:       r,
 		StorageMax: storageMax,
 		StorageGC:  storageGC,
 		SlackGB:    slackGB,
+		Mode:       mode,
 	}, nil
 }
 
@@ -93,6 +122,26 @@ func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 	return CollectResult(ctx, rmed, nil)
 }
 
+// ConcurrentGarbageCollect runs a garbage collection that doesn't block writes
+// to the blockstore while it is marking and sweeping.
+func ConcurrentGarbageCollect(n *core.IpfsNode, ctx context.Context) error {
+	rmed := ConcurrentGarbageCollectAsync(n, ctx)
+
+	return CollectResult(ctx, rmed, nil)
+}
+
+// EvictLRU removes unpinned blocks, least recently used first, until at
+// least toFree bytes have been freed.
+func EvictLRU(n *core.IpfsNode, ctx context.Context, toFree uint64) error {
+	roots, err := BestEffortRoots(n.FilesRoot)
+	if err != nil {
+		return err
+	}
+	rmed := gc.Evict(ctx, n.Blockstore, n.BlockAccess, n.Repo.Datastore(), n.Pinning, roots, toFree)
+
+	return CollectResult(ctx, rmed, nil)
+}
+
 // CollectResult collects the output of a garbage collection run and calls the
 // given callback for each object removed.  It also collects all errors into a
 // MultiError which is returned after the gc is completed.
@@ -159,6 +208,16 @@ func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result
 	return gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
 }
 
+// ConcurrentGarbageCollectAsync is the asynchronous version of
+// ConcurrentGarbageCollect.
+func ConcurrentGarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result {
+	roots := func() ([]cid.Cid, error) {
+		return BestEffortRoots(n.FilesRoot)
+	}
+
+	return gc.ConcurrentGC(ctx, n.Blockstore, n.GCBarrier, n.Repo.Datastore(), n.Pinning, roots)
+}
+
 func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
 	cfg, err := node.Repo.Config()
 	if err != nil {
@@ -182,6 +241,8 @@ func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
 	if err != nil {
 		return err
 	}
+	// periodic collections shouldn't stall the node while they run
+	gc.Concurrent = true
 
 	for {
 		select {
@@ -215,10 +276,23 @@ func (gc *GC) maybeGC(ctx context.Context, offset uint64) error {
 			log.Warnf("pre-GC: %s", ErrMaxStorageExceeded)
 		}
 
+		if gc.Mode == GCModeLRU {
+			log.Info("Watermark exceeded. Evicting least recently used blocks...")
+			if err := EvictLRU(gc.Node, ctx, storage+offset-gc.StorageGC); err != nil {
+				return err
+			}
+			log.Infof("Repo eviction done. See `ipfs repo stat` to see how much space got freed.\n")
+			return nil
+		}
+
 		// Do GC here
 		log.Info("Watermark exceeded. Starting repo GC...")
 
-		if err := GarbageCollect(gc.Node, ctx); err != nil {
+		collect := GarbageCollect
+		if gc.Concurrent {
+			collect = ConcurrentGarbageCollect
+		}
+		if err := collect(gc.Node, ctx); err != nil {
 			return err
 		}
 		log.Infof("Repo GC done. See `ipfs repo stat` to see how much space got freed.\n")
@@ -253,6 +253,106 @@ func TestAddGCLive(t *testing.T) {
 	}
 }
 
+func TestAddConcurrentGCLive(t *testing.T) {
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: testPeerID, // required by offline node
+			},
+		},
+		D: syncds.MutexWrap(datastore.NewMapDatastore()),
+	}
+	node, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	garbage := blocks.NewBlock([]byte("unreferenced block"))
+	if err := node.Blockstore.Put(garbage); err != nil {
+		t.Fatal(err)
+	}
+
+	out := make(chan interface{})
+	adder, err := NewAdder(context.Background(), node.Pinning, node.Blockstore, node.DAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adder.Out = out
+
+	// make a file with a pipe so we can 'pause' the add for timing of the test
+	piper, pipew := io.Pipe()
+	hangfile := files.NewReaderFile(piper)
+
+	slf := files.NewMapDirectory(map[string]files.Node{
+		"a": files.NewBytesFile([]byte("testfileA")),
+		"b": hangfile,
+	})
+
+	go func() {
+		defer close(out)
+		_, err := adder.AddAllAndPin(slf)
+
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	addedHashes := make(map[string]struct{})
+	o := <-out
+	addedHashes[o.(*coreiface.AddEvent).Path.Cid().String()] = struct{}{}
+
+	noRoots := func() ([]cid.Cid, error) { return nil, nil }
+	gcout := gc.ConcurrentGC(context.Background(), node.Blockstore, node.GCBarrier, node.Repo.Datastore(), node.Pinning, noRoots)
+
+	// let the gc run alongside the paused add, which it must not block
+	time.Sleep(time.Millisecond * 100)
+
+	// blocks written while the gc is running must survive it, even though
+	// nothing references them
+	written := blocks.NewBlock([]byte("block written during gc"))
+	if err := node.Blockstore.Put(written); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pipew.Write([]byte("some data for file b")); err != nil {
+		t.Fatal(err)
+	}
+	pipew.Close()
+
+	var last cid.Cid
+	for a := range out {
+		last = a.(*coreiface.AddEvent).Path.Cid()
+		addedHashes[last.String()] = struct{}{}
+	}
+
+	removed := make(map[string]struct{})
+	for r := range gcout {
+		if r.Error != nil {
+			t.Fatal(r.Error)
+		}
+		if _, ok := addedHashes[r.KeyRemoved.String()]; ok {
+			t.Fatal("gc'ed a hash we just added")
+		}
+		removed[r.KeyRemoved.String()] = struct{}{}
+	}
+
+	if _, ok := removed[garbage.Cid().String()]; !ok {
+		t.Fatal("gc should have removed the unreferenced block")
+	}
+	if has, err := node.Blockstore.Has(written.Cid()); err != nil || !has {
+		t.Fatal("gc removed a block written while it was running")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	set := cid.NewSet()
+	err = dag.Walk(ctx, dag.GetLinksWithDAG(node.DAG), last, set.Visit)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func testAddWPosInfo(t *testing.T, rawLeaves bool) {
 	r := &repo.Mock{
 		C: config.Config{
@@ -14,6 +14,7 @@ import (
 	"github.com/ipfs/go-ipfs-exchange-interface"
 	"github.com/ipfs/go-ipfs-exchange-offline"
 	"github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs-provider"
 	"github.com/ipfs/go-ipld-format"
 	"github.com/ipfs/go-merkledag"
 	"github.com/ipfs/go-mfs"
@@ -23,6 +24,9 @@ import (
 	"go.uber.org/fx"
 
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/denylist"
+	"github.com/ipfs/go-ipfs/pinmeta"
+	"github.com/ipfs/go-ipfs/pinqueue"
 	"github.com/ipfs/go-ipfs/repo"
 )
 
@@ -65,6 +69,31 @@ func Pinning(bstore blockstore.Blockstore, ds format.DAGService, repo repo.Repo)
 	return pinning, nil
 }
 
+// PinMetadata creates the store holding the names and labels of pins
+func PinMetadata(repo repo.Repo) *pinmeta.Store {
+	return pinmeta.NewStore(repo.Datastore())
+}
+
+// PinQueue creates the queue of pins processed in the background
+func PinQueue(repo repo.Repo, bs blockstore.GCBlockstore, ds format.DAGService, pinning pin.Pinner, meta *pinmeta.Store, prov provider.System) *pinqueue.Queue {
+	return pinqueue.New(repo.Datastore(), bs, ds, pinning, meta, prov)
+}
+
+// Denylist loads the denylist configured in the repo, and reloads it when its
+// files change
+func Denylist(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo) (*denylist.Denylist, error) {
+	cfg, err := denylist.LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	d, err := denylist.New(cfg.Files...)
+	if err != nil {
+		return nil, err
+	}
+	go d.Watch(helpers.LifecycleCtx(mctx, lc), denylist.DefaultReloadInterval)
+	return d, nil
+}
+
 var (
 	_ merkledag.SessionMaker = new(syncDagService)
 	_ format.DAGService      = new(syncDagService)
@@ -13,6 +13,7 @@ import (
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 
 	"github.com/ipfs/go-ipfs/core/node/libp2p"
+	"github.com/ipfs/go-ipfs/gc"
 	"github.com/ipfs/go-ipfs/p2p"
 
 	offline "github.com/ipfs/go-ipfs-exchange-offline"
@@ -156,6 +157,8 @@ func Storage(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 	return fx.Options(
 		fx.Provide(RepoConfig),
 		fx.Provide(Datastore),
+		fx.Provide(gc.NewWriteBarrier),
+		fx.Provide(gc.NewAccessTracker),
 		fx.Provide(BaseBlockstoreCtor(cacheOpts, bcfg.NilRepo, cfg.Datastore.HashOnRead)),
 		finalBstore,
 	)
@@ -204,6 +207,7 @@ func Identity(cfg *config.Config) fx.Option {
 // IPNS groups namesys related units
 var IPNS = fx.Options(
 	fx.Provide(RecordValidator),
+	fx.Provide(DNSResolver),
 )
 
 // Online groups online-only units
@@ -253,7 +257,7 @@ func Online(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 		maybeProvide(Graphsync, cfg.Experimental.GraphsyncEnabled),
 		fx.Provide(Namesys(ipnsCacheSize)),
 
-		fx.Invoke(IpnsRepublisher(repubPeriod, recordLifetime)),
+		fx.Provide(IpnsRepublisher(repubPeriod, recordLifetime)),
 
 		fx.Provide(p2p.New),
 
@@ -278,6 +282,9 @@ var Core = fx.Options(
 	fx.Provide(Dag),
 	fx.Provide(resolver.NewBasicResolver),
 	fx.Provide(Pinning),
+	fx.Provide(PinMetadata),
+	fx.Provide(PinQueue),
+	fx.Provide(Denylist),
 	fx.Provide(Files),
 )
 
@@ -10,7 +10,9 @@ import (
 	"github.com/libp2p/go-libp2p-core/peerstore"
 	"github.com/libp2p/go-libp2p-core/routing"
 	"github.com/libp2p/go-libp2p-record"
+	"go.uber.org/fx"
 
+	"github.com/ipfs/go-ipfs/core/node/helpers"
 	"github.com/ipfs/go-ipfs/namesys"
 	"github.com/ipfs/go-ipfs/namesys/republisher"
 	"github.com/ipfs/go-ipfs/repo"
@@ -26,21 +28,45 @@ func RecordValidator(ps peerstore.Peerstore) record.Validator {
 	}
 }
 
+// DNSResolver creates the resolver of DNSLink names configured in the repo
+func DNSResolver(repo repo.Repo) (*namesys.DNSResolver, error) {
+	cfg, err := namesys.LoadDNSConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	return namesys.NewDNSResolverFromConfig(cfg)
+}
+
 // Namesys creates new name system
-func Namesys(cacheSize int) func(rt routing.Routing, repo repo.Repo) (namesys.NameSystem, error) {
-	return func(rt routing.Routing, repo repo.Repo) (namesys.NameSystem, error) {
-		return namesys.NewNameSystem(rt, repo.Datastore(), cacheSize), nil
+func Namesys(cacheSize int) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, rt routing.Routing, repo repo.Repo, dns *namesys.DNSResolver) (namesys.NameSystem, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, rt routing.Routing, repo repo.Repo, dns *namesys.DNSResolver) (namesys.NameSystem, error) {
+		opts := []namesys.Option{namesys.WithDNSResolver(dns)}
+
+		cfg, err := namesys.LoadPersistentCacheConfig(repo)
+		if err != nil {
+			return nil, err
+		}
+		cache, err := namesys.NewPersistentCacheFromConfig(cfg, repo.Datastore())
+		if err != nil {
+			return nil, err
+		}
+		if cache != nil {
+			opts = append(opts, namesys.WithPersistentCache(cache))
+			go cache.PruneEvery(helpers.LifecycleCtx(mctx, lc), namesys.DefaultPruneInterval)
+		}
+
+		return namesys.NewNameSystem(rt, repo.Datastore(), cacheSize, opts...), nil
 	}
 }
 
 // IpnsRepublisher runs new IPNS republisher service
-func IpnsRepublisher(repubPeriod time.Duration, recordLifetime time.Duration) func(lcProcess, namesys.NameSystem, repo.Repo, crypto.PrivKey) error {
-	return func(lc lcProcess, namesys namesys.NameSystem, repo repo.Repo, privKey crypto.PrivKey) error {
+func IpnsRepublisher(repubPeriod time.Duration, recordLifetime time.Duration) func(lcProcess, namesys.NameSystem, repo.Repo, crypto.PrivKey) (*republisher.Republisher, error) {
+	return func(lc lcProcess, namesys namesys.NameSystem, repo repo.Repo, privKey crypto.PrivKey) (*republisher.Republisher, error) {
 		repub := republisher.NewRepublisher(namesys, repo.Datastore(), privKey, repo.Keystore())
 
 		if repubPeriod != 0 {
 			if !util.Debug && (repubPeriod < time.Minute || repubPeriod > (time.Hour*24)) {
-				return fmt.Errorf("config setting IPNS.RepublishPeriod is not between 1min and 1day: %s", repubPeriod)
+				return nil, fmt.Errorf("config setting IPNS.RepublishPeriod is not between 1min and 1day: %s", repubPeriod)
 			}
 
 			repub.Interval = repubPeriod
@@ -50,7 +76,13 @@ func IpnsRepublisher(repubPeriod time.Duration, recordLifetime time.Duration) fu
 			repub.RecordLifetime = recordLifetime
 		}
 
+		cfg, err := republisher.LoadConfig(repo)
+		if err != nil {
+			return nil, err
+		}
+		repub.Exclude = cfg.Exclude
+
 		lc.Append(repub.Run)
-		return nil
+		return repub, nil
 	}
 }
@@ -0,0 +1,39 @@
+package denylist
+
+import (
+	"path/filepath"
+
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// ConfigKey is the config section configuring the denylist.
+const ConfigKey = "Denylist"
+
+// Config configures the denylist.
+type Config struct {
+	// Files are the denylist files, relative to the repo unless absolute.
+	Files []string
+	// Commands enforces the denylist in 'ipfs cat' and 'ipfs get', on top
+	// of the gateway.
+	Commands bool
+}
+
+// LoadConfig reads the Denylist section of the config of the given repo, with
+// the paths of the files made absolute. Nothing is blocked if the section is
+// missing.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+
+	if err := repo.LoadConfigSection(r, ConfigKey, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if pr, ok := r.(interface{ Path() string }); ok && pr.Path() != "" {
+		for i, f := range cfg.Files {
+			if !filepath.IsAbs(f) {
+				cfg.Files[i] = filepath.Join(pr.Path(), f)
+			}
+		}
+	}
+	return cfg, nil
+}
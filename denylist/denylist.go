@@ -0,0 +1,332 @@
+// Package denylist implements lists of content the node refuses to serve.
+//
+// A denylist file has one entry per line. Empty lines and lines starting
+// with # are ignored. Entries are:
+//
+//	/ipfs/<cid>              the CID, whatever its version or codec
+//	/ipfs/<cid>/some/path    the path under the CID, and what's below it
+//	/ipns/<name>[/path]      the IPNS or DNSLink name, or a path under it
+//	//<sha256>               a double-hashed entry
+//
+// The /ipfs/ prefix of CID entries is optional. Double-hashed entries list
+// content without revealing it: they are the hex-encoded SHA-256 of
+// "<CIDv1 in base32>/<path>" for CIDs, with an empty path for the CID itself,
+// and of "<name>/<path>" for names.
+package denylist
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	gopath "github.com/ipfs/go-path"
+)
+
+var log = logging.Logger("denylist")
+
+// ErrBlocked is returned for content blocked by a denylist.
+var ErrBlocked = errors.New("blocked content")
+
+// DefaultReloadInterval is how often the denylist files are checked for
+// changes by default.
+const DefaultReloadInterval = 10 * time.Second
+
+// rules are the entries of the denylist files.
+type rules struct {
+	// cids maps the multihashes of the CIDs to the paths under them, the
+	// empty path blocking the CID itself
+	cids map[string]map[string]bool
+	// names maps the names to the paths under them
+	names map[string]map[string]bool
+	// hashes are the double-hashed entries
+	hashes map[string]bool
+}
+
+func newRules() *rules {
+	return &rules{
+		cids:   make(map[string]map[string]bool),
+		names:  make(map[string]map[string]bool),
+		hashes: make(map[string]bool),
+	}
+}
+
+func add(m map[string]map[string]bool, key, p string) {
+	if m[key] == nil {
+		m[key] = make(map[string]bool)
+	}
+	m[key][p] = true
+}
+
+func (r *rules) merge(o *rules) {
+	for k, paths := range o.cids {
+		for p := range paths {
+			add(r.cids, k, p)
+		}
+	}
+	for k, paths := range o.names {
+		for p := range paths {
+			add(r.names, k, p)
+		}
+	}
+	for h := range o.hashes {
+		r.hashes[h] = true
+	}
+}
+
+// cleanPath returns the segments of p, without empty ones.
+func cleanPath(p string) []string {
+	var segs []string
+	for _, s := range strings.Split(p, "/") {
+		if s != "" {
+			segs = append(segs, s)
+		}
+	}
+	return segs
+}
+
+// parse parses the entries of a denylist file.
+func parse(r io.Reader) (*rules, error) {
+	rs := newRules()
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "//") {
+			h := strings.ToLower(line[2:])
+			if b, err := hex.DecodeString(h); err != nil || len(b) != sha256.Size {
+				return nil, fmt.Errorf("line %d: invalid double-hashed entry %q", n, line)
+			}
+			rs.hashes[h] = true
+			continue
+		}
+
+		segs := cleanPath(line)
+		if len(segs) > 0 && (segs[0] == "ipfs" || segs[0] == "ipns") {
+			if len(segs) < 2 {
+				return nil, fmt.Errorf("line %d: invalid entry %q", n, line)
+			}
+			if segs[0] == "ipns" {
+				add(rs.names, normalizeName(segs[1]), strings.Join(segs[2:], "/"))
+				continue
+			}
+			segs = segs[1:]
+		}
+		c, err := cid.Decode(segs[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid entry %q: %s", n, line, err)
+		}
+		add(rs.cids, string(c.Hash()), strings.Join(segs[1:], "/"))
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// DoubleHash returns the double-hashed entry of the content at the given
+// path under a CID or a name.
+func DoubleHash(key, p string) string {
+	if c, err := cid.Decode(key); err == nil {
+		key = cid.NewCidV1(c.Type(), c.Hash()).String()
+	} else {
+		key = normalizeName(key)
+	}
+	sum := sha256.Sum256([]byte(key + "/" + strings.Join(cleanPath(p), "/")))
+	return hex.EncodeToString(sum[:])
+}
+
+// denied returns whether the content at the segments of rest under the
+// CID or name is blocked by the rules.
+func (r *rules) denied(paths map[string]bool, key string, rest []string) bool {
+	for i := 0; i <= len(rest); i++ {
+		p := strings.Join(rest[:i], "/")
+		if paths[p] {
+			return true
+		}
+		if len(r.hashes) > 0 && r.hashes[DoubleHash(key, p)] {
+			return true
+		}
+	}
+	return false
+}
+
+type fileState struct {
+	modtime time.Time
+	size    int64
+}
+
+// Denylist blocks the content listed in a set of files. The zero value, and
+// a nil Denylist, block nothing.
+type Denylist struct {
+	files []string
+
+	lk     sync.RWMutex
+	rules  *rules
+	states map[string]fileState
+}
+
+// New loads a denylist from the given files.
+func New(files ...string) (*Denylist, error) {
+	d := &Denylist{files: files, rules: newRules()}
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Reload loads the files of the denylist again. The previous entries are
+// kept if one of the files is invalid, until the files change again.
+func (d *Denylist) Reload() error {
+	rs := newRules()
+	states := make(map[string]fileState, len(d.files))
+	var rerr error
+	for _, name := range d.files {
+		if err := loadFile(name, rs, states); err != nil && rerr == nil {
+			rerr = fmt.Errorf("denylist %s: %s", name, err)
+		}
+	}
+
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	d.states = states
+	if rerr != nil {
+		return rerr
+	}
+	d.rules = rs
+	return nil
+}
+
+func loadFile(name string, rs *rules, states map[string]fileState) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	states[name] = fileState{fi.ModTime(), fi.Size()}
+
+	frs, err := parse(f)
+	if err != nil {
+		return err
+	}
+	rs.merge(frs)
+	return nil
+}
+
+// changed returns whether one of the files changed since it was loaded.
+func (d *Denylist) changed() bool {
+	d.lk.RLock()
+	defer d.lk.RUnlock()
+	for _, name := range d.files {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return true
+		}
+		if st, ok := d.states[name]; !ok || !st.modtime.Equal(fi.ModTime()) || st.size != fi.Size() {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reloads the files of the denylist when they change, checking them
+// at the given interval until ctx is done.
+func (d *Denylist) Watch(ctx context.Context, interval time.Duration) {
+	if d == nil || len(d.files) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !d.changed() {
+				continue
+			}
+			if err := d.Reload(); err != nil {
+				log.Errorf("failed to reload the denylist: %s", err)
+				continue
+			}
+			log.Info("reloaded the denylist")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// IsPathDenied returns whether the content at an /ipfs/ or /ipns/ path is
+// blocked. Paths that can't be parsed aren't.
+func (d *Denylist) IsPathDenied(p string) bool {
+	if d == nil {
+		return false
+	}
+	parsed, err := gopath.ParsePath(p)
+	if err != nil {
+		return false
+	}
+	segs := parsed.Segments()
+	if len(segs) < 2 {
+		return false
+	}
+
+	d.lk.RLock()
+	defer d.lk.RUnlock()
+	if d.rules == nil {
+		return false
+	}
+	rest := cleanPath(strings.Join(segs[2:], "/"))
+	switch segs[0] {
+	case "ipfs":
+		c, err := cid.Decode(segs[1])
+		if err != nil {
+			return false
+		}
+		return d.rules.denied(d.rules.cids[string(c.Hash())], segs[1], rest)
+	case "ipns":
+		if c, err := cid.Decode(segs[1]); err == nil {
+			// the name is a key, which may be listed as a CID too
+			if d.rules.denied(d.rules.cids[string(c.Hash())], segs[1], rest) {
+				return true
+			}
+		}
+		name := normalizeName(segs[1])
+		return d.rules.denied(d.rules.names[name], name, rest)
+	}
+	return false
+}
+
+// IsCidDenied returns whether the CID is blocked.
+func (d *Denylist) IsCidDenied(c cid.Cid) bool {
+	if d == nil {
+		return false
+	}
+
+	d.lk.RLock()
+	defer d.lk.RUnlock()
+	if d.rules == nil {
+		return false
+	}
+	return d.rules.denied(d.rules.cids[string(c.Hash())], c.String(), nil)
+}
@@ -0,0 +1,140 @@
+package denylist
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+const (
+	emptyDir = "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"
+	other    = "QmWATWQ7fVPP2EFGu71UkfnqhYXDYH566qy47CnJDgvs8u"
+	hashed   = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+)
+
+func mustCid(t *testing.T, s string) cid.Cid {
+	t.Helper()
+	c, err := cid.Decode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "denylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the CIDv1 of the same content
+	emptyDirV1 := cid.NewCidV1(cid.DagProtobuf, mustCid(t, emptyDir).Hash()).String()
+
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	writeFile(t, a, `
+# whole CIDs, with and without the /ipfs/ prefix
+/ipfs/`+emptyDirV1+`
+`+other+`/secret/
+
+/ipns/Example.com/private
+//`+DoubleHash(hashed, "")+`
+//`+DoubleHash("hidden.example.com", "a/b")+`
+`)
+	writeFile(t, b, "/ipns/blocked.example.com\n")
+
+	d, err := New(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for p, denied := range map[string]bool{
+		"/ipfs/" + emptyDir:                    true,
+		"/ipfs/" + emptyDir + "/some/path":     true,
+		emptyDirV1:                             true,
+		"/ipfs/" + other:                       false,
+		"/ipfs/" + other + "/secret":           true,
+		"/ipfs/" + other + "/secret/file":      true,
+		"/ipfs/" + other + "/secretive":        false,
+		"/ipfs/" + other + "/public":           false,
+		"/ipns/example.com":                    false,
+		"/ipns/example.com/private/page.html":  true,
+		"/ipns/blocked.example.com":            true,
+		"/ipns/blocked.example.com/index.html": true,
+		"/ipfs/" + hashed:                      true,
+		"/ipfs/" + hashed + "/file":            true,
+		"/ipns/hidden.example.com/a":           false,
+		"/ipns/hidden.example.com/a/b/c":       true,
+		"/ipfs/not-a-cid":                      false,
+		"/ipfs":                                false,
+	} {
+		if d.IsPathDenied(p) != denied {
+			t.Errorf("%s should be denied: %t", p, denied)
+		}
+	}
+
+	for c, denied := range map[string]bool{
+		emptyDir: true,
+		other:    false,
+		hashed:   true,
+	} {
+		if d.IsCidDenied(mustCid(t, c)) != denied {
+			t.Errorf("%s should be denied: %t", c, denied)
+		}
+	}
+
+	var nilList *Denylist
+	if nilList.IsPathDenied("/ipfs/"+emptyDir) || new(Denylist).IsCidDenied(mustCid(t, emptyDir)) {
+		t.Error("empty denylists shouldn't block anything")
+	}
+
+	writeFile(t, b, "/ipns/other.example.com\nnot-a-cid\n")
+	if err := d.Reload(); err == nil {
+		t.Error("invalid entries should be reported")
+	}
+	if !d.IsPathDenied("/ipns/blocked.example.com") {
+		t.Error("the previous entries should be kept when the files are invalid")
+	}
+	if _, err := New(filepath.Join(dir, "missing")); err == nil {
+		t.Error("missing files should be reported")
+	}
+}
+
+func TestDenylistWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "denylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "denylist")
+	writeFile(t, name, "")
+	d, err := New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Watch(ctx, 10*time.Millisecond)
+
+	writeFile(t, name, other+"\n")
+	for i := 0; !d.IsCidDenied(mustCid(t, other)); i++ {
+		if i == 100 {
+			t.Fatal("the denylist wasn't reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
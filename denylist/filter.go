@@ -0,0 +1,222 @@
+package denylist
+
+import (
+	"context"
+	"fmt"
+	gopath "path"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	ipld "github.com/ipfs/go-ipld-format"
+	mdag "github.com/ipfs/go-merkledag"
+	ft "github.com/ipfs/go-unixfs"
+	uio "github.com/ipfs/go-unixfs/io"
+)
+
+// isDenied returns whether the content at any of the paths, or its CID, is
+// blocked.
+func (d *Denylist) isDenied(c cid.Cid, paths []string) bool {
+	for _, p := range paths {
+		if d.IsPathDenied(p) {
+			return true
+		}
+	}
+	return d.IsCidDenied(c)
+}
+
+// links returns the CIDs of the entries of the unixfs directory nd by name,
+// or nil if nd isn't a directory.
+func links(ctx context.Context, dag ipld.DAGService, nd ipld.Node) (map[string]cid.Cid, error) {
+	fsn, err := ft.ExtractFSNode(nd)
+	if err != nil || (fsn.Type() != ft.TDirectory && fsn.Type() != ft.THAMTShard) {
+		return nil, nil
+	}
+	dir, err := uio.NewDirectoryFromNode(dag, nd)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]cid.Cid)
+	err = dir.ForEachLink(ctx, func(l *ipld.Link) error {
+		out[l.Name] = l.Cid
+		return nil
+	})
+	return out, err
+}
+
+// joinPaths returns the paths of the entry of the directory at the paths.
+func joinPaths(paths []string, name string) []string {
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		out[i] = gopath.Join(p, name)
+	}
+	return out
+}
+
+// FilterDirectory returns the directory with the given CID, reached through
+// the given paths, without the entries blocked by the denylist at any depth:
+// the entries under blocked paths, and those whose CIDs are blocked.
+func (d *Denylist) FilterDirectory(ctx context.Context, dag ipld.DAGService, dir files.Directory, c cid.Cid, paths ...string) files.Directory {
+	if d == nil {
+		return dir
+	}
+	return &allowedDirectory{Directory: dir, ctx: ctx, dag: dag, denylist: d, cid: c, paths: paths}
+}
+
+// allowedDirectory is a directory without the entries blocked by the
+// denylist.
+type allowedDirectory struct {
+	files.Directory
+	ctx      context.Context
+	dag      ipld.DAGService
+	denylist *Denylist
+
+	cid   cid.Cid
+	paths []string
+}
+
+func (d *allowedDirectory) Entries() files.DirIterator {
+	return &allowedIterator{DirIterator: d.Directory.Entries(), dir: d}
+}
+
+type allowedIterator struct {
+	files.DirIterator
+	dir *allowedDirectory
+
+	// links are the CIDs of the entries, loaded with the first one
+	links map[string]cid.Cid
+	cid   cid.Cid
+	err   error
+}
+
+func (it *allowedIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	for it.DirIterator.Next() {
+		if it.links == nil {
+			nd, err := it.dir.dag.Get(it.dir.ctx, it.dir.cid)
+			if err == nil {
+				it.links, err = links(it.dir.ctx, it.dir.dag, nd)
+			}
+			if err == nil && it.links == nil {
+				err = fmt.Errorf("%s is not a directory", it.dir.cid)
+			}
+			if err != nil {
+				it.err = err
+				return false
+			}
+		}
+
+		c, ok := it.links[it.Name()]
+		if !ok {
+			it.err = fmt.Errorf("no link named %q under %s", it.Name(), it.dir.cid)
+			return false
+		}
+		if !it.dir.denylist.isDenied(c, joinPaths(it.dir.paths, it.Name())) {
+			it.cid = c
+			return true
+		}
+	}
+	return false
+}
+
+func (it *allowedIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.DirIterator.Err()
+}
+
+func (it *allowedIterator) Node() files.Node {
+	if sub, ok := it.DirIterator.Node().(files.Directory); ok {
+		return &allowedDirectory{
+			Directory: sub,
+			ctx:       it.dir.ctx,
+			dag:       it.dir.dag,
+			denylist:  it.dir.denylist,
+			cid:       it.cid,
+			paths:     joinPaths(it.dir.paths, it.Name()),
+		}
+	}
+	return it.DirIterator.Node()
+}
+
+// NodeGetter returns a node getter for walking the DAG under root, reached
+// through the given paths, failing with ErrBlocked to get the nodes blocked
+// by the denylist: the nodes whose CIDs are blocked, and the unixfs entries
+// under blocked paths. The DAG must be walked from its root, and parents
+// before their children.
+func (d *Denylist) NodeGetter(ctx context.Context, dag ipld.DAGService, root cid.Cid, paths ...string) ipld.NodeGetter {
+	ng := mdag.NewSession(ctx, dag)
+	if d == nil {
+		return ng
+	}
+	return &deniedGetter{
+		NodeGetter: ng,
+		dag:        dag,
+		denylist:   d,
+		paths:      map[cid.Cid][]string{root: paths},
+		denied:     cid.NewSet(),
+	}
+}
+
+type deniedGetter struct {
+	ipld.NodeGetter
+	dag      ipld.DAGService
+	denylist *Denylist
+
+	lk sync.Mutex
+	// paths are the paths of the unixfs entries not walked yet
+	paths  map[cid.Cid][]string
+	denied *cid.Set
+}
+
+func (g *deniedGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	g.lk.Lock()
+	paths := g.paths[c]
+	delete(g.paths, c)
+	denied := g.denied.Has(c)
+	g.lk.Unlock()
+
+	if denied || g.denylist.isDenied(c, paths) {
+		return nil, fmt.Errorf("%s: %w", c, ErrBlocked)
+	}
+	nd, err := g.NodeGetter.Get(ctx, c)
+	if err != nil || len(paths) == 0 {
+		return nd, err
+	}
+
+	// the paths of the entries of directories are known from their names
+	entries, err := links(ctx, g.dag, nd)
+	if err != nil {
+		return nil, err
+	}
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	for name, ec := range entries {
+		epaths := joinPaths(paths, name)
+		if g.denylist.isDenied(ec, epaths) {
+			g.denied.Add(ec)
+			continue
+		}
+		g.paths[ec] = append(g.paths[ec], epaths...)
+	}
+	return nd, nil
+}
+
+func (g *deniedGetter) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	out := make(chan *ipld.NodeOption, len(cids))
+	go func() {
+		defer close(out)
+		for _, c := range cids {
+			nd, err := g.Get(ctx, c)
+			select {
+			case out <- &ipld.NodeOption{Node: nd, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,163 @@
+package denylist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	unixfile "github.com/ipfs/go-unixfs/file"
+	uio "github.com/ipfs/go-unixfs/io"
+	gocar "github.com/ipld/go-car"
+)
+
+// testDir is a directory with public and private files, and a subdirectory
+// with child and other files.
+type testDir struct {
+	dserv ipld.DAGService
+	root  cid.Cid
+	child cid.Cid
+}
+
+func newTestDir(t *testing.T, ctx context.Context) *testDir {
+	t.Helper()
+	dserv := mdtest.Mock()
+
+	newDir := func(entries map[string]ipld.Node) ipld.Node {
+		dir := uio.NewDirectory(dserv)
+		for name, nd := range entries {
+			if err := dserv.Add(ctx, nd); err != nil {
+				t.Fatal(err)
+			}
+			if err := dir.AddChild(ctx, name, nd); err != nil {
+				t.Fatal(err)
+			}
+		}
+		nd, err := dir.GetNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+
+	child := dag.NewRawNode([]byte("child"))
+	root := newDir(map[string]ipld.Node{
+		"public":  dag.NewRawNode([]byte("public")),
+		"private": dag.NewRawNode([]byte("private")),
+		"sub": newDir(map[string]ipld.Node{
+			"child": child,
+			"other": dag.NewRawNode([]byte("other")),
+		}),
+	})
+	return &testDir{dserv: dserv, root: root.Cid(), child: child.Cid()}
+}
+
+// newTestDenylist loads a denylist with the given entries.
+func newTestDenylist(t *testing.T, entries string) *Denylist {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "denylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	list := filepath.Join(dir, "list")
+	writeFile(t, list, entries)
+	d, err := New(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// walkNames returns the paths of the entries of the directory.
+func walkNames(t *testing.T, dir files.Directory, prefix string) []string {
+	t.Helper()
+	var names []string
+	it := dir.Entries()
+	for it.Next() {
+		name := prefix + it.Name()
+		names = append(names, name)
+		if sub, ok := it.Node().(files.Directory); ok {
+			names = append(names, walkNames(t, sub, name+"/")...)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestFilterDirectory(t *testing.T) {
+	ctx := context.Background()
+	td := newTestDir(t, ctx)
+	d := newTestDenylist(t, fmt.Sprintf("/ipfs/%s/private\n%s\n", td.root, td.child))
+
+	rootNode, err := td.dserv.Get(ctx, td.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := unixfile.NewUnixfsFile(ctx, td.dserv, rootNode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := d.FilterDirectory(ctx, td.dserv, f.(files.Directory), td.root, "/ipfs/"+td.root.String())
+	names := walkNames(t, dir, "")
+	sort.Strings(names)
+	expected := []string{"public", "sub", "sub/other"}
+	if fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Fatalf("expected the entries %v, got %v", expected, names)
+	}
+}
+
+func TestNodeGetter(t *testing.T) {
+	ctx := context.Background()
+	td := newTestDir(t, ctx)
+	rootPath := "/ipfs/" + td.root.String()
+
+	// DAGs with blocked content can't be exported, whether the content is
+	// listed by its path or its CID
+	for _, entries := range []string{
+		fmt.Sprintf("%s/private\n", rootPath),
+		fmt.Sprintf("%s\n", td.child),
+	} {
+		ng := newTestDenylist(t, entries).NodeGetter(ctx, td.dserv, td.root, rootPath)
+		if err := gocar.WriteCar(ctx, ng, []cid.Cid{td.root}, ioutil.Discard); !errors.Is(err, ErrBlocked) {
+			t.Fatalf("%q: expected the export to be blocked, got %v", entries, err)
+		}
+	}
+
+	// unless it's not under the exported DAG
+	rootNode, err := td.dserv.Get(ctx, td.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, _, err := rootNode.ResolveLink([]string{"sub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newTestDenylist(t, fmt.Sprintf("%s/private\n", rootPath))
+	ng := d.NodeGetter(ctx, td.dserv, sub.Cid, rootPath+"/sub")
+	if err := gocar.WriteCar(ctx, ng, []cid.Cid{sub.Cid}, ioutil.Discard); err != nil {
+		t.Fatalf("expected the export to succeed, got %v", err)
+	}
+
+	// a nil denylist blocks nothing
+	ng = (*Denylist)(nil).NodeGetter(ctx, td.dserv, td.root, rootPath)
+	if err := gocar.WriteCar(ctx, ng, []cid.Cid{td.root}, ioutil.Discard); err != nil {
+		t.Fatalf("expected the export to succeed, got %v", err)
+	}
+}
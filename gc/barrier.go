@@ -0,0 +1,114 @@
+package gc
+
+import (
+	"errors"
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// ErrGCInProgress is returned when starting a concurrent garbage collection
+// while another one is still running.
+var ErrGCInProgress = errors.New("a concurrent garbage collection is already running")
+
+// WriteBarrier records the blocks accessed through the blockstores it wraps
+// while a concurrent garbage collection is running, so that the sweep phase
+// doesn't delete blocks that were written, or that became reachable, after
+// the marking started.
+//
+// Blocks are tracked by multihash so that CIDv0 and CIDv1 accesses to the same
+// block are treated alike.
+type WriteBarrier struct {
+	lk      sync.Mutex
+	touched map[string]struct{} // nil when no GC is running
+}
+
+// NewWriteBarrier creates a new, inactive, WriteBarrier.
+func NewWriteBarrier() *WriteBarrier {
+	return &WriteBarrier{}
+}
+
+// Wrap returns a blockstore recording the blocks read and written through it
+// while the barrier is active.
+func (wb *WriteBarrier) Wrap(bs bstore.Blockstore) bstore.Blockstore {
+	return &barrierBlockstore{Blockstore: bs, wb: wb}
+}
+
+func (wb *WriteBarrier) begin() error {
+	wb.lk.Lock()
+	defer wb.lk.Unlock()
+
+	if wb.touched != nil {
+		return ErrGCInProgress
+	}
+	wb.touched = make(map[string]struct{})
+	return nil
+}
+
+func (wb *WriteBarrier) end() {
+	wb.lk.Lock()
+	wb.touched = nil
+	wb.lk.Unlock()
+}
+
+func (wb *WriteBarrier) record(cids ...cid.Cid) {
+	wb.lk.Lock()
+	defer wb.lk.Unlock()
+
+	if wb.touched == nil {
+		return
+	}
+	for _, c := range cids {
+		wb.touched[string(c.Hash())] = struct{}{}
+	}
+}
+
+// deleteUntouched calls del on the given block unless it has been accessed
+// since the barrier was activated. Accesses are recorded before they reach the
+// underlying blockstore, so holding the lock while deleting guarantees that
+// any concurrent access either is seen here or happens after the deletion.
+func (wb *WriteBarrier) deleteUntouched(c cid.Cid, del func(cid.Cid) error) (bool, error) {
+	wb.lk.Lock()
+	defer wb.lk.Unlock()
+
+	if _, ok := wb.touched[string(c.Hash())]; ok {
+		return false, nil
+	}
+	return true, del(c)
+}
+
+type barrierBlockstore struct {
+	bstore.Blockstore
+	wb *WriteBarrier
+}
+
+func (bs *barrierBlockstore) Has(c cid.Cid) (bool, error) {
+	bs.wb.record(c)
+	return bs.Blockstore.Has(c)
+}
+
+func (bs *barrierBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	bs.wb.record(c)
+	return bs.Blockstore.Get(c)
+}
+
+func (bs *barrierBlockstore) GetSize(c cid.Cid) (int, error) {
+	bs.wb.record(c)
+	return bs.Blockstore.GetSize(c)
+}
+
+func (bs *barrierBlockstore) Put(b blocks.Block) error {
+	bs.wb.record(b.Cid())
+	return bs.Blockstore.Put(b)
+}
+
+func (bs *barrierBlockstore) PutMany(blks []blocks.Block) error {
+	cids := make([]cid.Cid, len(blks))
+	for i, b := range blks {
+		cids[i] = b.Cid()
+	}
+	bs.wb.record(cids...)
+	return bs.Blockstore.PutMany(blks)
+}
@@ -0,0 +1,215 @@
+package gc
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	blocks "github.com/ipfs/go-block-format"
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	dstore "github.com/ipfs/go-datastore"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// DefaultAccessTrackerSize is the number of blocks whose access times an
+// AccessTracker remembers.
+const DefaultAccessTrackerSize = 1 << 18
+
+// AccessTracker records when the blocks of the blockstores it wraps were last
+// read or written, so that Evict can remove the least recently used ones
+// first.
+//
+// Access times are only kept in memory, for a bounded number of blocks, so the
+// order resets when the node restarts: blocks that haven't been used since, or
+// not recently enough to be remembered, are considered older than any other.
+type AccessTracker struct {
+	last *lru.Cache // unix nanoseconds, by multihash
+
+	now func() time.Time
+}
+
+// NewAccessTracker creates a new AccessTracker remembering the access times of
+// the DefaultAccessTrackerSize most recently used blocks.
+func NewAccessTracker() *AccessTracker {
+	return newAccessTracker(DefaultAccessTrackerSize)
+}
+
+func newAccessTracker(size int) *AccessTracker {
+	last, err := lru.New(size)
+	if err != nil {
+		// only fails on non-positive sizes
+		panic(err)
+	}
+	return &AccessTracker{
+		last: last,
+		now:  time.Now,
+	}
+}
+
+// Wrap returns a blockstore recording accesses to the blocks read and written
+// through it.
+func (at *AccessTracker) Wrap(bs bstore.Blockstore) bstore.Blockstore {
+	return &trackingBlockstore{Blockstore: bs, at: at}
+}
+
+// LastAccess returns the last time the given block was accessed, or the zero
+// time if it hasn't been accessed recently since the node started.
+func (at *AccessTracker) LastAccess(c cid.Cid) time.Time {
+	t, ok := at.last.Peek(string(c.Hash()))
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(0, t.(int64))
+}
+
+func (at *AccessTracker) touch(cids ...cid.Cid) {
+	now := at.now().UnixNano()
+	for _, c := range cids {
+		at.last.Add(string(c.Hash()), now)
+	}
+}
+
+func (at *AccessTracker) forget(c cid.Cid) {
+	at.last.Remove(string(c.Hash()))
+}
+
+type trackingBlockstore struct {
+	bstore.Blockstore
+	at *AccessTracker
+}
+
+func (bs *trackingBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	b, err := bs.Blockstore.Get(c)
+	if err == nil {
+		bs.at.touch(c)
+	}
+	return b, err
+}
+
+func (bs *trackingBlockstore) Put(b blocks.Block) error {
+	err := bs.Blockstore.Put(b)
+	if err == nil {
+		bs.at.touch(b.Cid())
+	}
+	return err
+}
+
+func (bs *trackingBlockstore) PutMany(blks []blocks.Block) error {
+	err := bs.Blockstore.PutMany(blks)
+	if err == nil {
+		cids := make([]cid.Cid, len(blks))
+		for i, b := range blks {
+			cids[i] = b.Cid()
+		}
+		bs.at.touch(cids...)
+	}
+	return err
+}
+
+func (bs *trackingBlockstore) DeleteBlock(c cid.Cid) error {
+	err := bs.Blockstore.DeleteBlock(c)
+	if err == nil {
+		bs.at.forget(c)
+	}
+	return err
+}
+
+type evictionCandidate struct {
+	key  cid.Cid
+	size uint64
+	last time.Time
+}
+
+// Evict removes blocks that GC would remove, least recently used first, until
+// at least toFree bytes of blocks have been removed. Blocks that are pinned or
+// reachable from the best effort roots are never removed.
+func Evict(ctx context.Context, bs bstore.GCBlockstore, at *AccessTracker, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid, toFree uint64) <-chan Result {
+	ctx, cancel := context.WithCancel(ctx)
+
+	unlocker := bs.GCLock()
+
+	bsrv := bserv.New(bs, offline.Exchange(bs))
+	ds := dag.NewDAGService(bsrv)
+
+	output := make(chan Result, 128)
+
+	go func() {
+		defer cancel()
+		defer close(output)
+		defer unlocker.Unlock()
+
+		sendErr := func(err error) {
+			select {
+			case output <- Result{Error: err}:
+			case <-ctx.Done():
+			}
+		}
+
+		gcs, err := ColoredSet(ctx, pn, ds, bestEffortRoots, output)
+		if err != nil {
+			sendErr(err)
+			return
+		}
+		keychan, err := bs.AllKeysChan(ctx)
+		if err != nil {
+			sendErr(err)
+			return
+		}
+
+		var candidates []evictionCandidate
+		for k := range keychan {
+			if gcs.Has(k) {
+				continue
+			}
+			size, err := bs.GetSize(k)
+			if err != nil {
+				continue
+			}
+			candidates = append(candidates, evictionCandidate{
+				key:  k,
+				size: uint64(size),
+				last: at.LastAccess(k),
+			})
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].last.Before(candidates[j].last)
+		})
+
+		var freed uint64
+		evicted := make(chan cid.Cid)
+		go func() {
+			defer close(evicted)
+			for _, c := range candidates {
+				if freed >= toFree {
+					return
+				}
+				select {
+				case evicted <- c.key:
+				case <-ctx.Done():
+					return
+				}
+				freed += c.size
+			}
+		}()
+
+		remove := func(k cid.Cid) (bool, error) {
+			return true, bs.DeleteBlock(k)
+		}
+		if !sweep(ctx, evicted, cid.NewSet(), remove, output) {
+			return
+		}
+
+		collectGarbage(ctx, dstor, output)
+	}()
+
+	return output
+}
@@ -0,0 +1,107 @@
+package gc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func TestEvictLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+
+	clock := time.Unix(1000, 0)
+	at := NewAccessTracker()
+	at.now = func() time.Time { return clock }
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	raw := bstore.NewBlockstore(dstore)
+	bs := bstore.NewGCBlockstore(at.Wrap(raw), bstore.NewGCLocker())
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pn := pin.NewPinner(dstore, dserv, dserv)
+
+	// never accessed through the tracker, so the least recently used
+	untracked := dag.NewRawNode([]byte("untracked"))
+	if err := raw.Put(untracked); err != nil {
+		t.Fatal(err)
+	}
+
+	var nodes []*dag.RawNode
+	for _, data := range []string{"pinned", "old", "recent", "hot"} {
+		nd := dag.NewRawNode([]byte(data))
+		if err := bs.Put(nd); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, nd)
+		clock = clock.Add(time.Minute)
+	}
+	pinned, old, recent, hot := nodes[0], nodes[1], nodes[2], nodes[3]
+
+	// reading a block makes it recently used
+	if _, err := bs.Get(old.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pn.Pin(ctx, pinned, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := pn.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	toFree := uint64(len(untracked.RawData()) + len(recent.RawData()))
+	removed := make(map[cid.Cid]bool)
+	for res := range Evict(ctx, bs, at, dstore, pn, nil, toFree) {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		removed[res.KeyRemoved] = true
+	}
+
+	if len(removed) != 2 || !removed[untracked.Cid()] || !removed[recent.Cid()] {
+		t.Fatalf("expected the two least recently used blocks to be evicted, got %v", removed)
+	}
+	for _, nd := range []*dag.RawNode{pinned, old, hot} {
+		if has, _ := bs.Has(nd.Cid()); !has {
+			t.Fatalf("block %s should not have been evicted", nd.Cid())
+		}
+	}
+	if !at.LastAccess(recent.Cid()).IsZero() {
+		t.Fatal("evicted blocks should be forgotten by the tracker")
+	}
+}
+
+func TestAccessTrackerBounded(t *testing.T) {
+	clock := time.Unix(1000, 0)
+	at := newAccessTracker(2)
+	at.now = func() time.Time { return clock }
+
+	bs := at.Wrap(bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore())))
+	var nodes []*dag.RawNode
+	for _, data := range []string{"first", "second", "third"} {
+		nd := dag.NewRawNode([]byte(data))
+		if err := bs.Put(nd); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, nd)
+		clock = clock.Add(time.Minute)
+	}
+
+	// the least recently used block is forgotten, and so the first evicted
+	if !at.LastAccess(nodes[0].Cid()).IsZero() {
+		t.Fatal("expected the least recently used block to be forgotten")
+	}
+	for _, nd := range nodes[1:] {
+		if at.LastAccess(nd.Cid()).IsZero() {
+			t.Fatalf("expected the access time of %s to be kept", nd.Cid())
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package gc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// RootKind is the kind of root that keeps a block from being collected.
+type RootKind string
+
+// The kinds of roots walked by the garbage collector, in the order they are
+// walked.
+const (
+	RecursivePin   RootKind = "recursive"
+	BestEffortRoot RootKind = "mfs"
+	DirectPin      RootKind = "direct"
+	InternalPin    RootKind = "internal"
+)
+
+// PathStep is a link followed from a root towards a kept block.
+type PathStep struct {
+	Name string `json:",omitempty"`
+	Cid  cid.Cid
+}
+
+// Reason explains why the garbage collector keeps a block.
+type Reason struct {
+	Kind RootKind
+	Root cid.Cid
+
+	// Path lists the links followed from Root to reach the block. It is
+	// empty when the block is the root itself.
+	Path []PathStep `json:",omitempty"`
+}
+
+// Explain returns the reason why the given block would be kept by GC, walking
+// the roots exactly like ColoredSet does, or nil if it would be removed. When
+// the block is reachable from several roots, the first one found is
+// reported.
+func Explain(ctx context.Context, bs bstore.Blockstore, pn pin.Pinner, bestEffortRoots []cid.Cid, c cid.Cid) (*Reason, error) {
+	has, err := bs.Has(c)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, fmt.Errorf("block %s is not in the local repo", c)
+	}
+
+	bsrv := bserv.New(bs, offline.Exchange(bs))
+	ds := dag.NewDAGService(bsrv)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// individual errors are summarized by the error colorSet returns
+	output := make(chan Result)
+	go func() {
+		for range output {
+		}
+	}()
+	defer close(output)
+
+	tr := newTracer()
+	if err := colorSet(ctx, pn, ds, bestEffortRoots, cid.NewSet(), tr, output); err != nil {
+		return nil, err
+	}
+
+	return tr.reason(c), nil
+}
+
+type parentLink struct {
+	parent cid.Cid
+	name   string
+}
+
+// tracer records, during a colorSet walk, how each node was first reached:
+// as a root, or from a parent. Its methods are no-ops on a nil tracer.
+type tracer struct {
+	lk      sync.Mutex
+	rootsOf map[cid.Cid]RootKind
+	parents map[cid.Cid]parentLink
+}
+
+func newTracer() *tracer {
+	return &tracer{
+		rootsOf: make(map[cid.Cid]RootKind),
+		parents: make(map[cid.Cid]parentLink),
+	}
+}
+
+func (tr *tracer) roots(kind RootKind, roots []cid.Cid) {
+	if tr == nil {
+		return
+	}
+	tr.lk.Lock()
+	defer tr.lk.Unlock()
+
+	for _, r := range roots {
+		// roots reached from the roots walked before keep their parent
+		if _, ok := tr.parents[r]; ok {
+			continue
+		}
+		if _, ok := tr.rootsOf[r]; !ok {
+			tr.rootsOf[r] = kind
+		}
+	}
+}
+
+func (tr *tracer) links(parent cid.Cid, links []*ipld.Link) {
+	if tr == nil {
+		return
+	}
+	tr.lk.Lock()
+	defer tr.lk.Unlock()
+
+	for _, l := range links {
+		if _, ok := tr.parents[l.Cid]; !ok {
+			tr.parents[l.Cid] = parentLink{parent: parent, name: l.Name}
+		}
+	}
+}
+
+func (tr *tracer) reason(c cid.Cid) *Reason {
+	tr.lk.Lock()
+	defer tr.lk.Unlock()
+
+	var path []PathStep
+	// parents are recorded when the parent is walked, and a node is only
+	// walked once, so following them always ends up at a root
+	for {
+		if kind, ok := tr.rootsOf[c]; ok {
+			// path was built from the block upwards
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+			return &Reason{Kind: kind, Root: c, Path: path}
+		}
+
+		pl, ok := tr.parents[c]
+		if !ok {
+			return nil
+		}
+		path = append(path, PathStep{Name: pl.name, Cid: c})
+		c = pl.parent
+	}
+}
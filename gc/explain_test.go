@@ -0,0 +1,112 @@
+package gc
+
+import (
+	"context"
+	"testing"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func TestExplainAndDryRun(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker())
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pn := pin.NewPinner(dstore, dserv, dserv)
+
+	leaf := dag.NewRawNode([]byte("leaf"))
+	dir := new(dag.ProtoNode)
+	if err := dir.AddNodeLink("file", leaf); err != nil {
+		t.Fatal(err)
+	}
+	root := new(dag.ProtoNode)
+	if err := root.AddNodeLink("dir", dir); err != nil {
+		t.Fatal(err)
+	}
+	direct := dag.NewRawNode([]byte("direct"))
+	mfsRoot := dag.NodeWithData([]byte("mfs"))
+	garbage := dag.NewRawNode([]byte("garbage"))
+
+	err := dserv.AddMany(ctx, []ipld.Node{leaf, dir, root, direct, mfsRoot, garbage})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pn.Pin(ctx, root, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pn.Pin(ctx, direct, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := pn.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// dir is already reached from the recursive pin when mfs roots are walked
+	roots := []cid.Cid{mfsRoot.Cid(), dir.Cid()}
+
+	reason, err := Explain(ctx, bs, pn, roots, leaf.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason == nil || reason.Kind != RecursivePin || !reason.Root.Equals(root.Cid()) {
+		t.Fatalf("unexpected reason for leaf: %+v", reason)
+	}
+	if len(reason.Path) != 2 || reason.Path[0].Name != "dir" || reason.Path[1].Name != "file" || !reason.Path[1].Cid.Equals(leaf.Cid()) {
+		t.Fatalf("unexpected path for leaf: %+v", reason.Path)
+	}
+
+	reason, err = Explain(ctx, bs, pn, roots, dir.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason == nil || reason.Kind != RecursivePin || len(reason.Path) != 1 {
+		t.Fatalf("unexpected reason for dir: %+v", reason)
+	}
+
+	reason, err = Explain(ctx, bs, pn, roots, direct.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason == nil || reason.Kind != DirectPin || len(reason.Path) != 0 {
+		t.Fatalf("unexpected reason for direct pin: %+v", reason)
+	}
+
+	reason, err = Explain(ctx, bs, pn, roots, mfsRoot.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason == nil || reason.Kind != BestEffortRoot {
+		t.Fatalf("unexpected reason for mfs root: %+v", reason)
+	}
+
+	reason, err = Explain(ctx, bs, pn, roots, garbage.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason != nil {
+		t.Fatalf("garbage should not be kept, got %+v", reason)
+	}
+
+	var removed []cid.Cid
+	for res := range DryRun(ctx, bs, pn, roots) {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		removed = append(removed, res.KeyRemoved)
+	}
+	if len(removed) != 1 || !removed[0].Equals(garbage.Cid()) {
+		t.Fatalf("dry run should only report the garbage block, got %v", removed)
+	}
+	if has, _ := bs.Has(garbage.Cid()); !has {
+		t.Fatal("dry run removed a block")
+	}
+}
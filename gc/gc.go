@@ -69,65 +69,203 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 			return
 		}
 
-		errors := false
-		var removed uint64
+		remove := func(k cid.Cid) (bool, error) {
+			return true, bs.DeleteBlock(k)
+		}
+		if !sweep(ctx, keychan, gcs, remove, output) {
+			return
+		}
+
+		collectGarbage(ctx, dstor, output)
+	}()
+
+	return output
+}
 
-	loop:
-		for ctx.Err() == nil { // select may not notice that we're "done".
+// DryRun reports, as KeyRemoved results, the blocks that GC would remove if
+// it ran now, without deleting anything. As it doesn't hold the GC lock, the
+// result may be outdated by the time it is read.
+func DryRun(ctx context.Context, bs bstore.GCBlockstore, pn pin.Pinner, bestEffortRoots []cid.Cid) <-chan Result {
+	ctx, cancel := context.WithCancel(ctx)
+
+	bsrv := bserv.New(bs, offline.Exchange(bs))
+	ds := dag.NewDAGService(bsrv)
+
+	output := make(chan Result, 128)
+
+	go func() {
+		defer cancel()
+		defer close(output)
+
+		gcs, err := ColoredSet(ctx, pn, ds, bestEffortRoots, output)
+		if err != nil {
 			select {
-			case k, ok := <-keychan:
-				if !ok {
-					break loop
-				}
-				if !gcs.Has(k) {
-					err := bs.DeleteBlock(k)
-					removed++
-					if err != nil {
-						errors = true
-						select {
-						case output <- Result{Error: &CannotDeleteBlockError{k, err}}:
-						case <-ctx.Done():
-							break loop
-						}
-						// continue as error is non-fatal
-						continue loop
-					}
-					select {
-					case output <- Result{KeyRemoved: k}:
-					case <-ctx.Done():
-						break loop
-					}
-				}
+			case output <- Result{Error: err}:
 			case <-ctx.Done():
-				break loop
 			}
+			return
 		}
-		if errors {
+		keychan, err := bs.AllKeysChan(ctx)
+		if err != nil {
 			select {
-			case output <- Result{Error: ErrCannotDeleteSomeBlocks}:
+			case output <- Result{Error: err}:
 			case <-ctx.Done():
-				return
 			}
+			return
 		}
 
-		gds, ok := dstor.(dstore.GCDatastore)
-		if !ok {
-			return
+		// report blocks as removed without deleting them
+		pretend := func(k cid.Cid) (bool, error) {
+			return true, nil
 		}
+		sweep(ctx, keychan, gcs, pretend, output)
+	}()
 
-		err = gds.CollectGarbage()
-		if err != nil {
+	return output
+}
+
+// ConcurrentGC performs a mark and sweep garbage collection of the blocks in
+// the blockstore, like GC, but without blocking writes for its whole duration.
+//
+// The marked set is first computed without holding the GC lock. The lock is
+// then taken only long enough to extend it with the pins and best effort roots
+// added in the meantime. Finally, blocks are swept without the lock: the given
+// WriteBarrier, which must wrap the blockstores written to by the node,
+// records every block read or written since the collection started, and those
+// blocks are never deleted.
+func ConcurrentGC(ctx context.Context, bs bstore.GCBlockstore, wb *WriteBarrier, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots func() ([]cid.Cid, error)) <-chan Result {
+	ctx, cancel := context.WithCancel(ctx)
+
+	bsrv := bserv.New(bs, offline.Exchange(bs))
+	ds := dag.NewDAGService(bsrv)
+
+	output := make(chan Result, 128)
+
+	go func() {
+		defer cancel()
+		defer close(output)
+
+		sendErr := func(err error) {
 			select {
 			case output <- Result{Error: err}:
 			case <-ctx.Done():
 			}
+		}
+
+		if err := wb.begin(); err != nil {
+			sendErr(err)
 			return
 		}
+		defer wb.end()
+
+		roots, err := bestEffortRoots()
+		if err != nil {
+			sendErr(err)
+			return
+		}
+		gcs := cid.NewSet()
+		if err := colorSet(ctx, pn, ds, roots, gcs, nil, output); err != nil {
+			sendErr(err)
+			return
+		}
+
+		// Catch up with the pins and roots that changed while marking. Blocks
+		// that are already marked aren't walked again, so this is usually quick.
+		unlocker := bs.GCLock()
+		roots, err = bestEffortRoots()
+		if err == nil {
+			err = colorSet(ctx, pn, ds, roots, gcs, nil, output)
+		}
+		unlocker.Unlock()
+		if err != nil {
+			sendErr(err)
+			return
+		}
+
+		keychan, err := bs.AllKeysChan(ctx)
+		if err != nil {
+			sendErr(err)
+			return
+		}
+
+		remove := func(k cid.Cid) (bool, error) {
+			return wb.deleteUntouched(k, bs.DeleteBlock)
+		}
+		if !sweep(ctx, keychan, gcs, remove, output) {
+			return
+		}
+
+		collectGarbage(ctx, dstor, output)
 	}()
 
 	return output
 }
 
+// sweep removes every key read from keychan that isn't in the marked set,
+// reporting the results on output. It returns false if the context was
+// canceled before the final error could be reported.
+func sweep(ctx context.Context, keychan <-chan cid.Cid, gcs *cid.Set, remove func(cid.Cid) (bool, error), output chan<- Result) bool {
+	errors := false
+
+loop:
+	for ctx.Err() == nil { // select may not notice that we're "done".
+		select {
+		case k, ok := <-keychan:
+			if !ok {
+				break loop
+			}
+			if gcs.Has(k) {
+				continue
+			}
+			removed, err := remove(k)
+			if err != nil {
+				errors = true
+				select {
+				case output <- Result{Error: &CannotDeleteBlockError{k, err}}:
+				case <-ctx.Done():
+					break loop
+				}
+				// continue as error is non-fatal
+				continue loop
+			}
+			if !removed {
+				continue
+			}
+			select {
+			case output <- Result{KeyRemoved: k}:
+			case <-ctx.Done():
+				break loop
+			}
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	if errors {
+		select {
+		case output <- Result{Error: ErrCannotDeleteSomeBlocks}:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// collectGarbage runs the garbage collection of the datastore, if supported.
+func collectGarbage(ctx context.Context, dstor dstore.Datastore, output chan<- Result) {
+	gds, ok := dstor.(dstore.GCDatastore)
+	if !ok {
+		return
+	}
+
+	err := gds.CollectGarbage()
+	if err != nil {
+		select {
+		case output <- Result{Error: err}:
+		case <-ctx.Done():
+		}
+	}
+}
+
 // Descendants recursively finds all the descendants of the given roots and
 // adds them to the given cid.Set, using the provided dag.GetLinks function
 // to walk the tree.
@@ -170,10 +308,21 @@ func Descendants(ctx context.Context, getLinks dag.GetLinks, set *cid.Set, roots
 func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, output chan<- Result) (*cid.Set, error) {
 	// KeySet currently implemented in memory, in the future, may be bloom filter or
 	// disk backed to conserve memory.
-	errors := false
 	gcs := cid.NewSet()
+	if err := colorSet(ctx, pn, ng, bestEffortRoots, gcs, nil, output); err != nil {
+		return nil, err
+	}
+	return gcs, nil
+}
+
+// colorSet adds the nodes pinned by the given pinner to gcs. Nodes already in
+// gcs are assumed to have been colored along with their descendants, and are
+// not walked again. If tr is not nil, it records how every node was reached.
+func colorSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, gcs *cid.Set, tr *tracer, output chan<- Result) error {
+	errors := false
 	getLinks := func(ctx context.Context, cid cid.Cid) ([]*ipld.Link, error) {
 		links, err := ipld.GetLinks(ctx, ng, cid)
+		tr.links(cid, links)
 		if err != nil {
 			errors = true
 			select {
@@ -186,20 +335,22 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 	}
 	rkeys, err := pn.RecursiveKeys(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	tr.roots(RecursivePin, rkeys)
 	err = Descendants(ctx, getLinks, gcs, rkeys)
 	if err != nil {
 		errors = true
 		select {
 		case output <- Result{Error: err}:
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
 
 	bestEffortGetLinks := func(ctx context.Context, cid cid.Cid) ([]*ipld.Link, error) {
 		links, err := ipld.GetLinks(ctx, ng, cid)
+		tr.links(cid, links)
 		if err != nil && err != ipld.ErrNotFound {
 			errors = true
 			select {
@@ -210,43 +361,46 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 		}
 		return links, nil
 	}
+	tr.roots(BestEffortRoot, bestEffortRoots)
 	err = Descendants(ctx, bestEffortGetLinks, gcs, bestEffortRoots)
 	if err != nil {
 		errors = true
 		select {
 		case output <- Result{Error: err}:
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
 
 	dkeys, err := pn.DirectKeys(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	tr.roots(DirectPin, dkeys)
 	for _, k := range dkeys {
 		gcs.Add(k)
 	}
 
 	ikeys, err := pn.InternalPins(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	tr.roots(InternalPin, ikeys)
 	err = Descendants(ctx, getLinks, gcs, ikeys)
 	if err != nil {
 		errors = true
 		select {
 		case output <- Result{Error: err}:
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
 
 	if errors {
-		return nil, ErrCannotFetchAllLinks
+		return ErrCannotFetchAllLinks
 	}
 
-	return gcs, nil
+	return nil
 }
 
 // ErrCannotFetchAllLinks is returned as the last Result in the GC output
@@ -0,0 +1,433 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryptedKeyMagic prefixes every key file written by an EncryptedKeystore.
+// It allows telling encrypted and plaintext key files apart, so that an
+// interrupted migration can be resumed.
+var encryptedKeyMagic = []byte("IPFSKEY1")
+
+// paramsFilename is the file holding the key derivation parameters of an
+// EncryptedKeystore, relative to the keystore directory.
+const paramsFilename = ".encryption"
+
+// checkPlaintext is sealed with the derived key to verify passphrases.
+var checkPlaintext = []byte("ipfs keystore")
+
+// Default scrypt parameters used when creating a new EncryptedKeystore.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// ErrBadPassphrase is returned when an EncryptedKeystore can't be unlocked
+// with the given passphrase.
+var ErrBadPassphrase = errors.New("incorrect keystore passphrase")
+
+// ErrNotEncrypted is returned by an EncryptedKeystore when it finds a
+// plaintext key that has not been migrated yet.
+var ErrNotEncrypted = errors.New("key is stored in plaintext, run 'ipfs repo encrypt-keystore'")
+
+// PassphraseFunc returns the passphrase protecting an EncryptedKeystore.
+type PassphraseFunc func() ([]byte, error)
+
+// encryptionParams are persisted next to the keys of an EncryptedKeystore.
+type encryptionParams struct {
+	KDF   string
+	N     int
+	R     int
+	P     int
+	Salt  []byte
+	Check []byte
+}
+
+// EncryptedKeystore is a keystore backed by files in a given directory,
+// where every key is encrypted with a key derived from a passphrase.
+//
+// The passphrase is only requested, through the PassphraseFunc, the first
+// time a key needs to be read or written, or when Unlock is called.
+type EncryptedKeystore struct {
+	dir        string
+	passphrase PassphraseFunc
+
+	lk   sync.Mutex
+	aead cipher.AEAD
+}
+
+// NewEncryptedKeystore returns a new encrypted filesystem-backed keystore.
+func NewEncryptedKeystore(dir string, passphrase PassphraseFunc) (*EncryptedKeystore, error) {
+	err := os.Mkdir(dir, 0700)
+	switch {
+	case os.IsExist(err):
+	case err == nil:
+	default:
+		return nil, err
+	}
+	return &EncryptedKeystore{dir: dir, passphrase: passphrase}, nil
+}
+
+// Unlock derives the encryption key from the passphrase. It is a no-op if the
+// keystore is already unlocked.
+func (ks *EncryptedKeystore) Unlock() error {
+	_, err := ks.cipher()
+	return err
+}
+
+func (ks *EncryptedKeystore) cipher() (cipher.AEAD, error) {
+	ks.lk.Lock()
+	defer ks.lk.Unlock()
+
+	if ks.aead != nil {
+		return ks.aead, nil
+	}
+
+	if ks.passphrase == nil {
+		return nil, fmt.Errorf("no passphrase available to unlock the keystore")
+	}
+	pass, err := ks.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if len(pass) == 0 {
+		return nil, fmt.Errorf("keystore passphrase must not be empty")
+	}
+
+	aead, err := openEncryptionParams(ks.dir, pass)
+	if err != nil {
+		return nil, err
+	}
+
+	ks.aead = aead
+	return aead, nil
+}
+
+// Has returns whether or not a key exists in the Keystore
+func (ks *EncryptedKeystore) Has(name string) (bool, error) {
+	name, err := encode(name)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(filepath.Join(ks.dir, name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Put stores a key in the Keystore, if a key with the same name already exists, returns ErrKeyExists
+func (ks *EncryptedKeystore) Put(name string, k ci.PrivKey) error {
+	fname, err := encode(name)
+	if err != nil {
+		return err
+	}
+
+	aead, err := ks.cipher()
+	if err != nil {
+		return err
+	}
+
+	b, err := ci.MarshalPrivateKey(k)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := sealKey(aead, name, b)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.OpenFile(filepath.Join(ks.dir, fname), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0400)
+	if err != nil {
+		if os.IsExist(err) {
+			err = ErrKeyExists
+		}
+		return err
+	}
+	defer fi.Close()
+
+	_, err = fi.Write(sealed)
+
+	return err
+}
+
+// Get retrieves a key from the Keystore if it exists, and returns ErrNoSuchKey
+// otherwise.
+func (ks *EncryptedKeystore) Get(name string) (ci.PrivKey, error) {
+	fname, err := encode(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(ks.dir, fname))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoSuchKey
+		}
+		return nil, err
+	}
+
+	aead, err := ks.cipher()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := openKey(aead, name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return ci.UnmarshalPrivateKey(b)
+}
+
+// Delete removes a key from the Keystore
+func (ks *EncryptedKeystore) Delete(name string) error {
+	name, err := encode(name)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(filepath.Join(ks.dir, name))
+}
+
+// List return a list of key identifier
+func (ks *EncryptedKeystore) List() ([]string, error) {
+	dir, err := os.Open(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	dirs, err := dir.Readdirnames(0)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]string, 0, len(dirs))
+
+	for _, name := range dirs {
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		decodedName, err := decode(name)
+		if err == nil {
+			list = append(list, decodedName)
+		} else {
+			log.Errorf("Ignoring keyfile with invalid encoded filename: %s", name)
+		}
+	}
+
+	return list, nil
+}
+
+// EncryptFSKeystore encrypts, in place, the plaintext keys of the FSKeystore
+// in dir so that it can be opened as an EncryptedKeystore with the given
+// passphrase. Keys that are already encrypted are left untouched, so an
+// interrupted migration can safely be run again.
+func EncryptFSKeystore(dir string, passphrase []byte) error {
+	if len(passphrase) == 0 {
+		return fmt.Errorf("keystore passphrase must not be empty")
+	}
+
+	aead, err := openEncryptionParams(dir, passphrase)
+	if err != nil {
+		return err
+	}
+
+	names, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range names {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		name, err := decode(fi.Name())
+		if err != nil {
+			log.Errorf("Ignoring keyfile with invalid encoded filename: %s", fi.Name())
+			continue
+		}
+
+		kp := filepath.Join(dir, fi.Name())
+		data, err := ioutil.ReadFile(kp)
+		if err != nil {
+			return err
+		}
+		if bytes.HasPrefix(data, encryptedKeyMagic) {
+			continue
+		}
+
+		// make sure we are not encrypting garbage
+		if _, err := ci.UnmarshalPrivateKey(data); err != nil {
+			return fmt.Errorf("key %q is not a valid private key: %s", name, err)
+		}
+
+		sealed, err := sealKey(aead, name, data)
+		if err != nil {
+			return err
+		}
+
+		if err := replaceFile(kp, sealed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replaceFile atomically replaces the file at path with a read-only file
+// holding data.
+func replaceFile(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0400); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// openEncryptionParams derives the keystore encryption key from the
+// passphrase, creating fresh parameters if the keystore has none yet.
+func openEncryptionParams(dir string, passphrase []byte) (cipher.AEAD, error) {
+	pp := filepath.Join(dir, paramsFilename)
+
+	data, err := ioutil.ReadFile(pp)
+	switch {
+	case os.IsNotExist(err):
+		return createEncryptionParams(pp, passphrase)
+	case err != nil:
+		return nil, err
+	}
+
+	var params encryptionParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, fmt.Errorf("invalid keystore encryption parameters: %s", err)
+	}
+	if params.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported keystore key derivation function %q", params.KDF)
+	}
+
+	aead, err := deriveCipher(passphrase, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := openKey(aead, paramsFilename, params.Check); err != nil {
+		return nil, ErrBadPassphrase
+	}
+
+	return aead, nil
+}
+
+func createEncryptionParams(path string, passphrase []byte) (cipher.AEAD, error) {
+	params := encryptionParams{
+		KDF:  "scrypt",
+		N:    scryptN,
+		R:    scryptR,
+		P:    scryptP,
+		Salt: make([]byte, 32),
+	}
+	if _, err := rand.Read(params.Salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := deriveCipher(passphrase, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	params.Check, err = sealKey(aead, paramsFilename, checkPlaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(&params)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0400)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+
+	if _, err := fi.Write(data); err != nil {
+		return nil, err
+	}
+
+	return aead, nil
+}
+
+func deriveCipher(passphrase []byte, params *encryptionParams) (cipher.AEAD, error) {
+	dk, err := scrypt.Key(passphrase, params.Salt, params.N, params.R, params.P, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.NewX(dk)
+}
+
+// sealKey encrypts a marshalled key, binding it to the key name.
+func sealKey(aead cipher.AEAD, name string, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(encryptedKeyMagic)+len(nonce)+len(data)+aead.Overhead())
+	out = append(out, encryptedKeyMagic...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, data, []byte(name)), nil
+}
+
+// openKey decrypts a key sealed by sealKey.
+func openKey(aead cipher.AEAD, name string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, encryptedKeyMagic) {
+		return nil, ErrNotEncrypted
+	}
+	data = data[len(encryptedKeyMagic):]
+
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted key %q is truncated", name)
+	}
+
+	b, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key %q: %s", name, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,183 @@
+package keystore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func staticPassphrase(p string) PassphraseFunc {
+	return func() ([]byte, error) {
+		return []byte(p), nil
+	}
+}
+
+func TestEncryptedKeystoreBasics(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	ks, err := NewEncryptedKeystore(tdir, staticPassphrase("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k1 := privKeyOrFatal(t)
+	k2 := privKeyOrFatal(t)
+
+	if err := ks.Put("foo", k1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("bar", k2); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("foo", k2); err != ErrKeyExists {
+		t.Fatalf("expected ErrKeyExists, got %v", err)
+	}
+
+	l, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(l)
+	if len(l) != 2 || l[0] != "bar" || l[1] != "foo" {
+		t.Fatalf("unexpected key list: %v", l)
+	}
+
+	exist, err := ks.Has("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exist {
+		t.Fatal("should know it has a key named foo")
+	}
+
+	// nothing on disk may contain the plaintext key
+	raw, err := ioutil.ReadFile(filepath.Join(tdir, "key_mzxw6"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k1b, err := k1.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, k1b) {
+		t.Fatal("key stored in plaintext")
+	}
+
+	// a fresh keystore with the same passphrase can read the key back
+	ks2, err := NewEncryptedKeystore(tdir, staticPassphrase("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ks2.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !k1.Equals(out) {
+		t.Fatal("keys do not match")
+	}
+
+	if _, err := ks2.Get("baz"); err != ErrNoSuchKey {
+		t.Fatalf("expected ErrNoSuchKey, got %v", err)
+	}
+
+	if err := ks2.Delete("bar"); err != nil {
+		t.Fatal(err)
+	}
+	if exist, _ := ks2.Has("bar"); exist {
+		t.Fatal("key should have been deleted")
+	}
+}
+
+func TestEncryptedKeystoreBadPassphrase(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	ks, err := NewEncryptedKeystore(tdir, staticPassphrase("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("foo", privKeyOrFatal(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err = NewEncryptedKeystore(tdir, staticPassphrase("battery staple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Unlock(); err != ErrBadPassphrase {
+		t.Fatalf("expected ErrBadPassphrase, got %v", err)
+	}
+	if _, err := ks.Get("foo"); err != ErrBadPassphrase {
+		t.Fatalf("expected ErrBadPassphrase, got %v", err)
+	}
+}
+
+func TestEncryptFSKeystore(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	fks, err := NewFSKeystore(tdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k1 := privKeyOrFatal(t)
+	k2 := privKeyOrFatal(t)
+	if err := fks.Put("foo", k1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fks.Put("bar", k2); err != nil {
+		t.Fatal(err)
+	}
+
+	eks, err := NewEncryptedKeystore(tdir, staticPassphrase("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := eks.Get("foo"); err != ErrNotEncrypted {
+		t.Fatalf("expected ErrNotEncrypted, got %v", err)
+	}
+
+	if err := EncryptFSKeystore(tdir, []byte("correct horse")); err != nil {
+		t.Fatal(err)
+	}
+	// running the migration again is harmless
+	if err := EncryptFSKeystore(tdir, []byte("correct horse")); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncryptFSKeystore(tdir, []byte("battery staple")); err != ErrBadPassphrase {
+		t.Fatalf("expected ErrBadPassphrase, got %v", err)
+	}
+
+	if _, err := fks.Get("foo"); err == nil {
+		t.Fatal("plaintext keystore should not be able to read encrypted keys")
+	}
+
+	out, err := eks.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !k1.Equals(out) {
+		t.Fatal("keys do not match")
+	}
+	out, err = eks.Get("bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !k2.Equals(out) {
+		t.Fatal("keys do not match")
+	}
+}
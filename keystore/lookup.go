@@ -0,0 +1,72 @@
+package keystore
+
+import (
+	"fmt"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Lookup returns the private key of the given name or peer ID among the keys
+// of the keystore and the key of the node, named "self".
+func Lookup(self ci.PrivKey, kstore Keystore, k string) (ci.PrivKey, error) {
+	////////////////////
+	// Lookup by name //
+	////////////////////
+
+	// First, lookup self.
+	if k == "self" {
+		return self, nil
+	}
+
+	// Then, look in the keystore.
+	res, err := kstore.Get(k)
+	if res != nil {
+		return res, nil
+	}
+
+	if err != nil && err != ErrNoSuchKey {
+		return nil, err
+	}
+
+	keys, err := kstore.List()
+	if err != nil {
+		return nil, err
+	}
+
+	//////////////////
+	// Lookup by ID //
+	//////////////////
+	targetPid, err := peer.Decode(k)
+	if err != nil {
+		return nil, ErrNoSuchKey
+	}
+
+	// First, check self.
+	pid, err := peer.IDFromPrivateKey(self)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine peer ID for private key: %w", err)
+	}
+	if pid == targetPid {
+		return self, nil
+	}
+
+	// Then, look in the keystore.
+	for _, key := range keys {
+		privKey, err := kstore.Get(key)
+		if err != nil {
+			return nil, err
+		}
+
+		pid, err := peer.IDFromPrivateKey(privKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if targetPid == pid {
+			return privKey, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no key by the given name or PeerID was found")
+}
@@ -0,0 +1,253 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// EncryptedPEMType is the PEM block type of password protected PKCS#8 keys.
+const EncryptedPEMType = "ENCRYPTED PRIVATE KEY"
+
+// pbkdf2Iterations is the iteration count used when encrypting keys.
+const pbkdf2Iterations = 100000
+
+// maxPBKDF2Iterations bounds the iteration count of the keys to decrypt, which
+// would otherwise let a crafted key hang the node deriving it.
+const maxPBKDF2Iterations = 10000000
+
+// ErrBadPassword is returned when an encrypted key can't be decrypted with
+// the given password.
+var ErrBadPassword = errors.New("could not decrypt key, wrong password?")
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// encryptedPrivateKeyInfo is the EncryptedPrivateKeyInfo structure of RFC 5208.
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+// pbes2Params is the PBES2-params structure of RFC 8018.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params is the PBKDF2-params structure of RFC 8018.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// MarshalEncryptedPEM encodes a private key as a PKCS#8 PEM block encrypted
+// with PBES2 (PBKDF2-HMAC-SHA256 and AES-256-CBC) using the given password.
+func MarshalEncryptedPEM(k ci.PrivKey, password []byte) ([]byte, error) {
+	if len(password) == 0 {
+		return nil, fmt.Errorf("a password is required to encrypt the key")
+	}
+
+	std, err := ci.PrivKeyToStdKey(k)
+	if err != nil {
+		return nil, err
+	}
+	// x509 expects ed25519 keys by value.
+	if edk, ok := std.(*ed25519.PrivateKey); ok {
+		std = *edk
+	}
+
+	plain, err := x509.MarshalPKCS8PrivateKey(std)
+	if err != nil {
+		return nil, fmt.Errorf("key type can't be encoded as PKCS#8: %s", err)
+	}
+
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	dk := pbkdf2.Key(password, salt, pbkdf2Iterations, 32, sha256.New)
+	block, err := aes.NewCipher(dk)
+	if err != nil {
+		return nil, err
+	}
+
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	data := append(plain, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: pbkdf2Iterations,
+		PRF: pkix.AlgorithmIdentifier{
+			Algorithm:  oidHMACWithSHA256,
+			Parameters: asn1.NullRawValue,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+
+	encParams, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBKDF2,
+			Parameters: asn1.RawValue{FullBytes: kdfParams},
+		},
+		EncryptionScheme: pkix.AlgorithmIdentifier{
+			Algorithm:  oidAES256CBC,
+			Parameters: asn1.RawValue{FullBytes: ivParam},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		EncryptionAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBES2,
+			Parameters: asn1.RawValue{FullBytes: encParams},
+		},
+		EncryptedData: data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: EncryptedPEMType, Bytes: der}), nil
+}
+
+// UnmarshalEncryptedPEM decodes a PKCS#8 PEM block encrypted with PBES2,
+// as produced by MarshalEncryptedPEM or by 'openssl pkcs8 -topk8 -v2 aes256'.
+func UnmarshalEncryptedPEM(data []byte, password []byte) (ci.PrivKey, error) {
+	blk, _ := pem.Decode(data)
+	if blk == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	if blk.Type != EncryptedPEMType {
+		return nil, fmt.Errorf("unexpected PEM block type %q, expected %q", blk.Type, EncryptedPEMType)
+	}
+
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(blk.Bytes, &info); err != nil {
+		return nil, err
+	}
+	if !info.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported key encryption scheme %s", info.EncryptionAlgorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s", params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, err
+	}
+
+	if kdf.IterationCount <= 0 || kdf.IterationCount > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("invalid key derivation iteration count %d", kdf.IterationCount)
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdf.PRF.Algorithm) == 0, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported pseudo-random function %s", kdf.PRF.Algorithm)
+	}
+
+	var keyLen int
+	switch alg := params.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keyLen = 16
+	case alg.Equal(oidAES192CBC):
+		keyLen = 24
+	case alg.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("unsupported cipher %s", alg)
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid IV length %d", len(iv))
+	}
+
+	enc := info.EncryptedData
+	if len(enc) == 0 || len(enc)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted key has invalid length")
+	}
+
+	dk := pbkdf2.Key(password, kdf.Salt, kdf.IterationCount, keyLen, prf)
+	block, err := aes.NewCipher(dk)
+	if err != nil {
+		return nil, err
+	}
+
+	plain := make([]byte, len(enc))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, enc)
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, ErrBadPassword
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, ErrBadPassword
+		}
+	}
+
+	std, err := x509.ParsePKCS8PrivateKey(plain[:len(plain)-padding])
+	if err != nil {
+		return nil, ErrBadPassword
+	}
+	// libp2p expects ed25519 keys by reference.
+	if edk, ok := std.(ed25519.PrivateKey); ok {
+		std = &edk
+	}
+
+	sk, _, err := ci.KeyPairFromStdKey(std)
+	return sk, err
+}
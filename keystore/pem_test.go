@@ -0,0 +1,112 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+func TestEncryptedPEMRoundTrip(t *testing.T) {
+	edk := privKeyOrFatal(t)
+	rsak, _, err := ci.GenerateRSAKeyPair(2048, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsak, _, err := ci.GenerateECDSAKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range []ci.PrivKey{edk, rsak, ecdsak} {
+		data, err := MarshalEncryptedPEM(k, []byte("hunter2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := UnmarshalEncryptedPEM(data, []byte("hunter2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !k.Equals(out) {
+			t.Fatal("keys do not match after round trip")
+		}
+
+		_, err = UnmarshalEncryptedPEM(data, []byte("hunter3"))
+		if err != ErrBadPassword {
+			t.Fatalf("expected ErrBadPassword, got %v", err)
+		}
+	}
+}
+
+func TestEncryptedPEMRequiresPassword(t *testing.T) {
+	_, err := MarshalEncryptedPEM(privKeyOrFatal(t), nil)
+	if err == nil {
+		t.Fatal("expected an error when encrypting without a password")
+	}
+}
+
+func TestEncryptedPEMUnsupportedKey(t *testing.T) {
+	k, _, err := ci.GenerateSecp256k1Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = MarshalEncryptedPEM(k, []byte("hunter2"))
+	if err == nil {
+		t.Fatal("expected secp256k1 keys to be rejected")
+	}
+}
+
+func TestEncryptedPEMIterationCount(t *testing.T) {
+	data, err := MarshalEncryptedPEM(privKeyOrFatal(t), []byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, count := range []int{0, -1, maxPBKDF2Iterations + 1} {
+		_, err := UnmarshalEncryptedPEM(withIterationCount(t, data, count), []byte("hunter2"))
+		if err == nil || !strings.Contains(err.Error(), "iteration count") {
+			t.Fatalf("expected an iteration count of %d to be rejected, got %v", count, err)
+		}
+	}
+}
+
+// withIterationCount re-encodes an encrypted key with another PBKDF2
+// iteration count.
+func withIterationCount(t *testing.T, data []byte, count int) []byte {
+	blk, _ := pem.Decode(data)
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(blk.Bytes, &info); err != nil {
+		t.Fatal(err)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		t.Fatal(err)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		t.Fatal(err)
+	}
+
+	kdf.IterationCount = count
+	kdfParams, err := asn1.Marshal(kdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params.KeyDerivationFunc.Parameters = asn1.RawValue{FullBytes: kdfParams}
+	encParams, err := asn1.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.EncryptionAlgorithm.Parameters = asn1.RawValue{FullBytes: encParams}
+	der, err := asn1.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: EncryptedPEMType, Bytes: der})
+}
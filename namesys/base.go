@@ -39,6 +39,26 @@ func resolve(ctx context.Context, r resolver, name string, options opts.ResolveO
 	return p, err
 }
 
+// ResolveWithTTL resolves the name like r.Resolve, also returning how long
+// the result may be cached, zero when unknown.
+func ResolveWithTTL(ctx context.Context, r Resolver, name string, options ...opts.ResolveOpt) (path.Path, time.Duration, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	err := ErrResolveFailed
+	var p path.Path
+	var ttl time.Duration
+
+	for res := range r.ResolveAsync(ctx, name, options...) {
+		p, ttl, err = res.Path, res.TTL, res.Err
+		if err != nil {
+			break
+		}
+	}
+
+	return p, ttl, err
+}
+
 func resolveAsync(ctx context.Context, r resolver, name string, options opts.ResolveOpts) <-chan Result {
 	resCh := r.resolveOnceAsync(ctx, name, options)
 	depth := options.Depth
@@ -47,6 +67,7 @@ func resolveAsync(ctx context.Context, r resolver, name string, options opts.Res
 	go func() {
 		defer close(outCh)
 		var subCh <-chan Result
+		var subTTL time.Duration
 		var cancelSub context.CancelFunc
 		defer func() {
 			if cancelSub != nil {
@@ -68,7 +89,7 @@ func resolveAsync(ctx context.Context, r resolver, name string, options opts.Res
 				}
 				log.Debugf("resolved %s to %s", name, res.value.String())
 				if !strings.HasPrefix(res.value.String(), ipnsPrefix) {
-					emitResult(ctx, outCh, Result{Path: res.value})
+					emitResult(ctx, outCh, Result{Path: res.value, TTL: res.ttl})
 					break
 				}
 
@@ -92,12 +113,19 @@ func resolveAsync(ctx context.Context, r resolver, name string, options opts.Res
 
 				p := strings.TrimPrefix(res.value.String(), ipnsPrefix)
 				subCh = resolveAsync(subCtx, r, p, subopts)
+				subTTL = res.ttl
 			case res, ok := <-subCh:
 				if !ok {
 					subCh = nil
 					break
 				}
 
+				// the result can't be cached for longer than the record
+				// pointing to it
+				if subTTL < res.TTL {
+					res.TTL = subTTL
+				}
+
 				// We don't bother returning here in case of context timeout as there is
 				// no good reason to do that, and we may still be able to emit a result
 				emitResult(ctx, outCh, res)
@@ -0,0 +1,100 @@
+package namesys
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	path "github.com/ipfs/go-path"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// DefaultBatchConcurrency is the number of names PublishBatch publishes at
+// the same time by default.
+const DefaultBatchConcurrency = 16
+
+// BatchEntry is a value to publish for a key with PublishBatch.
+type BatchEntry struct {
+	Key   ci.PrivKey
+	Value path.Path
+	// EOL is the end of the validity of the record.
+	EOL time.Time
+	// TTL is the time the record should be cached for, if positive.
+	TTL time.Duration
+}
+
+// BatchResult is the outcome of publishing an entry of a batch.
+type BatchResult struct {
+	// Entry is the index of the entry in the batch.
+	Entry int
+	ID    peer.ID
+	Err   error
+}
+
+// PublishBatch publishes the entries with the publisher, concurrency names
+// at a time, or DefaultBatchConcurrency if not positive. The result of each
+// entry is sent on the returned channel once the entry is published, and the
+// channel is closed once all of them are. The entries not published yet when
+// the context is canceled are left out.
+//
+// The sequence numbers of the names are assigned by the publisher, like for
+// the names published apart, and a batch publishing a key more than once is
+// refused.
+func PublishBatch(ctx context.Context, pub Publisher, entries []BatchEntry, concurrency int) (<-chan BatchResult, error) {
+	ids := make([]peer.ID, len(entries))
+	seen := make(map[peer.ID]int, len(entries))
+	for i, e := range entries {
+		id, err := peer.IDFromPrivateKey(e.Key)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %s", i, err)
+		}
+		if prev, ok := seen[id]; ok {
+			return nil, fmt.Errorf("entries %d and %d publish the same name %s", prev, i, id)
+		}
+		seen[id] = i
+		ids[i] = id
+	}
+
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	out := make(chan BatchResult)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < len(entries); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				e := entries[i]
+				ctx := ctx
+				if e.TTL > 0 {
+					ctx = context.WithValue(ctx, "ipns-publish-ttl", e.TTL)
+				}
+				res := BatchResult{Entry: i, ID: ids[i]}
+				res.Err = pub.PublishWithEOL(ctx, e.Key, e.Value, e.EOL)
+				select {
+				case out <- res:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(out)
+		defer wg.Wait()
+		defer close(next)
+		for i := range entries {
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,113 @@
+package namesys
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mockrouting "github.com/ipfs/go-ipfs-routing/mock"
+	path "github.com/ipfs/go-path"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	testutil "github.com/libp2p/go-libp2p-testing/net"
+)
+
+// countingPublisher records the number of concurrent publications.
+type countingPublisher struct {
+	Publisher
+
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func (p *countingPublisher) PublishWithEOL(ctx context.Context, k ci.PrivKey, value path.Path, eol time.Time) error {
+	p.mu.Lock()
+	p.current++
+	if p.current > p.max {
+		p.max = p.current
+	}
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.current--
+		p.mu.Unlock()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	return p.Publisher.PublishWithEOL(ctx, k, value, eol)
+}
+
+func TestPublishBatch(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	r := mockrouting.NewServer().ClientWithDatastore(ctx, testutil.RandIdentityOrFatal(t), dstore)
+	publisher := NewIpnsPublisher(r, dstore)
+	counter := &countingPublisher{Publisher: publisher}
+
+	entries := make([]BatchEntry, 20)
+	for i := range entries {
+		k, _, err := ci.GenerateKeyPairWithReader(ci.Ed25519, 0, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[i] = BatchEntry{
+			Key:   k,
+			Value: path.FromString("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"),
+			EOL:   time.Now().Add(time.Hour),
+			TTL:   time.Minute,
+		}
+	}
+
+	publish := func() {
+		t.Helper()
+		results, err := PublishBatch(ctx, counter, entries, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(map[int]bool)
+		for res := range results {
+			if res.Err != nil {
+				t.Errorf("entry %d: %s", res.Entry, res.Err)
+			}
+			done[res.Entry] = true
+		}
+		if len(done) != len(entries) {
+			t.Fatalf("expected %d results, got %d", len(entries), len(done))
+		}
+	}
+
+	publish()
+	if counter.max > 4 {
+		t.Errorf("expected at most 4 concurrent publications, got %d", counter.max)
+	}
+
+	// republishing a new value increments the sequence numbers
+	entries[0].Value = path.FromString("/ipfs/QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG")
+	publish()
+
+	for i, e := range entries {
+		id, _ := peer.IDFromPrivateKey(e.Key)
+		rec, err := publisher.GetPublished(ctx, id, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := uint64(0)
+		if i == 0 {
+			expected = 1
+		}
+		if rec.GetSequence() != expected || path.Path(rec.GetValue()) != e.Value || rec.GetTtl() != uint64(time.Minute) {
+			t.Errorf("entry %d: unexpected record %v", i, rec)
+		}
+	}
+
+	// a name can't be published twice in a batch
+	if _, err := PublishBatch(ctx, counter, append(entries, entries[3]), 4); err == nil {
+		t.Error("expected the batch publishing a key twice to be refused")
+	}
+}
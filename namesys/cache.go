@@ -4,24 +4,27 @@ import (
 	"time"
 
 	path "github.com/ipfs/go-path"
+	peer "github.com/libp2p/go-libp2p-core/peer"
 )
 
-func (ns *mpns) cacheGet(name string) (path.Path, bool) {
+// cacheGet returns the cached path of the name, and for how long it remains
+// cached, zero for the static mappings.
+func (ns *mpns) cacheGet(name string) (path.Path, time.Duration, bool) {
 	// existence of optional mapping defined via IPFS_NS_MAP is checked first
 	if ns.staticMap != nil {
 		val, ok := ns.staticMap[name]
 		if ok {
-			return val, true
+			return val, 0, true
 		}
 	}
 
 	if ns.cache == nil {
-		return "", false
+		return "", 0, false
 	}
 
 	ientry, ok := ns.cache.Get(name)
 	if !ok {
-		return "", false
+		return "", 0, false
 	}
 
 	entry, ok := ientry.(cacheEntry)
@@ -30,13 +33,13 @@ func (ns *mpns) cacheGet(name string) (path.Path, bool) {
 		log.Panicf("unexpected type %T in cache for %q.", ientry, name)
 	}
 
-	if time.Now().Before(entry.eol) {
-		return entry.val, true
+	if ttl := time.Until(entry.eol); ttl > 0 {
+		return entry.val, ttl, true
 	}
 
 	ns.cache.Remove(name)
 
-	return "", false
+	return "", 0, false
 }
 
 func (ns *mpns) cacheSet(name string, val path.Path, ttl time.Duration) {
@@ -50,6 +53,13 @@ func (ns *mpns) cacheSet(name string, val path.Path, ttl time.Duration) {
 }
 
 func (ns *mpns) cacheInvalidate(name string) {
+	if ns.recordCache != nil {
+		if id, err := peer.Decode(name); err == nil {
+			if err := ns.recordCache.Delete(id); err != nil {
+				log.Errorf("failed to discard the cached record of %s: %s", name, err)
+			}
+		}
+	}
 	if ns.cache == nil {
 		return
 	}
@@ -0,0 +1,98 @@
+package namesys
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-ipfs/repo"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// DNSConfigKey is the config section configuring the resolution of DNSLink
+// names.
+const DNSConfigKey = "DNS"
+
+// DNSConfig configures the resolution of DNSLink names.
+type DNSConfig struct {
+	// Resolvers map domain suffixes, like "eth." or "." for all the domains,
+	// to the DNS over HTTPS URL or the host[:port] address of the DNS server
+	// resolving them, instead of the system resolver.
+	Resolvers map[string]string
+}
+
+// PersistentCacheConfigKey is the config section configuring the persistent
+// cache of IPNS records.
+const PersistentCacheConfigKey = "IpnsPersistentCache"
+
+// PersistentCacheConfig configures the persistent cache of IPNS records.
+type PersistentCacheConfig struct {
+	// Enabled keeps the resolved records in the datastore.
+	Enabled bool
+	// StaleTimeout is how long resolutions wait for the routing system
+	// before serving the records past their TTL, DefaultStaleTimeout if
+	// empty.
+	StaleTimeout string
+	// MaxEntries is the number of records kept, DefaultMaxEntries if zero.
+	MaxEntries int
+}
+
+// LoadDNSConfig reads the DNS section of the config of the given repo.
+func LoadDNSConfig(r repo.Repo) (DNSConfig, error) {
+	var cfg DNSConfig
+	err := repo.LoadConfigSection(r, DNSConfigKey, &cfg)
+	return cfg, err
+}
+
+// LoadPersistentCacheConfig reads the IpnsPersistentCache section of the
+// config of the given repo.
+func LoadPersistentCacheConfig(r repo.Repo) (PersistentCacheConfig, error) {
+	var cfg PersistentCacheConfig
+	err := repo.LoadConfigSection(r, PersistentCacheConfigKey, &cfg)
+	return cfg, err
+}
+
+// NewDNSResolverFromConfig constructs the DNS resolver configured by cfg.
+func NewDNSResolverFromConfig(cfg DNSConfig) (*DNSResolver, error) {
+	if len(cfg.Resolvers) == 0 {
+		return NewDNSResolver(), nil
+	}
+
+	resolvers := make(map[string]TXTResolver, len(cfg.Resolvers))
+	for suffix, addr := range cfg.Resolvers {
+		res, err := NewTXTResolver(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s config: resolver of %q: %s", DNSConfigKey, suffix, err)
+		}
+		resolvers[suffix] = res
+	}
+	r, err := NewCustomDNSResolver(resolvers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s config: %s", DNSConfigKey, err)
+	}
+	return r, nil
+}
+
+// NewPersistentCacheFromConfig constructs the persistent cache configured by
+// cfg in the given datastore, or returns nil if it's disabled.
+func NewPersistentCacheFromConfig(cfg PersistentCacheConfig, d ds.Datastore) (*PersistentCache, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	c := NewPersistentCache(d)
+	if cfg.StaleTimeout != "" {
+		timeout, err := time.ParseDuration(cfg.StaleTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s config: StaleTimeout: %s", PersistentCacheConfigKey, err)
+		}
+		c.StaleTimeout = timeout
+	}
+	if cfg.MaxEntries < 0 {
+		return nil, fmt.Errorf("invalid %s config: MaxEntries: %d is negative", PersistentCacheConfigKey, cfg.MaxEntries)
+	}
+	if cfg.MaxEntries > 0 {
+		c.MaxEntries = cfg.MaxEntries
+	}
+	return c, nil
+}
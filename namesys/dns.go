@@ -3,12 +3,15 @@ package namesys
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	path "github.com/ipfs/go-path"
 	opts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
 	isd "github.com/jbenet/go-is-domain"
+	dns "github.com/miekg/dns"
 )
 
 const ethTLD = "eth"
@@ -16,16 +19,84 @@ const linkTLD = "link"
 
 type LookupTXTFunc func(name string) (txt []string, err error)
 
+// TXTResolver looks up the TXT records of domain names.
+type TXTResolver interface {
+	// LookupTXT returns the TXT records of the fully qualified domain name,
+	// and for how long they may be cached, zero if unknown.
+	LookupTXT(ctx context.Context, fqdn string) ([]string, time.Duration, error)
+}
+
 // DNSResolver implements a Resolver on DNS domains
 type DNSResolver struct {
 	lookupTXT LookupTXTFunc
-	// TODO: maybe some sort of caching?
-	// cache would need a timeout
+
+	// resolvers are the TXT resolvers of the domains under the given
+	// suffixes, fully qualified, which take precedence over lookupTXT.
+	resolvers map[string]TXTResolver
 }
 
 // NewDNSResolver constructs a name resolver using DNS TXT records.
 func NewDNSResolver() *DNSResolver {
-	return &DNSResolver{lookupTXT: net.LookupTXT}
+	return NewDNSResolverWithLookup(net.LookupTXT)
+}
+
+// NewDNSResolverWithLookup constructs a name resolver using the DNS TXT records
+// looked up with the given function in place of the system resolver.
+func NewDNSResolverWithLookup(lookup LookupTXTFunc) *DNSResolver {
+	return &DNSResolver{lookupTXT: lookup}
+}
+
+// NewCustomDNSResolver constructs a name resolver using DNS TXT records,
+// looked up with the resolver of the longest domain suffix matching the name,
+// or with the system resolver if none does. The suffix "." matches all the
+// domains.
+//
+// Unlike the system resolver, the TXT resolvers report the TTL of the records,
+// for which the resolved names are cached, instead of
+// DefaultResolverCacheTTL.
+func NewCustomDNSResolver(resolvers map[string]TXTResolver) (*DNSResolver, error) {
+	r := NewDNSResolver()
+	r.resolvers = make(map[string]TXTResolver, len(resolvers))
+	for suffix, res := range resolvers {
+		fqdn := strings.TrimPrefix(suffix, ".")
+		if !strings.HasSuffix(fqdn, ".") {
+			fqdn += "."
+		}
+		if _, ok := dns.IsDomainName(fqdn); !ok {
+			return nil, fmt.Errorf("invalid domain suffix %q", suffix)
+		}
+		r.resolvers[fqdn] = res
+	}
+	return r, nil
+}
+
+// resolverFor returns the TXT resolver of the fully qualified domain name and
+// the suffix it's configured for, or nil if the system resolver is used.
+func (r *DNSResolver) resolverFor(fqdn string) (TXTResolver, string) {
+	var (
+		best   TXTResolver
+		suffix string
+	)
+	for s, res := range r.resolvers {
+		if len(s) <= len(suffix) {
+			continue
+		}
+		if s == "." || fqdn == s || strings.HasSuffix(fqdn, "."+s) {
+			best, suffix = res, s
+		}
+	}
+	return best, suffix
+}
+
+// lookup returns the TXT records of the fully qualified domain name, and for
+// how long they may be cached. The system resolver doesn't report the TTL of
+// the records, which are cached for DefaultResolverCacheTTL.
+func (r *DNSResolver) lookup(ctx context.Context, fqdn string) ([]string, time.Duration, error) {
+	if res, _ := r.resolverFor(fqdn); res != nil {
+		return res.LookupTXT(ctx, fqdn)
+	}
+	txt, err := r.lookupTXT(fqdn)
+	return txt, DefaultResolverCacheTTL, err
 }
 
 // Resolve implements Resolver.
@@ -40,6 +111,7 @@ func (r *DNSResolver) ResolveAsync(ctx context.Context, name string, options ...
 
 type lookupRes struct {
 	path  path.Path
+	ttl   time.Duration
 	error error
 }
 
@@ -66,16 +138,19 @@ func (r *DNSResolver) resolveOnceAsync(ctx context.Context, name string, options
 	}
 
 	if strings.HasSuffix(fqdn, "."+ethTLD+".") {
-		// This is an ENS name.  As we're resolving via an arbitrary DNS server
-		// that may not know about .eth we need to add our link domain suffix.
-		fqdn += linkTLD + "."
+		// This is an ENS name.  Unless it's resolved by a resolver configured
+		// for .eth, we're resolving via an arbitrary DNS server that may not
+		// know about .eth and we need to add our link domain suffix.
+		if _, suffix := r.resolverFor(fqdn); !strings.HasSuffix(suffix, ethTLD+".") {
+			fqdn += linkTLD + "."
+		}
 	}
 
 	rootChan := make(chan lookupRes, 1)
-	go workDomain(r, fqdn, rootChan)
+	go workDomain(ctx, r, fqdn, rootChan)
 
 	subChan := make(chan lookupRes, 1)
-	go workDomain(r, "_dnslink."+fqdn, subChan)
+	go workDomain(ctx, r, "_dnslink."+fqdn, subChan)
 
 	appendPath := func(p path.Path) (path.Path, error) {
 		if len(segments) > 1 {
@@ -95,7 +170,7 @@ func (r *DNSResolver) resolveOnceAsync(ctx context.Context, name string, options
 				}
 				if subRes.error == nil {
 					p, err := appendPath(subRes.path)
-					emitOnceResult(ctx, out, onceResult{value: p, err: err})
+					emitOnceResult(ctx, out, onceResult{value: p, ttl: subRes.ttl, err: err})
 					return
 				}
 			case rootRes, ok := <-rootChan:
@@ -105,7 +180,7 @@ func (r *DNSResolver) resolveOnceAsync(ctx context.Context, name string, options
 				}
 				if rootRes.error == nil {
 					p, err := appendPath(rootRes.path)
-					emitOnceResult(ctx, out, onceResult{value: p, err: err})
+					emitOnceResult(ctx, out, onceResult{value: p, ttl: rootRes.ttl, err: err})
 				}
 			case <-ctx.Done():
 				return
@@ -119,24 +194,24 @@ func (r *DNSResolver) resolveOnceAsync(ctx context.Context, name string, options
 	return out
 }
 
-func workDomain(r *DNSResolver, name string, res chan lookupRes) {
+func workDomain(ctx context.Context, r *DNSResolver, name string, res chan lookupRes) {
 	defer close(res)
 
-	txt, err := r.lookupTXT(name)
+	txt, ttl, err := r.lookup(ctx, name)
 	if err != nil {
 		// Error is != nil
-		res <- lookupRes{"", err}
+		res <- lookupRes{"", 0, err}
 		return
 	}
 
 	for _, t := range txt {
 		p, err := parseEntry(t)
 		if err == nil {
-			res <- lookupRes{p, nil}
+			res <- lookupRes{p, ttl, nil}
 			return
 		}
 	}
-	res <- lookupRes{"", ErrResolveFailed}
+	res <- lookupRes{"", 0, ErrResolveFailed}
 }
 
 func parseEntry(txt string) (path.Path, error) {
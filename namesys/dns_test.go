@@ -1,10 +1,19 @@
 package namesys
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
+	ds "github.com/ipfs/go-datastore"
+	offroute "github.com/ipfs/go-ipfs-routing/offline"
 	opts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
+	dns "github.com/miekg/dns"
 )
 
 type mockDNS struct {
@@ -170,3 +179,199 @@ func TestDNSResolution(t *testing.T) {
 	testResolution(t, r, "www.wealdtech.eth", 2, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
 	testResolution(t, r, "www.wealdtech.eth.link", 2, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
 }
+
+func TestDNSResolutionTTL(t *testing.T) {
+	mock := newMockDNS()
+	r := &DNSResolver{lookupTXT: mock.lookupTXT}
+
+	// the system resolver doesn't report the TTL of the records
+	p, ttl, err := ResolveWithTTL(context.Background(), r, "dns1.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD" || ttl != DefaultResolverCacheTTL {
+		t.Fatalf("expected the default TTL, got %s with %s", p, ttl)
+	}
+}
+
+// dohServer is a stand-in DNS over HTTPS endpoint answering the TXT queries
+// from its entries.
+type dohServer struct {
+	entries map[string][]string
+	ttl     uint32
+
+	mu      sync.Mutex
+	queries []string
+}
+
+func (s *dohServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dnsMessageType {
+		http.Error(w, "not a DNS query", http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	q := new(dns.Msg)
+	if err := q.Unpack(body); err != nil || len(q.Question) != 1 {
+		http.Error(w, "invalid DNS query", http.StatusBadRequest)
+		return
+	}
+
+	name := q.Question[0].Name
+	s.mu.Lock()
+	s.queries = append(s.queries, name)
+	s.mu.Unlock()
+
+	answer := new(dns.Msg).SetReply(q)
+	txt, ok := s.entries[name]
+	if !ok {
+		answer.Rcode = dns.RcodeNameError
+	}
+	for _, t := range txt {
+		answer.Answer = append(answer.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: s.ttl},
+			Txt: []string{t},
+		})
+	}
+	data, err := answer.Pack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", dnsMessageType)
+	w.Write(data)
+}
+
+// queried returns the number of queries of the name.
+func (s *dohServer) queried(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int
+	for _, q := range s.queries {
+		if q == name {
+			n++
+		}
+	}
+	return n
+}
+
+// start serves the endpoint, returning its resolver and the function stopping
+// it.
+func (s *dohServer) start() (*DoHResolver, func()) {
+	srv := httptest.NewTLSServer(s)
+	return NewDoHResolver(srv.URL, srv.Client()), srv.Close
+}
+
+func TestCustomDNSResolvers(t *testing.T) {
+	eth := &dohServer{
+		ttl: 300,
+		entries: map[string][]string{
+			"_dnslink.app.eth.": {"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"},
+		},
+	}
+	corp := &dohServer{
+		entries: map[string][]string{
+			"docs.corp.example.com.": {"dnslink=/ipns/app.eth/docs"},
+		},
+	}
+
+	ethResolver, stop := eth.start()
+	defer stop()
+	corpResolver, stop := corp.start()
+	defer stop()
+
+	r, err := NewCustomDNSResolver(map[string]TXTResolver{
+		".eth":             ethResolver,
+		"corp.example.com": corpResolver,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.lookupTXT = newMockDNS().lookupTXT
+
+	// .eth names are resolved by their resolver, without the .eth.link suffix
+	testResolution(t, r, "app.eth", opts.DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	testResolution(t, r, "docs.corp.example.com", opts.DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD/docs", nil)
+	// the other domains are resolved by the system resolver
+	testResolution(t, r, "dns1.example.com", opts.DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	testResolution(t, r, "ipfs.corp2.example.com", opts.DefaultDepthLimit, "", ErrResolveFailed)
+
+	if eth.queried("_dnslink.app.eth.") == 0 || eth.queried("_dnslink.app.eth.link.") != 0 {
+		t.Error("expected app.eth to be looked up without the .eth.link suffix")
+	}
+
+	res := <-r.ResolveAsync(context.Background(), "app.eth")
+	if res.Err != nil || res.TTL != 300*time.Second {
+		t.Errorf("expected a TTL of 5m, got %s (%v)", res.TTL, res.Err)
+	}
+
+	if _, err := NewCustomDNSResolver(map[string]TXTResolver{"bad..example.com": NewDoHResolver("https://localhost", nil)}); err == nil {
+		t.Error("expected an invalid suffix to be refused")
+	}
+}
+
+func TestDNSLinkCacheTTL(t *testing.T) {
+	cached := &dohServer{
+		ttl: 300,
+		entries: map[string][]string{
+			"_dnslink.cached.example.com.": {"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"},
+		},
+	}
+	uncached := &dohServer{
+		entries: map[string][]string{
+			"_dnslink.uncached.example.net.": {"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"},
+		},
+	}
+	system := &mockDNS{
+		entries: map[string][]string{
+			"_dnslink.system.example.org.": {"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"},
+		},
+	}
+	var (
+		mu            sync.Mutex
+		systemLookups int
+	)
+
+	cachedResolver, stop := cached.start()
+	defer stop()
+	uncachedResolver, stop := uncached.start()
+	defer stop()
+
+	r, err := NewCustomDNSResolver(map[string]TXTResolver{
+		"com.": cachedResolver,
+		"net.": uncachedResolver,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.lookupTXT = func(name string) ([]string, error) {
+		if name == "_dnslink.system.example.org." {
+			mu.Lock()
+			systemLookups++
+			mu.Unlock()
+		}
+		return system.lookupTXT(name)
+	}
+	dstore := ds.NewMapDatastore()
+	nsys := NewNameSystem(offroute.NewOfflineRouter(dstore, nil), dstore, 128, WithDNSResolver(r))
+
+	for i := 0; i < 2; i++ {
+		testResolution(t, nsys, "/ipns/cached.example.com", opts.DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+		testResolution(t, nsys, "/ipns/uncached.example.net", opts.DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+		testResolution(t, nsys, "/ipns/system.example.org", opts.DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	}
+
+	if n := cached.queried("_dnslink.cached.example.com."); n != 1 {
+		t.Errorf("expected the name to be looked up once for its TTL, got %d lookups", n)
+	}
+	if n := uncached.queried("_dnslink.uncached.example.net."); n != 2 {
+		t.Errorf("expected the name without TTL not to be cached, got %d lookups", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if systemLookups != 1 {
+		t.Errorf("expected the name resolved by the system to be cached, got %d lookups", systemLookups)
+	}
+}
@@ -0,0 +1,149 @@
+package namesys
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	dns "github.com/miekg/dns"
+)
+
+const dnsMessageType = "application/dns-message"
+
+// NewTXTResolver returns the TXT resolver at the given address: a DNS over
+// HTTPS endpoint if it's an http or https URL, or a DNS server given as
+// host[:port] otherwise.
+func NewTXTResolver(addr string) (TXTResolver, error) {
+	if strings.HasPrefix(addr, "https://") || strings.HasPrefix(addr, "http://") {
+		if _, err := url.Parse(addr); err != nil {
+			return nil, err
+		}
+		return NewDoHResolver(addr, nil), nil
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), "53")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid DNS server address %q", addr)
+	}
+	return NewServerResolver(addr), nil
+}
+
+// DoHResolver looks up TXT records with DNS over HTTPS (RFC 8484).
+type DoHResolver struct {
+	url    string
+	client *http.Client
+}
+
+// NewDoHResolver constructs a resolver querying the DNS over HTTPS endpoint at
+// the given URL with the given client, or the default client if nil.
+func NewDoHResolver(url string, client *http.Client) *DoHResolver {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &DoHResolver{url: url, client: client}
+}
+
+// LookupTXT implements TXTResolver.
+func (r *DoHResolver) LookupTXT(ctx context.Context, fqdn string) ([]string, time.Duration, error) {
+	q := new(dns.Msg)
+	q.SetQuestion(fqdn, dns.TypeTXT)
+	// the ID is zero to make the responses cacheable by HTTP caches
+	q.Id = 0
+	body, err := q.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", dnsMessageType)
+	req.Header.Set("Accept", dnsMessageType)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("lookup %s: DNS over HTTPS endpoint returned %s", fqdn, resp.Status)
+	}
+	// DNS messages are at most 64KiB
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	answer := new(dns.Msg)
+	if err := answer.Unpack(data); err != nil {
+		return nil, 0, fmt.Errorf("lookup %s: invalid DNS message: %s", fqdn, err)
+	}
+	return txtRecords(fqdn, answer)
+}
+
+// ServerResolver looks up TXT records by querying a DNS server directly.
+type ServerResolver struct {
+	addr string
+}
+
+// NewServerResolver constructs a resolver querying the DNS server at the given
+// host:port address.
+func NewServerResolver(addr string) *ServerResolver {
+	return &ServerResolver{addr: addr}
+}
+
+// LookupTXT implements TXTResolver.
+func (r *ServerResolver) LookupTXT(ctx context.Context, fqdn string) ([]string, time.Duration, error) {
+	q := new(dns.Msg)
+	q.SetQuestion(fqdn, dns.TypeTXT)
+
+	client := &dns.Client{Net: "udp"}
+	answer, _, err := client.ExchangeContext(ctx, q, r.addr)
+	if err == nil && answer.Truncated {
+		// the records don't fit in a datagram
+		client.Net = "tcp"
+		answer, _, err = client.ExchangeContext(ctx, q, r.addr)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return txtRecords(fqdn, answer)
+}
+
+// txtRecords returns the TXT records of the answer, and the lowest TTL of the
+// records it's made of, including the CNAME records leading to them.
+func txtRecords(fqdn string, answer *dns.Msg) ([]string, time.Duration, error) {
+	if answer.Rcode != dns.RcodeSuccess {
+		return nil, 0, fmt.Errorf("lookup %s: %s", fqdn, dns.RcodeToString[answer.Rcode])
+	}
+
+	var (
+		txt []string
+		ttl uint32
+	)
+	for i, rr := range answer.Answer {
+		if i == 0 || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+		if t, ok := rr.(*dns.TXT); ok {
+			// like net.LookupTXT, the strings of a record are concatenated
+			txt = append(txt, strings.Join(t.Txt, ""))
+		}
+	}
+	if len(txt) == 0 {
+		return nil, 0, fmt.Errorf("lookup %s: no TXT records", fqdn)
+	}
+	return txt, time.Duration(ttl) * time.Second, nil
+}
@@ -35,9 +35,11 @@ import (
 
 	context "context"
 
+	pb "github.com/ipfs/go-ipns/pb"
 	path "github.com/ipfs/go-path"
 	opts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
 	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
 )
 
 // ErrResolveFailed signals an error when attempting to resolve.
@@ -66,6 +68,9 @@ type NameSystem interface {
 type Result struct {
 	Path path.Path
 	Err  error
+	// TTL is how long the path may be cached, the shortest TTL of the
+	// records it was resolved through. It's zero when unknown.
+	TTL time.Duration
 }
 
 // Resolver is an object capable of resolving names.
@@ -104,3 +109,9 @@ type Publisher interface {
 	// call once the records spec is implemented
 	PublishWithEOL(ctx context.Context, name ci.PrivKey, value path.Path, eol time.Time) error
 }
+
+// RecordPutter publishes IPNS records signed elsewhere, like the records
+// created with CreateRecord. The name systems of this package implement it.
+type RecordPutter interface {
+	PutRecord(ctx context.Context, id peer.ID, entry *pb.IpnsEntry) error
+}
@@ -2,6 +2,7 @@ package namesys
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -10,6 +11,7 @@ import (
 	lru "github.com/hashicorp/golang-lru"
 	cid "github.com/ipfs/go-cid"
 	ds "github.com/ipfs/go-datastore"
+	pb "github.com/ipfs/go-ipns/pb"
 	path "github.com/ipfs/go-path"
 	opts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
 	isd "github.com/jbenet/go-is-domain"
@@ -31,12 +33,35 @@ type mpns struct {
 	dnsResolver, proquintResolver, ipnsResolver resolver
 	ipnsPublisher                               Publisher
 
-	staticMap map[string]path.Path
-	cache     *lru.Cache
+	staticMap   map[string]path.Path
+	cache       *lru.Cache
+	recordCache *PersistentCache
+}
+
+// Option configures the name system constructed by NewNameSystem.
+type Option func(*mpns)
+
+// WithDNSResolver resolves the DNS domains with the given resolver, instead
+// of one using the system resolver.
+func WithDNSResolver(r *DNSResolver) Option {
+	return func(ns *mpns) {
+		ns.dnsResolver = r
+	}
+}
+
+// WithPersistentCache keeps the IPNS records resolved in the given cache,
+// which outlives the name system.
+func WithPersistentCache(c *PersistentCache) Option {
+	return func(ns *mpns) {
+		ns.recordCache = c
+		if r, ok := ns.ipnsResolver.(*IpnsResolver); ok {
+			r.cache = c
+		}
+	}
 }
 
 // NewNameSystem will construct the IPFS naming system based on Routing
-func NewNameSystem(r routing.ValueStore, ds ds.Datastore, cachesize int) NameSystem {
+func NewNameSystem(r routing.ValueStore, ds ds.Datastore, cachesize int, options ...Option) NameSystem {
 	var (
 		cache     *lru.Cache
 		staticMap map[string]path.Path
@@ -59,7 +84,7 @@ func NewNameSystem(r routing.ValueStore, ds ds.Datastore, cachesize int) NameSys
 		}
 	}
 
-	return &mpns{
+	ns := &mpns{
 		dnsResolver:      NewDNSResolver(),
 		proquintResolver: new(ProquintResolver),
 		ipnsResolver:     NewIpnsResolver(r),
@@ -67,6 +92,10 @@ func NewNameSystem(r routing.ValueStore, ds ds.Datastore, cachesize int) NameSys
 		staticMap:        staticMap,
 		cache:            cache,
 	}
+	for _, o := range options {
+		o(ns)
+	}
+	return ns
 }
 
 // DefaultResolverCacheTTL defines max ttl of a record placed in namesys cache.
@@ -89,13 +118,13 @@ func (ns *mpns) ResolveAsync(ctx context.Context, name string, options ...opts.R
 	res := make(chan Result, 1)
 	if strings.HasPrefix(name, "/ipfs/") {
 		p, err := path.ParsePath(name)
-		res <- Result{p, err}
+		res <- Result{Path: p, Err: err}
 		return res
 	}
 
 	if !strings.HasPrefix(name, "/") {
 		p, err := path.ParsePath("/ipfs/" + name)
-		res <- Result{p, err}
+		res <- Result{Path: p, Err: err}
 		return res
 	}
 
@@ -119,7 +148,7 @@ func (ns *mpns) resolveOnceAsync(ctx context.Context, name string, options opts.
 
 	key := segments[2]
 
-	if p, ok := ns.cacheGet(key); ok {
+	if p, ttl, ok := ns.cacheGet(key); ok {
 		if len(segments) > 3 {
 			var err error
 			p, err = path.FromSegments("", strings.TrimRight(p.String(), "/"), segments[3])
@@ -128,7 +157,7 @@ func (ns *mpns) resolveOnceAsync(ctx context.Context, name string, options opts.
 			}
 		}
 
-		out <- onceResult{value: p}
+		out <- onceResult{value: p, ttl: ttl}
 		close(out)
 		return out
 	}
@@ -207,6 +236,17 @@ func emitOnceResult(ctx context.Context, outCh chan<- onceResult, r onceResult)
 	}
 }
 
+// PutRecord implements RecordPutter.
+func (ns *mpns) PutRecord(ctx context.Context, id peer.ID, entry *pb.IpnsEntry) error {
+	putter, ok := ns.ipnsPublisher.(RecordPutter)
+	if !ok {
+		return errors.New("the IPNS publisher can't put records")
+	}
+	// the cache is refreshed on the next resolution
+	defer ns.cacheInvalidate(peer.Encode(id))
+	return putter.PutRecord(ctx, id, entry)
+}
+
 // Publish implements Publisher
 func (ns *mpns) Publish(ctx context.Context, name ci.PrivKey, value path.Path) error {
 	return ns.PublishWithEOL(ctx, name, value, time.Now().Add(DefaultRecordEOL))
@@ -230,6 +270,8 @@ func (ns *mpns) PublishWithEOL(ctx context.Context, name ci.PrivKey, value path.
 	if ttEol := time.Until(eol); ttEol < ttl {
 		ttl = ttEol
 	}
+	// drops the outdated record of the persistent cache too
+	ns.cacheInvalidate(peer.Encode(id))
 	ns.cacheSet(peer.Encode(id), value, ttl)
 	return nil
 }
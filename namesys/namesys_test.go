@@ -167,3 +167,54 @@ func TestPublishWithTTL(t *testing.T) {
 		t.Fatalf("bad cache ttl: expected %s, got %s", eol, entry.eol)
 	}
 }
+
+func TestResolveWithTTL(t *testing.T) {
+	dst := dssync.MutexWrap(ds.NewMapDatastore())
+	priv, _, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := pstoremem.NewPeerstore()
+	pid, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.AddPubKey(pid, priv.GetPublic()); err != nil {
+		t.Fatal(err)
+	}
+
+	routing := offroute.NewOfflineRouter(dst, record.NamespacedValidator{
+		"ipns": ipns.Validator{KeyBook: ps},
+		"pk":   record.PublicKeyValidator{},
+	})
+	p, err := path.ParsePath(unixfs.EmptyDirNode().Cid().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ttl := time.Hour
+	ctx := context.WithValue(context.Background(), "ipns-publish-ttl", ttl)
+	if err := NewNameSystem(routing, dst, 0).Publish(ctx, priv, p); err != nil {
+		t.Fatal(err)
+	}
+
+	// the TTL of the record, and then the time left in the cache
+	nsys := NewNameSystem(routing, dst, 128)
+	for i := 0; i < 2; i++ {
+		res, resTTL, err := ResolveWithTTL(context.Background(), nsys, "/ipns/"+pid.Pretty())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != p || resTTL > ttl || resTTL < ttl-time.Minute {
+			t.Fatalf("expected %s with a TTL of %s, got %s with %s", p, ttl, res, resTTL)
+		}
+	}
+
+	// names pointing to the key can't be cached for longer than the
+	// static mappings, which have no TTL
+	nsys.(*mpns).staticMap = map[string]path.Path{"example.com": path.FromString("/ipns/" + pid.Pretty())}
+	res, resTTL, err := ResolveWithTTL(context.Background(), nsys, "/ipns/example.com")
+	if err != nil || res != p || resTTL != 0 {
+		t.Fatalf("expected %s without a TTL, got %s with %s: %v", p, res, resTTL, err)
+	}
+}
@@ -0,0 +1,281 @@
+package namesys
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	ipns "github.com/ipfs/go-ipns"
+	pb "github.com/ipfs/go-ipns/pb"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	base32 "github.com/whyrusleeping/base32"
+)
+
+// PersistentCachePrefix is the datastore namespace of the persistent cache of
+// resolved IPNS records.
+var PersistentCachePrefix = ds.NewKey("/local/ipnscache")
+
+// DefaultStaleTimeout is how long resolutions wait for the routing system
+// before serving the records of the persistent cache past their TTL.
+const DefaultStaleTimeout = 2 * time.Second
+
+// DefaultMaxEntries is the number of records the persistent cache is pruned
+// down to.
+const DefaultMaxEntries = 10000
+
+// DefaultPruneInterval is how often the expired records of the persistent
+// cache are swept.
+const DefaultPruneInterval = time.Hour
+
+// revalidationTimeout bounds the resolutions refreshing the records of the
+// persistent cache past their TTL, which outlive the resolutions serving them.
+const revalidationTimeout = time.Minute
+
+// PersistentCache keeps the latest valid IPNS record resolved for each name in
+// a datastore, so that names resolve without routing lookups after restarts.
+//
+// The records are validated when loaded. They're served for their TTL, then
+// until their EOL if the routing system doesn't resolve the name within
+// StaleTimeout, while they're refreshed in the background. Expired records are
+// discarded when loaded, and swept by Prune along with the records resolved
+// the longest ago past MaxEntries.
+type PersistentCache struct {
+	dstore ds.Datastore
+
+	// StaleTimeout is how long resolutions wait for the routing system
+	// before serving the records past their TTL.
+	StaleTimeout time.Duration
+	// MaxEntries is the number of records Prune keeps, unbounded if not
+	// positive.
+	MaxEntries int
+
+	mu           sync.Mutex
+	revalidating map[peer.ID]struct{}
+}
+
+// cachedRecord is a record of the persistent cache.
+type cachedRecord struct {
+	// Received is when the record was resolved, which its TTL starts from.
+	Received time.Time
+	Record   []byte
+}
+
+// NewPersistentCache constructs a cache keeping the records in the given
+// datastore.
+func NewPersistentCache(d ds.Datastore) *PersistentCache {
+	return &PersistentCache{
+		dstore:       d,
+		StaleTimeout: DefaultStaleTimeout,
+		MaxEntries:   DefaultMaxEntries,
+		revalidating: make(map[peer.ID]struct{}),
+	}
+}
+
+func persistentCacheKey(id peer.ID) ds.Key {
+	return PersistentCachePrefix.ChildString(base32.RawStdEncoding.EncodeToString([]byte(id)))
+}
+
+// Get returns the cached record of the name, and for how long it remains
+// fresh, which is not positive once it's past its TTL. Invalid and expired
+// records are discarded.
+func (c *PersistentCache) Get(id peer.ID) (*pb.IpnsEntry, time.Duration, bool) {
+	entry, received, ok := c.load(id)
+	if !ok {
+		return nil, 0, false
+	}
+
+	ttl := DefaultResolverCacheTTL
+	if entry.Ttl != nil {
+		ttl = time.Duration(*entry.Ttl)
+	}
+	fresh := time.Until(received.Add(ttl))
+	if eol, err := ipns.GetEOL(entry); err == nil && time.Until(eol) < fresh {
+		fresh = time.Until(eol)
+	}
+	return entry, fresh, true
+}
+
+// load returns the cached record of the name and when it was received,
+// discarding it if it's invalid or expired.
+func (c *PersistentCache) load(id peer.ID) (*pb.IpnsEntry, time.Time, bool) {
+	val, err := c.dstore.Get(persistentCacheKey(id))
+	if err != nil {
+		if err != ds.ErrNotFound {
+			log.Errorf("failed to load the cached record of %s: %s", id, err)
+		}
+		return nil, time.Time{}, false
+	}
+
+	entry, received, err := loadCachedRecord(id, val)
+	if err != nil {
+		log.Debugf("discarding the cached record of %s: %s", id, err)
+		if err := c.dstore.Delete(persistentCacheKey(id)); err != nil {
+			log.Errorf("failed to discard the cached record of %s: %s", id, err)
+		}
+		return nil, time.Time{}, false
+	}
+	return entry, received, true
+}
+
+// loadCachedRecord unmarshals and validates the cached record of the name.
+func loadCachedRecord(id peer.ID, val []byte) (*pb.IpnsEntry, time.Time, error) {
+	var rec cachedRecord
+	if err := json.Unmarshal(val, &rec); err != nil {
+		return nil, time.Time{}, err
+	}
+	entry := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(rec.Record, entry); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	pk, err := ipns.ExtractPublicKey(id, entry)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if pk == nil {
+		return nil, time.Time{}, errors.New("no public key to validate the record")
+	}
+	// also checks that the record hasn't expired
+	if err := ipns.Validate(pk, entry); err != nil {
+		return nil, time.Time{}, err
+	}
+	return entry, rec.Received, nil
+}
+
+// Put caches the record resolved for the name, unless the cache holds a newer
+// one. The public key of the name is embedded in the record if it can't be
+// extracted from the name, to validate the record when it's loaded.
+func (c *PersistentCache) Put(id peer.ID, pk ci.PubKey, entry *pb.IpnsEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, _, ok := c.Get(id); ok {
+		if cmp, err := ipns.Compare(cached, entry); err == nil && cmp > 0 {
+			return nil
+		}
+	}
+
+	if entry.PubKey == nil && pk != nil {
+		entry = proto.Clone(entry).(*pb.IpnsEntry)
+		if err := ipns.EmbedPublicKey(pk, entry); err != nil {
+			return err
+		}
+	}
+	record, err := proto.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	val, err := json.Marshal(cachedRecord{Received: time.Now(), Record: record})
+	if err != nil {
+		return err
+	}
+	return c.dstore.Put(persistentCacheKey(id), val)
+}
+
+// Delete removes the cached record of the name, if any.
+func (c *PersistentCache) Delete(id peer.ID) error {
+	return c.dstore.Delete(persistentCacheKey(id))
+}
+
+// Prune discards the invalid and expired records of the cache, which are
+// otherwise only discarded when their names are resolved again, then the
+// records resolved the longest ago past MaxEntries.
+func (c *PersistentCache) Prune() error {
+	res, err := c.dstore.Query(dsq.Query{Prefix: PersistentCachePrefix.String(), KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+
+	type keptRecord struct {
+		id       peer.ID
+		received time.Time
+	}
+	var kept []keptRecord
+	for _, e := range entries {
+		key := ds.NewKey(e.Key)
+		b, err := base32.RawStdEncoding.DecodeString(key.BaseNamespace())
+		if err != nil {
+			log.Debugf("discarding the invalid cache entry %s: %s", key, err)
+			if err := c.dstore.Delete(key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// the record is loaded under the lock of Put not to discard a
+		// record replacing it
+		c.mu.Lock()
+		_, received, ok := c.load(peer.ID(b))
+		c.mu.Unlock()
+		if ok {
+			kept = append(kept, keptRecord{peer.ID(b), received})
+		}
+	}
+
+	if c.MaxEntries <= 0 || len(kept) <= c.MaxEntries {
+		return nil
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].received.Before(kept[j].received)
+	})
+	for _, r := range kept[:len(kept)-c.MaxEntries] {
+		var err error
+		c.mu.Lock()
+		// unless it was replaced since
+		if _, received, ok := c.load(r.id); ok && received.Equal(r.received) {
+			err = c.dstore.Delete(persistentCacheKey(r.id))
+		}
+		c.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneEvery prunes the cache at the given interval, starting right away,
+// until the context is cancelled.
+func (c *PersistentCache) PruneEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Prune(); err != nil {
+			log.Errorf("failed to prune the persistent IPNS cache: %s", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// startRevalidation returns whether the caller should refresh the record of
+// the name, false if it's already being refreshed.
+func (c *PersistentCache) startRevalidation(id peer.ID) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.revalidating[id]; ok {
+		return false
+	}
+	c.revalidating[id] = struct{}{}
+	return true
+}
+
+func (c *PersistentCache) endRevalidation(id peer.ID) {
+	c.mu.Lock()
+	delete(c.revalidating, id)
+	c.mu.Unlock()
+}
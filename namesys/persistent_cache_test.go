@@ -0,0 +1,281 @@
+package namesys
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ipns "github.com/ipfs/go-ipns"
+	pb "github.com/ipfs/go-ipns/pb"
+	path "github.com/ipfs/go-path"
+	opts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	routing "github.com/libp2p/go-libp2p-core/routing"
+)
+
+const (
+	cachedPath = "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"
+	newerPath  = "/ipfs/QmYvMB9yrsSf7RKBghkfwmHJkzJhW2ZgVwq3LxBXXPasFr"
+)
+
+// slowRouting is a routing system answering the searches of IPNS records with
+// its record once released.
+type slowRouting struct {
+	routing.ValueStore
+
+	release chan struct{}
+
+	mu       sync.Mutex
+	record   []byte
+	searches int
+}
+
+func (r *slowRouting) SearchValue(ctx context.Context, key string, _ ...routing.Option) (<-chan []byte, error) {
+	r.mu.Lock()
+	r.searches++
+	record := r.record
+	r.mu.Unlock()
+
+	out := make(chan []byte, 1)
+	go func() {
+		defer close(out)
+		select {
+		case <-r.release:
+			out <- record
+		case <-ctx.Done():
+		}
+	}()
+	return out, nil
+}
+
+func (r *slowRouting) GetValue(context.Context, string, ...routing.Option) ([]byte, error) {
+	return nil, routing.ErrNotFound
+}
+
+func (r *slowRouting) PutValue(context.Context, string, []byte, ...routing.Option) error {
+	return nil
+}
+
+func (r *slowRouting) searchCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.searches
+}
+
+func newRecord(t *testing.T, sk ci.PrivKey, value string, seq uint64, eol time.Time, ttl time.Duration) *pb.IpnsEntry {
+	t.Helper()
+	entry, err := ipns.Create(sk, []byte(value), seq, eol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.Ttl = proto.Uint64(uint64(ttl))
+	return entry
+}
+
+func TestPersistentCache(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	c := NewPersistentCache(dstore)
+
+	sk, _, err := ci.GenerateKeyPairWithReader(ci.Ed25519, 0, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := peer.IDFromPrivateKey(sk)
+
+	if _, _, ok := c.Get(id); ok {
+		t.Fatal("expected an empty cache")
+	}
+
+	entry := newRecord(t, sk, cachedPath, 1, time.Now().Add(time.Hour), time.Minute)
+	if err := c.Put(id, sk.GetPublic(), entry); err != nil {
+		t.Fatal(err)
+	}
+	cached, fresh, ok := c.Get(id)
+	if !ok || string(cached.GetValue()) != cachedPath || fresh <= 0 || fresh > time.Minute {
+		t.Fatalf("expected the record to be fresh for a minute, got %v for %s", cached, fresh)
+	}
+
+	// older records don't replace newer ones
+	if err := c.Put(id, sk.GetPublic(), newRecord(t, sk, newerPath, 0, time.Now().Add(time.Hour), time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if cached, _, _ := c.Get(id); string(cached.GetValue()) != cachedPath {
+		t.Errorf("expected the newer record to be kept, got %v", cached)
+	}
+
+	// records are stale past their TTL
+	if err := c.Put(id, sk.GetPublic(), newRecord(t, sk, cachedPath, 2, time.Now().Add(time.Hour), 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, fresh, ok := c.Get(id); !ok || fresh > 0 {
+		t.Errorf("expected the record to be stale, fresh for %s", fresh)
+	}
+
+	// expired records are discarded
+	if err := c.Put(id, sk.GetPublic(), newRecord(t, sk, cachedPath, 3, time.Now().Add(50*time.Millisecond), time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, _, ok := c.Get(id); ok {
+		t.Error("expected the expired record to be discarded")
+	}
+	if has, _ := dstore.Has(persistentCacheKey(id)); has {
+		t.Error("expected the expired record to be deleted")
+	}
+
+	// so are records failing validation
+	forged := newRecord(t, sk, cachedPath, 4, time.Now().Add(time.Hour), time.Minute)
+	forged.Value = []byte(newerPath)
+	if err := c.Put(id, sk.GetPublic(), forged); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := c.Get(id); ok {
+		t.Error("expected the forged record to be discarded")
+	}
+
+	// the keys that can't be extracted from the names are embedded
+	rsaKey, _, err := ci.GenerateKeyPairWithReader(ci.RSA, 2048, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaID, _ := peer.IDFromPrivateKey(rsaKey)
+	if err := c.Put(rsaID, rsaKey.GetPublic(), newRecord(t, rsaKey, cachedPath, 1, time.Now().Add(time.Hour), time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := c.Get(rsaID); !ok {
+		t.Error("expected the record to be validated with the embedded key")
+	}
+}
+
+func TestPersistentCacheResolve(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	c := NewPersistentCache(dstore)
+	c.StaleTimeout = 50 * time.Millisecond
+
+	sk, _, err := ci.GenerateKeyPairWithReader(ci.Ed25519, 0, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := peer.IDFromPrivateKey(sk)
+	name := "/ipns/" + peer.Encode(id)
+
+	newer, err := proto.Marshal(newRecord(t, sk, newerPath, 2, time.Now().Add(time.Hour), time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &slowRouting{release: make(chan struct{}), record: newer}
+	nsys := NewNameSystem(r, dstore, 0, WithPersistentCache(c))
+
+	// fresh records are served without routing lookups
+	if err := c.Put(id, nil, newRecord(t, sk, cachedPath, 1, time.Now().Add(time.Hour), time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	testResolution(t, nsys, name, opts.DefaultDepthLimit, cachedPath, nil)
+	if n := r.searchCount(); n != 0 {
+		t.Fatalf("expected no routing lookup, got %d", n)
+	}
+
+	// stale records are served when the routing system is slow, and
+	// refreshed in the background, once at a time
+	if err := c.Put(id, nil, newRecord(t, sk, cachedPath, 1, time.Now().Add(time.Hour), 0)); err != nil {
+		t.Fatal(err)
+	}
+	testResolution(t, nsys, name, opts.DefaultDepthLimit, cachedPath, nil)
+	testResolution(t, nsys, name, opts.DefaultDepthLimit, cachedPath, nil)
+	if n := r.searchCount(); n != 1 {
+		t.Fatalf("expected a single routing lookup, got %d", n)
+	}
+
+	close(r.release)
+	for i := 0; ; i++ {
+		if cached, _, _ := c.Get(id); string(cached.GetValue()) == newerPath {
+			break
+		}
+		if i == 100 {
+			t.Fatal("expected the stale record to be refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	testResolution(t, nsys, name, opts.DefaultDepthLimit, newerPath, nil)
+
+	// publishing drops the cached record of the name
+	if err := nsys.Publish(context.Background(), sk, path.Path(newerPath)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := c.Get(id); ok {
+		t.Error("expected the cached record to be dropped")
+	}
+}
+
+func TestPersistentCachePrune(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	c := NewPersistentCache(dstore)
+
+	var ids []peer.ID
+	for _, eol := range []time.Duration{time.Hour, 50 * time.Millisecond} {
+		sk, _, err := ci.GenerateKeyPairWithReader(ci.Ed25519, 0, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := peer.IDFromPrivateKey(sk)
+		if err := c.Put(id, nil, newRecord(t, sk, cachedPath, 1, time.Now().Add(eol), time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	invalid := PersistentCachePrefix.ChildString("invalid!")
+	if err := dstore.Put(invalid, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// expired records and invalid entries are swept without being resolved
+	if err := c.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := dstore.Has(persistentCacheKey(ids[0])); !has {
+		t.Error("expected the valid record to be kept")
+	}
+	if has, _ := dstore.Has(persistentCacheKey(ids[1])); has {
+		t.Error("expected the expired record to be pruned")
+	}
+	if has, _ := dstore.Has(invalid); has {
+		t.Error("expected the invalid entry to be pruned")
+	}
+}
+
+func TestPersistentCachePruneMaxEntries(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	c := NewPersistentCache(dstore)
+	c.MaxEntries = 2
+
+	var ids []peer.ID
+	for i := 0; i < 3; i++ {
+		sk, _, err := ci.GenerateKeyPairWithReader(ci.Ed25519, 0, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := peer.IDFromPrivateKey(sk)
+		if err := c.Put(id, nil, newRecord(t, sk, cachedPath, 1, time.Now().Add(time.Hour), time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the records resolved the longest ago are evicted
+	if err := c.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	for i, kept := range []bool{false, true, true} {
+		if has, _ := dstore.Has(persistentCacheKey(ids[i])); has != kept {
+			t.Errorf("record %d: expected kept %t", i, kept)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package namesys
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"sync"
 	"time"
@@ -31,7 +32,14 @@ type IpnsPublisher struct {
 	ds      ds.Datastore
 
 	// Used to ensure we assign IPNS records *sequential* sequence numbers.
-	mu sync.Mutex
+	// Names are locked apart, so that they're published concurrently.
+	mu    sync.Mutex
+	locks map[peer.ID]*nameLock
+}
+
+type nameLock struct {
+	sync.Mutex
+	refs int
 }
 
 // NewIpnsPublisher constructs a publisher for the IPFS Routing name system.
@@ -39,7 +47,32 @@ func NewIpnsPublisher(route routing.ValueStore, ds ds.Datastore) *IpnsPublisher
 	if ds == nil {
 		panic("nil datastore")
 	}
-	return &IpnsPublisher{routing: route, ds: ds}
+	return &IpnsPublisher{routing: route, ds: ds, locks: make(map[peer.ID]*nameLock)}
+}
+
+// lockName locks the records of the name, returning the function unlocking
+// them.
+func (p *IpnsPublisher) lockName(id peer.ID) func() {
+	p.mu.Lock()
+	l, ok := p.locks[id]
+	if !ok {
+		l = new(nameLock)
+		p.locks[id] = l
+	}
+	l.refs++
+	p.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		p.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(p.locks, id)
+		}
+		p.mu.Unlock()
+	}
 }
 
 // Publish implements Publisher. Accepts a keypair and a value,
@@ -143,8 +176,7 @@ func (p *IpnsPublisher) updateRecord(ctx context.Context, k ci.PrivKey, value pa
 		return nil, err
 	}
 
-	p.mu.Lock()
-	defer p.mu.Unlock()
+	defer p.lockName(id)()
 
 	// get previous records sequence number
 	rec, err := p.GetPublished(ctx, id, true)
@@ -188,6 +220,92 @@ func (p *IpnsPublisher) updateRecord(ctx context.Context, k ci.PrivKey, value pa
 	return entry, nil
 }
 
+// CreateRecord returns a record of the value signed with the key, valid until
+// eol and cached for ttl if positive. The public key is embedded in the
+// record when it can't be derived from the name, so that the record can be
+// validated on its own.
+func CreateRecord(k ci.PrivKey, value path.Path, seqno uint64, eol time.Time, ttl time.Duration) (*pb.IpnsEntry, error) {
+	entry, err := ipns.Create(k, []byte(value), seqno, eol)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		entry.Ttl = proto.Uint64(uint64(ttl.Nanoseconds()))
+	}
+	if err := ipns.EmbedPublicKey(k.GetPublic(), entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// NextSequence returns the sequence number of a new record of the value for
+// the given name, following the last record this node published for it.
+func (p *IpnsPublisher) NextSequence(ctx context.Context, id peer.ID, value path.Path) (uint64, error) {
+	rec, err := p.GetPublished(ctx, id, false)
+	if err != nil {
+		return 0, err
+	}
+	seqno := rec.GetSequence() // returns 0 if rec is nil
+	if rec != nil && value != path.Path(rec.GetValue()) {
+		seqno++
+	}
+	return seqno, nil
+}
+
+// PutRecord publishes a record signed elsewhere for the given name, after
+// validating it. Records older than the last one published for the name are
+// refused.
+func (p *IpnsPublisher) PutRecord(ctx context.Context, id peer.ID, entry *pb.IpnsEntry) error {
+	pk, err := ipns.ExtractPublicKey(id, entry)
+	if err == peer.ErrNoPublicKey {
+		// the key of the name may be known by the routing system
+		if pk, err = routing.GetPublicKey(p.routing, ctx, id); err != nil {
+			return fmt.Errorf("no public key for %s: %s", id, err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := ipns.Validate(pk, entry); err != nil {
+		return err
+	}
+
+	if err := p.storeRecord(ctx, id, entry); err != nil {
+		return err
+	}
+	return PutRecordToRouting(ctx, p.routing, pk, entry)
+}
+
+// storeRecord stores the record as the last one published for the name,
+// unless it's older.
+func (p *IpnsPublisher) storeRecord(ctx context.Context, id peer.ID, entry *pb.IpnsEntry) error {
+	defer p.lockName(id)()
+
+	rec, err := p.GetPublished(ctx, id, true)
+	if err != nil {
+		return err
+	}
+	if rec != nil {
+		cmp, err := ipns.Compare(entry, rec)
+		if err != nil {
+			return err
+		}
+		if cmp < 0 {
+			return fmt.Errorf("the record is older than the last one published, with sequence number %d", rec.GetSequence())
+		}
+	}
+
+	data, err := proto.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	key := IpnsDsKey(id)
+	if err := p.ds.Put(key, data); err != nil {
+		return err
+	}
+	return p.ds.Sync(key)
+}
+
 // PublishWithEOL is a temporary stand in for the ipns records implementation
 // see here for more details: https://github.com/ipfs/specs/tree/master/records
 func (p *IpnsPublisher) PublishWithEOL(ctx context.Context, k ci.PrivKey, value path.Path, eol time.Time) error {
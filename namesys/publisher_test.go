@@ -12,6 +12,7 @@ import (
 	dshelp "github.com/ipfs/go-ipfs-ds-help"
 	mockrouting "github.com/ipfs/go-ipfs-routing/mock"
 	ipns "github.com/ipfs/go-ipns"
+	pb "github.com/ipfs/go-ipns/pb"
 	ci "github.com/libp2p/go-libp2p-core/crypto"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	testutil "github.com/libp2p/go-libp2p-testing/net"
@@ -153,3 +154,79 @@ func (d *checkSyncDS) Sync(prefix ds.Key) error {
 	d.syncKeys[prefix] = struct{}{}
 	return d.Datastore.Sync(prefix)
 }
+
+func TestPutRecord(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	r := mockrouting.NewServer().ClientWithDatastore(ctx, testutil.RandIdentityOrFatal(t), dstore)
+	publisher := NewIpnsPublisher(r, dstore)
+
+	// records are signed elsewhere, with a key whose ID doesn't embed it
+	privKey, pubKey, err := ci.GenerateKeyPairWithReader(ci.RSA, 2048, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _, err := ci.GenerateKeyPairWithReader(ci.Ed25519, 0, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := path.FromString("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn")
+	seqno, err := publisher.NextSequence(ctx, id, value)
+	if err != nil || seqno != 0 {
+		t.Fatalf("expected the first sequence number, got %d, %v", seqno, err)
+	}
+	eol := time.Now().Add(time.Hour)
+	entry, err := CreateRecord(privKey, value, seqno+1, eol, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.GetTtl() != uint64(time.Minute) || entry.PubKey == nil {
+		t.Fatal("expected the record to have a TTL and embed its public key")
+	}
+	if err := publisher.PutRecord(ctx, id, entry); err != nil {
+		t.Fatal(err)
+	}
+	published, err := publisher.GetPublished(ctx, id, false)
+	if err != nil || published.GetSequence() != 1 {
+		t.Fatalf("expected the record to be stored, got %v, %v", published, err)
+	}
+	if _, err := r.GetValue(ctx, ipns.RecordKey(id)); err != nil {
+		t.Fatalf("expected the record to be put to the routing system: %s", err)
+	}
+
+	// the value changes for the next record
+	seqno, err = publisher.NextSequence(ctx, id, path.FromString("/ipfs/QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"))
+	if err != nil || seqno != 2 {
+		t.Fatalf("expected the next sequence number, got %d, %v", seqno, err)
+	}
+
+	for name, create := range map[string]func() (*pb.IpnsEntry, error){
+		"older": func() (*pb.IpnsEntry, error) {
+			return CreateRecord(privKey, value, 0, eol, 0)
+		},
+		"expired": func() (*pb.IpnsEntry, error) {
+			return CreateRecord(privKey, value, 2, time.Now().Add(-time.Hour), 0)
+		},
+		"signed by another key": func() (*pb.IpnsEntry, error) {
+			e, err := ipns.Create(otherKey, []byte(value), 2, eol)
+			if err == nil {
+				err = ipns.EmbedPublicKey(pubKey, e)
+			}
+			return e, err
+		},
+	} {
+		e, err := create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := publisher.PutRecord(ctx, id, e); err == nil {
+			t.Errorf("the %s record should be refused", name)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package republisher
+
+import (
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// ConfigKey is the config section configuring the republisher.
+const ConfigKey = "IpnsRepublisher"
+
+// Config configures the republisher.
+type Config struct {
+	// Exclude are the names or peer IDs of the keys whose records aren't
+	// republished, like records meant to expire.
+	Exclude []string
+}
+
+// LoadConfig reads the IpnsRepublisher section of the config of the given
+// repo.
+func LoadConfig(r repo.Repo) (Config, error) {
+	var cfg Config
+
+	if err := repo.LoadConfigSection(r, ConfigKey, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
@@ -3,6 +3,9 @@ package republisher
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	keystore "github.com/ipfs/go-ipfs/keystore"
@@ -11,6 +14,7 @@ import (
 
 	proto "github.com/gogo/protobuf/proto"
 	ds "github.com/ipfs/go-datastore"
+	ipns "github.com/ipfs/go-ipns"
 	pb "github.com/ipfs/go-ipns/pb"
 	logging "github.com/ipfs/go-log"
 	goprocess "github.com/jbenet/goprocess"
@@ -45,6 +49,59 @@ type Republisher struct {
 
 	// how long records that are republished should be valid for
 	RecordLifetime time.Duration
+
+	// Exclude are the names or peer IDs of the keys whose records aren't
+	// republished.
+	Exclude []string
+
+	// requests to republish now, answered with the outcome
+	trigger chan chan error
+
+	mu     sync.Mutex
+	next   time.Time
+	paused bool
+	keys   map[peer.ID]*keyState
+}
+
+// keyState is what the republisher knows about a key.
+type keyState struct {
+	lastAttempt time.Time
+	lastSuccess time.Time
+	err         error
+	paused      bool
+}
+
+// KeyStatus is the republishing state of a key.
+type KeyStatus struct {
+	// Key is the name of the key, "self" for the key of the node.
+	Key string
+	// Name is the IPNS name of the key.
+	Name string
+	// Value is the value of the record published last.
+	Value string
+	// EOL is the end of the validity of the record published last.
+	EOL time.Time
+	// LastAttempt is the time the record was last republished, if ever, and
+	// LastSuccess the time it was last republished successfully.
+	LastAttempt time.Time
+	LastSuccess time.Time
+	// Error is the error of the last attempt, if it failed.
+	Error string `json:",omitempty"`
+	// NextAttempt is the time the record is republished next, zero if it
+	// isn't.
+	NextAttempt time.Time
+	Paused      bool
+	Excluded    bool
+}
+
+// Status is the state of the republisher.
+type Status struct {
+	// Paused is true if no record is republished.
+	Paused bool
+	// Next is the time the records are republished next.
+	Next time.Time
+	// Keys are the keys with a published record.
+	Keys []KeyStatus
 }
 
 // NewRepublisher creates a new Republisher
@@ -56,64 +113,256 @@ func NewRepublisher(ns namesys.Publisher, ds ds.Datastore, self ic.PrivKey, ks k
 		ks:             ks,
 		Interval:       DefaultRebroadcastInterval,
 		RecordLifetime: DefaultRecordLifetime,
+		trigger:        make(chan chan error),
+		keys:           make(map[peer.ID]*keyState),
 	}
 }
 
 func (rp *Republisher) Run(proc goprocess.Process) {
-	timer := time.NewTimer(InitialRebroadcastDelay)
-	defer timer.Stop()
+	delay := InitialRebroadcastDelay
 	if rp.Interval < InitialRebroadcastDelay {
-		timer.Reset(rp.Interval)
+		delay = rp.Interval
 	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	rp.setNext(delay)
 
 	for {
+		var done chan error
 		select {
 		case <-timer.C:
-			timer.Reset(rp.Interval)
-			err := rp.republishEntries(proc)
-			if err != nil {
-				log.Info("republisher failed to republish: ", err)
-				if FailureRetryInterval < rp.Interval {
-					timer.Reset(FailureRetryInterval)
+		case done = <-rp.trigger:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
 				}
 			}
 		case <-proc.Closing():
 			return
 		}
+
+		delay = rp.Interval
+		err := rp.republishEntries(proc)
+		if err != nil {
+			log.Warn("republisher failed to republish: ", err)
+			if FailureRetryInterval < rp.Interval {
+				delay = FailureRetryInterval
+			}
+		}
+		timer.Reset(delay)
+		rp.setNext(delay)
+
+		if done != nil {
+			done <- err
+		}
 	}
 }
 
-func (rp *Republisher) republishEntries(p goprocess.Process) error {
-	ctx, cancel := context.WithCancel(gpctx.OnClosingContext(p))
-	defer cancel()
+func (rp *Republisher) setNext(delay time.Duration) {
+	rp.mu.Lock()
+	rp.next = time.Now().Add(delay)
+	rp.mu.Unlock()
+}
+
+// RepublishNow republishes the records immediately, instead of at the next
+// scheduled time, and returns once they're republished. It waits for the
+// republishing in progress, if any, and fails if the republisher isn't
+// running.
+func (rp *Republisher) RepublishNow(ctx context.Context) error {
+	done := make(chan error, 1)
+	select {
+	case rp.trigger <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause stops republishing the records of the given keys, or all of them if
+// none is given, until they're resumed.
+func (rp *Republisher) Pause(ids ...peer.ID) {
+	rp.setPaused(true, ids)
+}
+
+// Resume republishes the records of the given keys, or all of them if none is
+// given, after a pause.
+func (rp *Republisher) Resume(ids ...peer.ID) {
+	rp.setPaused(false, ids)
+}
+
+func (rp *Republisher) setPaused(paused bool, ids []peer.ID) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if len(ids) == 0 {
+		rp.paused = paused
+		if !paused {
+			for _, s := range rp.keys {
+				s.paused = false
+			}
+		}
+		return
+	}
+	for _, id := range ids {
+		rp.state(id).paused = paused
+	}
+}
+
+// state returns the state of the key, with rp.mu held.
+func (rp *Republisher) state(id peer.ID) *keyState {
+	s, ok := rp.keys[id]
+	if !ok {
+		s = new(keyState)
+		rp.keys[id] = s
+	}
+	return s
+}
+
+// Status returns the state of the republisher and of the keys with a
+// published record.
+func (rp *Republisher) Status() (*Status, error) {
+	keys, err := rp.listKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	st := &Status{Paused: rp.paused, Next: rp.next}
+	for _, k := range keys {
+		e, err := rp.getLastEntry(k.id)
+		if err == errNoEntry {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ks := KeyStatus{
+			Key:      k.name,
+			Name:     peer.Encode(k.id),
+			Value:    string(e.GetValue()),
+			Excluded: rp.excluded(k.name, k.id),
+		}
+		if eol, err := ipns.GetEOL(e); err == nil {
+			ks.EOL = eol
+		}
+		if s, ok := rp.keys[k.id]; ok {
+			ks.LastAttempt = s.lastAttempt
+			ks.LastSuccess = s.lastSuccess
+			if s.err != nil {
+				ks.Error = s.err.Error()
+			}
+			ks.Paused = s.paused
+		}
+		if !rp.paused && !ks.Paused && !ks.Excluded {
+			ks.NextAttempt = rp.next
+		}
+		st.Keys = append(st.Keys, ks)
+	}
+	return st, nil
+}
+
+// excluded returns whether the records of the key aren't republished, by
+// config.
+func (rp *Republisher) excluded(name string, id peer.ID) bool {
+	for _, e := range rp.Exclude {
+		if e == name || e == peer.Encode(id) {
+			return true
+		}
+	}
+	return false
+}
+
+type key struct {
+	name string
+	id   peer.ID
+	priv ic.PrivKey
+}
+
+// listKeys returns the key of the node and the keys of the keystore, sorted by
+// name.
+func (rp *Republisher) listKeys() ([]key, error) {
+	id, err := peer.IDFromPrivateKey(rp.self)
+	if err != nil {
+		return nil, err
+	}
+	keys := []key{{name: "self", id: id, priv: rp.self}}
 
 	// TODO: Use rp.ipns.ListPublished(). We can't currently *do* that
 	// because:
 	// 1. There's no way to get keys from the keystore by ID.
 	// 2. We don't actually have access to the IPNS publisher.
-	err := rp.republishEntry(ctx, rp.self)
-	if err != nil {
-		return err
-	}
-
 	if rp.ks != nil {
 		keyNames, err := rp.ks.List()
 		if err != nil {
-			return err
+			return nil, err
 		}
+		sort.Strings(keyNames)
 		for _, name := range keyNames {
 			priv, err := rp.ks.Get(name)
 			if err != nil {
-				return err
+				return nil, err
 			}
-			err = rp.republishEntry(ctx, priv)
+			id, err := peer.IDFromPrivateKey(priv)
 			if err != nil {
-				return err
+				return nil, err
 			}
+			keys = append(keys, key{name: name, id: id, priv: priv})
+		}
+	}
+	return keys, nil
+}
 
+func (rp *Republisher) republishEntries(p goprocess.Process) error {
+	ctx, cancel := context.WithCancel(gpctx.OnClosingContext(p))
+	defer cancel()
+
+	keys, err := rp.listKeys()
+	if err != nil {
+		return err
+	}
+
+	var attempted, failed int
+	for _, k := range keys {
+		rp.mu.Lock()
+		skip := rp.paused || rp.state(k.id).paused || rp.excluded(k.name, k.id)
+		rp.mu.Unlock()
+		if skip {
+			continue
+		}
+
+		err := rp.republishEntry(ctx, k.priv)
+		if err == errNoEntry {
+			continue
+		}
+
+		attempted++
+		rp.mu.Lock()
+		s := rp.state(k.id)
+		s.lastAttempt = time.Now()
+		s.err = err
+		if err == nil {
+			s.lastSuccess = s.lastAttempt
+		}
+		rp.mu.Unlock()
+
+		if err != nil {
+			log.Warnf("failed to republish the record of key %s: %s", k.name, err)
+			failed++
 		}
 	}
 
+	if failed > 0 {
+		return fmt.Errorf("failed to republish %d of %d records", failed, attempted)
+	}
 	return nil
 }
 
@@ -128,9 +377,6 @@ func (rp *Republisher) republishEntry(ctx context.Context, priv ic.PrivKey) erro
 	// Look for it locally only
 	p, err := rp.getLastVal(id)
 	if err != nil {
-		if err == errNoEntry {
-			return nil
-		}
 		return err
 	}
 
@@ -140,19 +386,27 @@ func (rp *Republisher) republishEntry(ctx context.Context, priv ic.PrivKey) erro
 }
 
 func (rp *Republisher) getLastVal(id peer.ID) (path.Path, error) {
+	e, err := rp.getLastEntry(id)
+	if err != nil {
+		return "", err
+	}
+	return path.Path(e.Value), nil
+}
+
+func (rp *Republisher) getLastEntry(id peer.ID) (*pb.IpnsEntry, error) {
 	// Look for it locally only
 	val, err := rp.ds.Get(namesys.IpnsDsKey(id))
 	switch err {
 	case nil:
 	case ds.ErrNotFound:
-		return "", errNoEntry
+		return nil, errNoEntry
 	default:
-		return "", err
+		return nil, err
 	}
 
 	e := new(pb.IpnsEntry)
 	if err := proto.Unmarshal(val, e); err != nil {
-		return "", err
+		return nil, err
 	}
-	return path.Path(e.Value), nil
+	return e, nil
 }
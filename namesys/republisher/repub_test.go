@@ -2,18 +2,26 @@ package republisher_test
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/bootstrap"
 	mock "github.com/ipfs/go-ipfs/core/mock"
+	"github.com/ipfs/go-ipfs/keystore"
 	namesys "github.com/ipfs/go-ipfs/namesys"
 	. "github.com/ipfs/go-ipfs/namesys/republisher"
 	path "github.com/ipfs/go-path"
 
+	proto "github.com/gogo/protobuf/proto"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ipns "github.com/ipfs/go-ipns"
 	goprocess "github.com/jbenet/goprocess"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
 )
@@ -109,6 +117,158 @@ func TestRepublish(t *testing.T) {
 	}
 }
 
+// fakePublisher records the names published, failing for the failing one.
+type fakePublisher struct {
+	namesys.Publisher
+
+	mu        sync.Mutex
+	published []peer.ID
+	failing   peer.ID
+}
+
+func (p *fakePublisher) PublishWithEOL(ctx context.Context, k ci.PrivKey, value path.Path, eol time.Time) error {
+	id, err := peer.IDFromPrivateKey(k)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if id == p.failing {
+		return errors.New("failing")
+	}
+	p.published = append(p.published, id)
+	return nil
+}
+
+func (p *fakePublisher) reset() []peer.ID {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	published := p.published
+	p.published = nil
+	return published
+}
+
+func TestRepublisherState(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	ks := keystore.NewMemKeystore()
+
+	// the node and its keys publish records, except "unpublished"
+	ids := make(map[string]peer.ID)
+	var self ci.PrivKey
+	for _, name := range []string{"self", "paused", "excluded", "unpublished"} {
+		k, _, err := ci.GenerateKeyPairWithReader(ci.Ed25519, 0, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "self" {
+			self = k
+		} else if err := ks.Put(name, k); err != nil {
+			t.Fatal(err)
+		}
+		if ids[name], err = peer.IDFromPrivateKey(k); err != nil {
+			t.Fatal(err)
+		}
+		if name == "unpublished" {
+			continue
+		}
+
+		entry, err := ipns.Create(k, []byte("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"), 0, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := proto.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := dstore.Put(namesys.IpnsDsKey(ids[name]), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pub := new(fakePublisher)
+	repub := NewRepublisher(pub, dstore, self, ks)
+	repub.Interval = time.Hour
+	repub.Exclude = []string{"excluded"}
+	repub.Pause(ids["paused"])
+
+	// the republisher must run to republish now
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := repub.RepublishNow(timeoutCtx); err != context.DeadlineExceeded {
+		t.Fatalf("expected the republisher not to run, got %v", err)
+	}
+
+	proc := goprocess.Go(repub.Run)
+	defer proc.Close()
+
+	if err := repub.RepublishNow(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if published := pub.reset(); len(published) != 1 || published[0] != ids["self"] {
+		t.Fatalf("expected only the key of the node to be republished, got %v", published)
+	}
+
+	st, err := repub.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Paused || st.Next.Before(time.Now().Add(59*time.Minute)) {
+		t.Errorf("unexpected state %+v", st)
+	}
+	if len(st.Keys) != 3 {
+		t.Fatalf("expected the keys with a record, got %+v", st.Keys)
+	}
+	for _, k := range st.Keys {
+		if k.Name != peer.Encode(ids[k.Key]) || k.EOL.IsZero() {
+			t.Errorf("unexpected state of key %+v", k)
+		}
+		switch k.Key {
+		case "self":
+			if k.LastSuccess.IsZero() || k.LastSuccess != k.LastAttempt || k.NextAttempt != st.Next || k.Error != "" {
+				t.Errorf("expected the key of the node to be republished, got %+v", k)
+			}
+		case "paused":
+			if !k.Paused || !k.LastAttempt.IsZero() || !k.NextAttempt.IsZero() {
+				t.Errorf("expected the key to be paused, got %+v", k)
+			}
+		case "excluded":
+			if !k.Excluded || !k.LastAttempt.IsZero() || !k.NextAttempt.IsZero() {
+				t.Errorf("expected the key to be excluded, got %+v", k)
+			}
+		default:
+			t.Errorf("unexpected key %+v", k)
+		}
+	}
+
+	// failures are reported by key, without stopping the other keys
+	repub.Resume()
+	pub.failing = ids["self"]
+	if err := repub.RepublishNow(ctx); err == nil {
+		t.Fatal("expected the republishing to fail")
+	}
+	if published := pub.reset(); len(published) != 1 || published[0] != ids["paused"] {
+		t.Fatalf("expected the resumed key to be republished, got %v", published)
+	}
+	st, err = repub.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range st.Keys {
+		if k.Key == "self" && (k.Error != "failing" || !k.LastSuccess.Before(k.LastAttempt)) {
+			t.Errorf("expected the failure to be reported, got %+v", k)
+		}
+	}
+
+	repub.Pause()
+	if err := repub.RepublishNow(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if published := pub.reset(); len(published) != 0 {
+		t.Fatalf("expected nothing to be republished while paused, got %v", published)
+	}
+}
+
 func verifyResolution(nodes []*core.IpfsNode, key string, exp path.Path) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/ipfs/go-path"
 
@@ -18,35 +19,44 @@ var ErrNoNamesys = errors.New(
 
 // ResolveIPNS resolves /ipns paths
 func ResolveIPNS(ctx context.Context, nsys namesys.NameSystem, p path.Path) (path.Path, error) {
+	p, _, err := ResolveIPNSWithTTL(ctx, nsys, p)
+	return p, err
+}
+
+// ResolveIPNSWithTTL resolves /ipns paths like ResolveIPNS, also returning how
+// long the result may be cached, zero when unknown or for other paths.
+func ResolveIPNSWithTTL(ctx context.Context, nsys namesys.NameSystem, p path.Path) (path.Path, time.Duration, error) {
+	var ttl time.Duration
 	if strings.HasPrefix(p.String(), "/ipns/") {
 		// TODO(cryptix): we should be able to query the local cache for the path
 		if nsys == nil {
-			return "", ErrNoNamesys
+			return "", 0, ErrNoNamesys
 		}
 
 		seg := p.Segments()
 
 		if len(seg) < 2 || seg[1] == "" { // just "/<protocol/>" without further segments
 			err := fmt.Errorf("invalid path %q: ipns path missing IPNS ID", p)
-			return "", err
+			return "", 0, err
 		}
 
 		extensions := seg[2:]
 		resolvable, err := path.FromSegments("/", seg[0], seg[1])
 		if err != nil {
-			return "", err
+			return "", 0, err
 		}
 
-		respath, err := nsys.Resolve(ctx, resolvable.String())
+		var respath path.Path
+		respath, ttl, err = namesys.ResolveWithTTL(ctx, nsys, resolvable.String())
 		if err != nil {
-			return "", err
+			return "", 0, err
 		}
 
 		segments := append(respath.Segments(), extensions...)
 		p, err = path.FromSegments("/", segments...)
 		if err != nil {
-			return "", err
+			return "", 0, err
 		}
 	}
-	return p, nil
+	return p, ttl, nil
 }
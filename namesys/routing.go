@@ -23,6 +23,9 @@ var log = logging.Logger("namesys")
 // IpnsResolver implements NSResolver for the main IPFS SFS-like naming
 type IpnsResolver struct {
 	routing routing.ValueStore
+
+	// cache keeps the resolved records, if set.
+	cache *PersistentCache
 }
 
 // NewIpnsResolver constructs a name resolver using the IPFS Routing system
@@ -49,32 +52,110 @@ func (r *IpnsResolver) ResolveAsync(ctx context.Context, name string, options ..
 // resolveOnce implements resolver. Uses the IPFS routing system to
 // resolve SFS-like names.
 func (r *IpnsResolver) resolveOnceAsync(ctx context.Context, name string, options opts.ResolveOpts) <-chan onceResult {
-	out := make(chan onceResult, 1)
 	log.Debugf("RoutingResolver resolving %s", name)
-	cancel := func() {}
-
-	if options.DhtTimeout != 0 {
-		// Resolution must complete within the timeout
-		ctx, cancel = context.WithTimeout(ctx, options.DhtTimeout)
-	}
 
 	name = strings.TrimPrefix(name, "/ipns/")
 
 	pid, err := peer.Decode(name)
 	if err != nil {
 		log.Debugf("RoutingResolver: could not convert public key hash %s to peer ID: %s\n", name, err)
+		out := make(chan onceResult, 1)
 		out <- onceResult{err: err}
 		close(out)
-		cancel()
 		return out
 	}
 
+	if r.cache != nil {
+		if entry, fresh, ok := r.cache.Get(pid); ok {
+			if fresh > 0 {
+				p, err := recordPath(entry)
+				out := make(chan onceResult, 1)
+				out <- onceResult{value: p, ttl: fresh, err: err}
+				close(out)
+				return out
+			}
+			return r.resolveStale(ctx, pid, entry, options)
+		}
+	}
+
+	return r.resolveRouting(ctx, pid, options)
+}
+
+// resolveStale resolves a name whose cached record is past its TTL. The record
+// is served unless the routing system resolves the name within the stale
+// timeout, and refreshed in the background otherwise.
+func (r *IpnsResolver) resolveStale(ctx context.Context, pid peer.ID, entry *pb.IpnsEntry, options opts.ResolveOpts) <-chan onceResult {
+	out := make(chan onceResult, 1)
+
+	p, err := recordPath(entry)
+	if err != nil {
+		return r.resolveRouting(ctx, pid, options)
+	}
+	stale := onceResult{value: p}
+
+	if !r.cache.startRevalidation(pid) {
+		// another resolution is refreshing the record
+		out <- stale
+		close(out)
+		return out
+	}
+
+	rctx, cancel := context.WithTimeout(context.Background(), revalidationTimeout)
+	resCh := r.resolveRouting(rctx, pid, options)
+	done := func() {
+		for range resCh {
+		}
+		cancel()
+		r.cache.endRevalidation(pid)
+	}
+
+	go func() {
+		defer close(out)
+		timer := time.NewTimer(r.cache.StaleTimeout)
+		defer timer.Stop()
+
+		select {
+		case res, ok := <-resCh:
+			if ok && res.err == nil {
+				emitOnceResult(ctx, out, res)
+				for res := range resCh {
+					emitOnceResult(ctx, out, res)
+				}
+				done()
+				return
+			}
+			if ok {
+				log.Debugf("RoutingResolver: serving the stale record of %s: %s", pid, res.err)
+			}
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+
+		emitOnceResult(ctx, out, stale)
+		go done()
+	}()
+
+	return out
+}
+
+// resolveRouting resolves the name with the routing system.
+func (r *IpnsResolver) resolveRouting(ctx context.Context, pid peer.ID, options opts.ResolveOpts) <-chan onceResult {
+	out := make(chan onceResult, 1)
+	cancel := func() {}
+
+	if options.DhtTimeout != 0 {
+		// Resolution must complete within the timeout
+		ctx, cancel = context.WithTimeout(ctx, options.DhtTimeout)
+	}
+
+	name := peer.Encode(pid)
+
 	// Name should be the hash of a public key retrievable from ipfs.
 	// We retrieve the public key here to make certain that it's in the peer
 	// store before calling GetValue() on the DHT - the DHT will call the
 	// ipns validator, which in turn will get the public key from the peer
 	// store to verify the record signature
-	_, err = routing.GetPublicKey(r.routing, ctx, pid)
+	pubk, err := routing.GetPublicKey(r.routing, ctx, pid)
 	if err != nil {
 		log.Debugf("RoutingResolver: could not retrieve public key %s: %s\n", name, err)
 		out <- onceResult{err: err}
@@ -115,42 +196,25 @@ func (r *IpnsResolver) resolveOnceAsync(ctx context.Context, name string, option
 					return
 				}
 
-				var p path.Path
-				// check for old style record:
-				if valh, err := mh.Cast(entry.GetValue()); err == nil {
-					// Its an old style multihash record
-					log.Debugf("encountered CIDv0 ipns entry: %s", valh)
-					p = path.FromCid(cid.NewCidV0(valh))
-				} else {
-					// Not a multihash, probably a new style record
-					p, err = path.ParsePath(string(entry.GetValue()))
-					if err != nil {
-						emitOnceResult(ctx, out, onceResult{err: err})
-						return
-					}
+				p, err := recordPath(entry)
+				if err != nil {
+					emitOnceResult(ctx, out, onceResult{err: err})
+					return
 				}
 
-				ttl := DefaultResolverCacheTTL
-				if entry.Ttl != nil {
-					ttl = time.Duration(*entry.Ttl)
-				}
-				switch eol, err := ipns.GetEOL(entry); err {
-				case ipns.ErrUnrecognizedValidity:
-					// No EOL.
-				case nil:
-					ttEol := time.Until(eol)
-					if ttEol < 0 {
-						// It *was* valid when we first resolved it.
-						ttl = 0
-					} else if ttEol < ttl {
-						ttl = ttEol
-					}
-				default:
+				ttl, err := recordTTL(entry)
+				if err != nil {
 					log.Errorf("encountered error when parsing EOL: %s", err)
 					emitOnceResult(ctx, out, onceResult{err: err})
 					return
 				}
 
+				if r.cache != nil {
+					if err := r.cache.Put(pid, pubk, entry); err != nil {
+						log.Errorf("failed to cache the record of %s: %s", name, err)
+					}
+				}
+
 				emitOnceResult(ctx, out, onceResult{value: p, ttl: ttl})
 			case <-ctx.Done():
 				return
@@ -160,3 +224,39 @@ func (r *IpnsResolver) resolveOnceAsync(ctx context.Context, name string, option
 
 	return out
 }
+
+// recordPath returns the path the record points to.
+func recordPath(entry *pb.IpnsEntry) (path.Path, error) {
+	// check for old style record:
+	if valh, err := mh.Cast(entry.GetValue()); err == nil {
+		// Its an old style multihash record
+		log.Debugf("encountered CIDv0 ipns entry: %s", valh)
+		return path.FromCid(cid.NewCidV0(valh)), nil
+	}
+	// Not a multihash, probably a new style record
+	return path.ParsePath(string(entry.GetValue()))
+}
+
+// recordTTL returns how long the path the record points to may be cached,
+// which is at most until the record expires.
+func recordTTL(entry *pb.IpnsEntry) (time.Duration, error) {
+	ttl := DefaultResolverCacheTTL
+	if entry.Ttl != nil {
+		ttl = time.Duration(*entry.Ttl)
+	}
+	switch eol, err := ipns.GetEOL(entry); err {
+	case ipns.ErrUnrecognizedValidity:
+		// No EOL.
+	case nil:
+		ttEol := time.Until(eol)
+		if ttEol < 0 {
+			// It *was* valid when we first resolved it.
+			ttl = 0
+		} else if ttEol < ttl {
+			ttl = ttEol
+		}
+	default:
+		return 0, err
+	}
+	return ttl, nil
+}
@@ -0,0 +1,180 @@
+// Package pinmeta stores the names and labels attached to pins.
+//
+// The pinner only knows about CIDs: metadata is kept separately in the
+// datastore, keyed by the CID of the pinned object.
+package pinmeta
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("pinmeta")
+
+// Prefix is the datastore namespace holding pin metadata.
+var Prefix = ds.NewKey("/local/pinmeta")
+
+// Meta is the metadata attached to a pin.
+type Meta struct {
+	Name   string            `json:",omitempty"`
+	Labels map[string]string `json:",omitempty"`
+}
+
+// IsEmpty returns whether no metadata is set.
+func (m Meta) IsEmpty() bool {
+	return m.Name == "" && len(m.Labels) == 0
+}
+
+// Matches returns whether m has the given name, unless name is empty, and all
+// the given labels.
+func (m Meta) Matches(name string, labels map[string]string) bool {
+	if name != "" && m.Name != name {
+		return false
+	}
+	for k, v := range labels {
+		if mv, ok := m.Labels[k]; !ok || mv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabels parses labels given as "key=value" strings.
+func ParseLabels(strs []string) (map[string]string, error) {
+	if len(strs) == 0 {
+		return nil, nil
+	}
+
+	labels := make(map[string]string, len(strs))
+	for _, s := range strs {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid label %q, must be key=value", s)
+		}
+		labels[kv[0]] = kv[1]
+	}
+	return labels, nil
+}
+
+// Store persists pin metadata in a datastore.
+type Store struct {
+	dstore ds.Datastore
+}
+
+// NewStore returns a Store persisting metadata in the given datastore.
+func NewStore(d ds.Datastore) *Store {
+	return &Store{dstore: d}
+}
+
+func metaKey(c cid.Cid) ds.Key {
+	return Prefix.Child(dshelp.CidToDsKey(c))
+}
+
+// Get returns the metadata attached to the pin of c, which is empty if there
+// is none.
+func (s *Store) Get(c cid.Cid) (Meta, error) {
+	var m Meta
+
+	data, err := s.dstore.Get(metaKey(c))
+	switch err {
+	case nil:
+	case ds.ErrNotFound:
+		return m, nil
+	default:
+		return m, err
+	}
+
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("invalid metadata for pin %s: %s", c, err)
+	}
+	return m, nil
+}
+
+// Put attaches metadata to the pin of c, replacing any previous metadata.
+// Putting empty metadata removes it.
+func (s *Store) Put(c cid.Cid, m Meta) error {
+	if m.IsEmpty() {
+		return s.Delete(c)
+	}
+
+	data, err := json.Marshal(&m)
+	if err != nil {
+		return err
+	}
+	return s.dstore.Put(metaKey(c), data)
+}
+
+// Delete removes the metadata attached to the pin of c, if any.
+func (s *Store) Delete(c cid.Cid) error {
+	err := s.dstore.Delete(metaKey(c))
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// Update carries the metadata of the pin of from over to the pin of to, for
+// when a pin is updated. The metadata of from is removed if unpin is true.
+// If to already has metadata, it is left untouched.
+func (s *Store) Update(from, to cid.Cid, unpin bool) error {
+	m, err := s.Get(from)
+	if err != nil || m.IsEmpty() {
+		return err
+	}
+
+	existing, err := s.Get(to)
+	if err != nil {
+		return err
+	}
+	if existing.IsEmpty() {
+		if err := s.Put(to, m); err != nil {
+			return err
+		}
+	}
+
+	if unpin && !from.Equals(to) {
+		return s.Delete(from)
+	}
+	return nil
+}
+
+// Find returns the CIDs of the pins whose metadata matches the given name
+// and labels.
+func (s *Store) Find(name string, labels map[string]string) ([]cid.Cid, error) {
+	res, err := s.dstore.Query(dsq.Query{Prefix: Prefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var out []cid.Cid
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+
+		var m Meta
+		if err := json.Unmarshal(e.Value, &m); err != nil {
+			log.Errorf("ignoring invalid pin metadata at %s: %s", e.Key, err)
+			continue
+		}
+		if !m.Matches(name, labels) {
+			continue
+		}
+
+		c, err := dshelp.DsKeyToCid(ds.RawKey(e.Key[len(Prefix.String()):]))
+		if err != nil {
+			log.Errorf("ignoring pin metadata with invalid key %s: %s", e.Key, err)
+			continue
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
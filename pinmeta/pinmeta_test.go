@@ -0,0 +1,96 @@
+package pinmeta
+
+import (
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func testCid(t *testing.T, data string) cid.Cid {
+	h, err := mh.Sum([]byte(data), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(cid.Raw, h)
+}
+
+func TestStore(t *testing.T) {
+	s := NewStore(dssync.MutexWrap(ds.NewMapDatastore()))
+
+	a, b, c := testCid(t, "a"), testCid(t, "b"), testCid(t, "c")
+
+	m, err := s.Get(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.IsEmpty() {
+		t.Fatal("expected no metadata")
+	}
+
+	if err := s.Put(a, Meta{Name: "site", Labels: map[string]string{"team": "web", "env": "prod"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(b, Meta{Name: "backup", Labels: map[string]string{"team": "ops"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = s.Get(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "site" || m.Labels["env"] != "prod" {
+		t.Fatalf("unexpected metadata: %+v", m)
+	}
+
+	found, err := s.Find("", map[string]string{"team": "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || !found[0].Equals(a) {
+		t.Fatalf("unexpected pins found by label: %v", found)
+	}
+	found, err = s.Find("backup", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || !found[0].Equals(b) {
+		t.Fatalf("unexpected pins found by name: %v", found)
+	}
+
+	// updating a pin carries its metadata over
+	if err := s.Update(a, c, true); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := s.Get(c); m.Name != "site" {
+		t.Fatalf("metadata not carried over: %+v", m)
+	}
+	if m, _ := s.Get(a); !m.IsEmpty() {
+		t.Fatalf("old pin should have lost its metadata: %+v", m)
+	}
+
+	if err := s.Delete(c); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := s.Get(c); !m.IsEmpty() {
+		t.Fatal("metadata should have been deleted")
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels([]string{"team=web", "note=a=b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels["team"] != "web" || labels["note"] != "a=b" {
+		t.Fatalf("unexpected labels: %v", labels)
+	}
+
+	for _, bad := range []string{"team", "=web"} {
+		if _, err := ParseLabels([]string{bad}); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
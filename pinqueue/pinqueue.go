@@ -0,0 +1,360 @@
+// Package pinqueue implements a persistent queue of pins, processed in the
+// background.
+//
+// Jobs are kept in the datastore until the object is pinned, so that pins
+// interrupted by a restart are resumed: the blocks fetched before the restart
+// are still in the blockstore and don't need fetching again.
+package pinqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	provider "github.com/ipfs/go-ipfs-provider"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+	dag "github.com/ipfs/go-merkledag"
+
+	"github.com/ipfs/go-ipfs/pinmeta"
+)
+
+var log = logging.Logger("pinqueue")
+
+// Prefix is the datastore namespace holding the queued pins.
+var Prefix = ds.NewKey("/local/pinqueue")
+
+// DefaultWorkers is the default number of pins processed at the same time.
+const DefaultWorkers = 2
+
+// how often the progress of jobs is persisted
+var progressInterval = time.Second
+
+// Status is the status of a job.
+type Status string
+
+// The statuses of jobs. Jobs are removed once the object is pinned.
+const (
+	StatusQueued  Status = "queued"
+	StatusPinning Status = "pinning"
+	StatusFailed  Status = "failed"
+)
+
+// Job is a queued pin.
+type Job struct {
+	ID        string
+	Cid       cid.Cid
+	Recursive bool
+	Meta      pinmeta.Meta `json:",omitempty"`
+	Status    Status
+	// Progress is the number of nodes fetched so far.
+	Progress int    `json:",omitempty"`
+	Error    string `json:",omitempty"`
+	Created  time.Time
+}
+
+// Queue is a persistent queue of pins.
+type Queue struct {
+	dstore   ds.Datastore
+	bs       bstore.GCBlockstore
+	dag      ipld.DAGService
+	pinner   pin.Pinner
+	meta     *pinmeta.Store
+	provider provider.System
+
+	// lk serializes changes to the jobs
+	lk     sync.Mutex
+	active map[string]context.CancelFunc
+	wake   chan struct{}
+}
+
+// New returns a queue persisting jobs in the given datastore, and pinning
+// objects with the given pinner.
+func New(d ds.Datastore, bs bstore.GCBlockstore, dserv ipld.DAGService, pinner pin.Pinner, meta *pinmeta.Store, prov provider.System) *Queue {
+	return &Queue{
+		dstore:   d,
+		bs:       bs,
+		dag:      dserv,
+		pinner:   pinner,
+		meta:     meta,
+		provider: prov,
+		active:   make(map[string]context.CancelFunc),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+func jobKey(id string) ds.Key {
+	return Prefix.ChildString(id)
+}
+
+func (q *Queue) load(id string) (*Job, error) {
+	data, err := q.dstore.Get(jobKey(id))
+	if err != nil {
+		return nil, err
+	}
+
+	j := new(Job)
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("invalid pin job %s: %s", id, err)
+	}
+	return j, nil
+}
+
+func (q *Queue) store(j *Job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return q.dstore.Put(jobKey(j.ID), data)
+}
+
+// update applies fn to a job and persists it. It returns ds.ErrNotFound if
+// the job was removed.
+func (q *Queue) update(id string, fn func(*Job)) error {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	j, err := q.load(id)
+	if err != nil {
+		return err
+	}
+	fn(j)
+	return q.store(j)
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Add queues a pin of c. If the same pin is already queued, the existing
+// job is returned.
+func (q *Queue) Add(c cid.Cid, recursive bool, meta pinmeta.Meta) (*Job, error) {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	jobs, err := q.Jobs()
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range jobs {
+		if j.Cid.Equals(c) && j.Recursive == recursive && j.Status != StatusFailed {
+			return j, nil
+		}
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	j := &Job{
+		ID:        hex.EncodeToString(b),
+		Cid:       c,
+		Recursive: recursive,
+		Meta:      meta,
+		Status:    StatusQueued,
+		Created:   time.Now().UTC(),
+	}
+
+	if err := q.store(j); err != nil {
+		return nil, err
+	}
+
+	q.notify()
+	return j, nil
+}
+
+// Jobs returns the queued jobs, oldest first.
+func (q *Queue) Jobs() ([]*Job, error) {
+	res, err := q.dstore.Query(dsq.Query{Prefix: Prefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var jobs []*Job
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+		j := new(Job)
+		if err := json.Unmarshal(e.Value, j); err != nil {
+			log.Errorf("ignoring invalid pin job at %s: %s", e.Key, err)
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].Created.Before(jobs[k].Created)
+	})
+	return jobs, nil
+}
+
+// Remove removes a job from the queue, cancelling it if it's being
+// processed.
+func (q *Queue) Remove(id string) error {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	if err := q.dstore.Delete(jobKey(id)); err != nil {
+		return err
+	}
+	if cancel, ok := q.active[id]; ok {
+		cancel()
+	}
+	return nil
+}
+
+// Run processes the queued jobs, the given number at a time, until ctx is
+// done. Jobs that were being processed when the previous run stopped are
+// resumed.
+func (q *Queue) Run(ctx context.Context, workers int) {
+	sem := make(chan struct{}, workers)
+	for {
+		jobs, err := q.Jobs()
+		if err != nil {
+			log.Errorf("failed to list pin jobs: %s", err)
+		}
+
+		for _, j := range jobs {
+			q.lk.Lock()
+			_, running := q.active[j.ID]
+			q.lk.Unlock()
+			if running || j.Status == StatusFailed {
+				continue
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			jctx, cancel := context.WithCancel(ctx)
+			q.lk.Lock()
+			q.active[j.ID] = cancel
+			q.lk.Unlock()
+
+			go func(j *Job) {
+				q.process(jctx, j)
+
+				q.lk.Lock()
+				delete(q.active, j.ID)
+				q.lk.Unlock()
+				cancel()
+				<-sem
+				q.notify()
+			}(j)
+		}
+
+		select {
+		case <-q.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (q *Queue) process(ctx context.Context, j *Job) {
+	err := q.update(j.ID, func(j *Job) {
+		j.Status = StatusPinning
+		j.Error = ""
+	})
+	if err != nil {
+		if err != ds.ErrNotFound {
+			log.Errorf("failed to update pin job %s: %s", j.ID, err)
+		}
+		return
+	}
+
+	tracker := new(dag.ProgressTracker)
+	pctx := tracker.DeriveContext(ctx)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- q.pin(pctx, j)
+	}()
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for finished := false; !finished; {
+		select {
+		case <-ticker.C:
+			progress := tracker.Value()
+			if err := q.update(j.ID, func(j *Job) { j.Progress = progress }); err != nil && err != ds.ErrNotFound {
+				log.Errorf("failed to update pin job %s: %s", j.ID, err)
+			}
+		case err = <-done:
+			finished = true
+		}
+	}
+
+	if err == nil {
+		q.lk.Lock()
+		err = q.dstore.Delete(jobKey(j.ID))
+		q.lk.Unlock()
+		if err != nil && err != ds.ErrNotFound {
+			log.Errorf("failed to remove pin job %s: %s", j.ID, err)
+		}
+		return
+	}
+
+	if ctx.Err() != nil {
+		// the job was removed, or the queue is stopping and the job will
+		// be resumed next time
+		return
+	}
+
+	progress := tracker.Value()
+	uerr := q.update(j.ID, func(j *Job) {
+		j.Status = StatusFailed
+		j.Error = err.Error()
+		j.Progress = progress
+	})
+	if uerr != nil && uerr != ds.ErrNotFound {
+		log.Errorf("failed to update pin job %s: %s", j.ID, uerr)
+	}
+}
+
+// pin fetches the DAG to pin without holding the pin lock, so that long
+// fetches don't block garbage collection, then pins it.
+func (q *Queue) pin(ctx context.Context, j *Job) error {
+	nd, err := q.dag.Get(ctx, j.Cid)
+	if err != nil {
+		return err
+	}
+	if j.Recursive {
+		if err := dag.FetchGraph(ctx, j.Cid, q.dag); err != nil {
+			return err
+		}
+	}
+
+	defer q.bs.PinLock().Unlock()
+
+	// blocks collected since they were fetched are fetched again
+	if err := q.pinner.Pin(ctx, nd, j.Recursive); err != nil {
+		return err
+	}
+	if err := q.pinner.Flush(ctx); err != nil {
+		return err
+	}
+	if !j.Meta.IsEmpty() {
+		if err := q.meta.Put(j.Cid, j.Meta); err != nil {
+			return err
+		}
+	}
+	return q.provider.Provide(j.Cid)
+}
@@ -0,0 +1,162 @@
+package pinqueue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	bserv "github.com/ipfs/go-blockservice"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	provider "github.com/ipfs/go-ipfs-provider"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+
+	"github.com/ipfs/go-ipfs/pinmeta"
+)
+
+type testEnv struct {
+	dstore ds.Datastore
+	bs     bstore.GCBlockstore
+	dserv  ipld.DAGService
+	pinner pin.Pinner
+	meta   *pinmeta.Store
+}
+
+func newTestEnv() *testEnv {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker())
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	return &testEnv{
+		dstore: dstore,
+		bs:     bs,
+		dserv:  dserv,
+		pinner: pin.NewPinner(dstore, dserv, dserv),
+		meta:   pinmeta.NewStore(dstore),
+	}
+}
+
+// queue returns a new queue on top of the environment, as after a restart.
+func (e *testEnv) queue() *Queue {
+	return New(e.dstore, e.bs, e.dserv, e.pinner, e.meta, provider.NewOfflineProvider())
+}
+
+func waitJobs(t *testing.T, q *Queue, n int) []*Job {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		jobs, err := q.Jobs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pending := 0
+		for _, j := range jobs {
+			if j.Status != StatusFailed {
+				pending++
+			}
+		}
+		if pending == 0 && len(jobs) == n {
+			return jobs
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("jobs were not processed")
+	return nil
+}
+
+func TestQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	env := newTestEnv()
+
+	leaf := dag.NodeWithData([]byte("leaf"))
+	root := dag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("leaf", leaf); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.dserv.AddMany(ctx, []ipld.Node{leaf, root}); err != nil {
+		t.Fatal(err)
+	}
+	missing := dag.NodeWithData([]byte("missing"))
+
+	// jobs queued before the queue runs are processed once it does, as
+	// after a restart
+	q := env.queue()
+	if _, err := q.Add(root.Cid(), true, pinmeta.Meta{Name: "root"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Add(missing.Cid(), true, pinmeta.Meta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	q = env.queue()
+	go q.Run(ctx, DefaultWorkers)
+
+	jobs := waitJobs(t, q, 1)
+	if !jobs[0].Cid.Equals(missing.Cid()) || jobs[0].Status != StatusFailed || jobs[0].Error == "" {
+		t.Fatalf("the pin of a missing object should have failed: %+v", jobs[0])
+	}
+
+	if _, pinned, err := env.pinner.IsPinnedWithType(ctx, root.Cid(), pin.Recursive); err != nil || !pinned {
+		t.Fatalf("root should be pinned recursively (err: %v)", err)
+	}
+	if m, _ := env.meta.Get(root.Cid()); m.Name != "root" {
+		t.Fatalf("the pin should have been named: %+v", m)
+	}
+
+	// jobs added while running are processed too
+	if _, err := q.Add(leaf.Cid(), false, pinmeta.Meta{}); err != nil {
+		t.Fatal(err)
+	}
+	waitJobs(t, q, 1)
+	if _, pinned, err := env.pinner.IsPinnedWithType(ctx, leaf.Cid(), pin.Direct); err != nil || !pinned {
+		t.Fatalf("leaf should be pinned directly (err: %v)", err)
+	}
+
+	if err := q.Remove(jobs[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	waitJobs(t, q, 0)
+}
+
+func TestQueueDeduplicates(t *testing.T) {
+	q := newTestEnv().queue()
+	nd := dag.NodeWithData([]byte("nd"))
+
+	a, err := q.Add(nd.Cid(), true, pinmeta.Meta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := q.Add(nd.Cid(), true, pinmeta.Meta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID != b.ID {
+		t.Fatal("the same pin should only be queued once")
+	}
+
+	// concurrent adds as well
+	other := dag.NodeWithData([]byte("other")).Cid()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := q.Add(other, true, pinmeta.Meta{}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	jobs, err := q.Jobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(jobs))
+	}
+}
@@ -0,0 +1,179 @@
+package pinsvc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is returned by the Client when a pinning service fails a request.
+type Error struct {
+	StatusCode int
+	Failure
+}
+
+func (e *Error) Error() string {
+	if e.Details == "" {
+		return fmt.Sprintf("pinning service error %d: %s", e.StatusCode, e.Reason)
+	}
+	return fmt.Sprintf("pinning service error %d: %s: %s", e.StatusCode, e.Reason, e.Details)
+}
+
+// Client talks to a pinning service.
+type Client struct {
+	endpoint string
+	key      string
+	http     *http.Client
+}
+
+// NewClient returns a client for the pinning service at endpoint, e.g.
+// https://pinning.example.com/api/v1, authenticating with the given access
+// token.
+func NewClient(endpoint, key string) *Client {
+	return &Client{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		key:      key,
+		http:     &http.Client{Timeout: time.Minute},
+	}
+}
+
+// ListOptions filters pin listings. Zero values are not sent, letting the
+// service apply its defaults.
+type ListOptions struct {
+	Cids   []string
+	Name   string
+	Match  string
+	Status []Status
+	Before time.Time
+	After  time.Time
+	Limit  int
+	Meta   map[string]string
+}
+
+func (o ListOptions) values() (url.Values, error) {
+	v := make(url.Values)
+	if len(o.Cids) > 0 {
+		v.Set("cid", strings.Join(o.Cids, ","))
+	}
+	if o.Name != "" {
+		v.Set("name", o.Name)
+	}
+	if o.Match != "" {
+		v.Set("match", o.Match)
+	}
+	if len(o.Status) > 0 {
+		statuses := make([]string, len(o.Status))
+		for i, s := range o.Status {
+			statuses[i] = string(s)
+		}
+		v.Set("status", strings.Join(statuses, ","))
+	}
+	if !o.Before.IsZero() {
+		v.Set("before", o.Before.UTC().Format(time.RFC3339))
+	}
+	if !o.After.IsZero() {
+		v.Set("after", o.After.UTC().Format(time.RFC3339))
+	}
+	if o.Limit > 0 {
+		v.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if len(o.Meta) > 0 {
+		meta, err := json.Marshal(o.Meta)
+		if err != nil {
+			return nil, err
+		}
+		v.Set("meta", string(meta))
+	}
+	return v, nil
+}
+
+// Ls lists the pin requests matching the given options.
+func (c *Client) Ls(ctx context.Context, opts ListOptions) (*PinResults, error) {
+	q, err := opts.values()
+	if err != nil {
+		return nil, err
+	}
+
+	res := new(PinResults)
+	return res, c.do(ctx, http.MethodGet, "/pins?"+q.Encode(), nil, res)
+}
+
+// Add asks the service to pin an object.
+func (c *Client) Add(ctx context.Context, p Pin) (*PinStatus, error) {
+	st := new(PinStatus)
+	return st, c.do(ctx, http.MethodPost, "/pins", p, st)
+}
+
+// Get returns the status of a pin request.
+func (c *Client) Get(ctx context.Context, requestID string) (*PinStatus, error) {
+	st := new(PinStatus)
+	return st, c.do(ctx, http.MethodGet, "/pins/"+url.PathEscape(requestID), nil, st)
+}
+
+// Replace replaces a pin request with a new one.
+func (c *Client) Replace(ctx context.Context, requestID string, p Pin) (*PinStatus, error) {
+	st := new(PinStatus)
+	return st, c.do(ctx, http.MethodPost, "/pins/"+url.PathEscape(requestID), p, st)
+}
+
+// Rm removes a pin request, letting the service unpin the object.
+func (c *Client) Rm(ctx context.Context, requestID string) error {
+	return c.do(ctx, http.MethodDelete, "/pins/"+url.PathEscape(requestID), nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, p string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.endpoint+p, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+c.key)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		e := &Error{StatusCode: res.StatusCode}
+		data, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1<<16))
+		var er ErrorResponse
+		if json.Unmarshal(data, &er) == nil && er.Error.Reason != "" {
+			e.Failure = er.Error
+		} else {
+			e.Reason = http.StatusText(res.StatusCode)
+			e.Details = strings.TrimSpace(string(data))
+		}
+		return e
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response from pinning service: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package pinsvc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// a minimal in-memory pinning service
+type standIn struct {
+	pins map[string]PinStatus
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: Failure{Reason: "UNAUTHORIZED"}})
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/pins":
+		res := PinResults{Results: []PinStatus{}}
+		for _, st := range s.pins {
+			if c := r.URL.Query().Get("cid"); c != "" && c != st.Pin.Cid {
+				continue
+			}
+			res.Results = append(res.Results, st)
+		}
+		res.Count = len(res.Results)
+		json.NewEncoder(w).Encode(res)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/pins":
+		var p Pin
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		st := PinStatus{RequestID: p.Cid, Status: StatusPinned, Created: time.Now(), Pin: p}
+		s.pins[st.RequestID] = st
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(st)
+	case r.Method == http.MethodDelete:
+		id := r.URL.Path[len("/api/pins/"):]
+		if _, ok := s.pins[id]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: Failure{Reason: "NOT_FOUND", Details: "no such pin"}})
+			return
+		}
+		delete(s.pins, id)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	ts := httptest.NewServer(&standIn{pins: make(map[string]PinStatus)})
+	defer ts.Close()
+
+	if _, err := NewClient(ts.URL+"/api", "wrong").Ls(ctx, ListOptions{}); err == nil {
+		t.Fatal("expected an error with a bad token")
+	} else if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusUnauthorized || e.Reason != "UNAUTHORIZED" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c := NewClient(ts.URL+"/api/", "secret")
+
+	st, err := c.Add(ctx, Pin{Cid: "bafyfoo", Name: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != StatusPinned || st.Pin.Name != "foo" {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	if _, err := c.Add(ctx, Pin{Cid: "bafybar"}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.Ls(ctx, ListOptions{Cids: []string{"bafyfoo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Count != 1 || res.Results[0].RequestID != "bafyfoo" {
+		t.Fatalf("unexpected results: %+v", res)
+	}
+
+	if err := c.Rm(ctx, "bafyfoo"); err != nil {
+		t.Fatal(err)
+	}
+	err = c.Rm(ctx, "bafyfoo")
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusNotFound || e.Details != "no such pin" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestListOptions(t *testing.T) {
+	v, err := ListOptions{
+		Cids:   []string{"a", "b"},
+		Status: []Status{StatusQueued, StatusPinning},
+		After:  time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Limit:  5,
+		Meta:   map[string]string{"k": "v"},
+	}.values()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "after=2020-01-02T03%3A04%3A05Z&cid=a%2Cb&limit=5&meta=%7B%22k%22%3A%22v%22%7D&status=queued%2Cpinning"
+	if v.Encode() != expected {
+		t.Fatalf("expected %s, got %s", expected, v.Encode())
+	}
+}
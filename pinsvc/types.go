@@ -0,0 +1,81 @@
+// Package pinsvc holds the types of the IPFS Pinning Service HTTP API.
+//
+// See https://ipfs.github.io/pinning-services-api-spec/ for the
+// specification.
+package pinsvc
+
+import (
+	"fmt"
+	"time"
+)
+
+// Status is the status of a pin request.
+type Status string
+
+// The statuses a pin request goes through.
+const (
+	StatusQueued  Status = "queued"
+	StatusPinning Status = "pinning"
+	StatusPinned  Status = "pinned"
+	StatusFailed  Status = "failed"
+)
+
+// ParseStatus parses a pin request status.
+func ParseStatus(s string) (Status, error) {
+	switch st := Status(s); st {
+	case StatusQueued, StatusPinning, StatusPinned, StatusFailed:
+		return st, nil
+	default:
+		return "", fmt.Errorf("invalid pin status %q", s)
+	}
+}
+
+// Pin describes an object to pin.
+type Pin struct {
+	Cid     string            `json:"cid"`
+	Name    string            `json:"name,omitempty"`
+	Origins []string          `json:"origins,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// PinStatus describes a pin request and its current status.
+type PinStatus struct {
+	RequestID string            `json:"requestid"`
+	Status    Status            `json:"status"`
+	Created   time.Time         `json:"created"`
+	Pin       Pin               `json:"pin"`
+	Delegates []string          `json:"delegates"`
+	Info      map[string]string `json:"info,omitempty"`
+}
+
+// PinResults is a page of pin requests, along with the total number of pin
+// requests matching the query.
+type PinResults struct {
+	Count   int         `json:"count"`
+	Results []PinStatus `json:"results"`
+}
+
+// The name matching strategies of pin listings.
+const (
+	MatchExact    = "exact"
+	MatchIExact   = "iexact"
+	MatchPartial  = "partial"
+	MatchIPartial = "ipartial"
+)
+
+// Limits of pin listings.
+const (
+	DefaultLimit = 10
+	MaxLimit     = 1000
+)
+
+// Failure details an error returned by a pinning service.
+type Failure struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details,omitempty"`
+}
+
+// ErrorResponse is the body of the responses of a pinning service on errors.
+type ErrorResponse struct {
+	Error Failure `json:"error"`
+}
@@ -0,0 +1,14 @@
+package plugin
+
+import (
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+// PluginKeystore is an interface that can be implemented to add new keystore
+// backends, selected by setting Keystore.Type in the config to the type name.
+type PluginKeystore interface {
+	Plugin
+
+	KeystoreTypeName() string
+	KeystoreConstructor() fsrepo.KeystoreConstructor
+}
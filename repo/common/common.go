@@ -5,6 +5,17 @@ import (
 	"strings"
 )
 
+// KeyNotFoundError is returned by MapGetKV when the key, or one of its
+// parents, is missing.
+type KeyNotFoundError struct {
+	// Parent is the deepest parent of the key that was found.
+	Parent string
+}
+
+func (e *KeyNotFoundError) Error() string {
+	return fmt.Sprintf("%s key has no attributes", e.Parent)
+}
+
 func MapGetKV(v map[string]interface{}, key string) (interface{}, error) {
 	var ok bool
 	var mcursor map[string]interface{}
@@ -21,7 +32,7 @@ func MapGetKV(v map[string]interface{}, key string) (interface{}, error) {
 
 		cursor, ok = mcursor[part]
 		if !ok {
-			return nil, fmt.Errorf("%s key has no attributes", sofar)
+			return nil, &KeyNotFoundError{Parent: sofar}
 		}
 	}
 	return cursor, nil
@@ -0,0 +1,33 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	common "github.com/ipfs/go-ipfs/repo/common"
+)
+
+// LoadConfigSection decodes the given key of the config of the repo into v,
+// which is left untouched if the key is missing. Sections unknown to the
+// config struct are read this way.
+func LoadConfigSection(r Repo, key string, v interface{}) error {
+	val, err := r.GetConfigKey(key)
+	if err != nil {
+		var notFound *common.KeyNotFoundError
+		if errors.As(err, &notFound) {
+			// the section is optional
+			return nil
+		}
+		return err
+	}
+
+	b, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("invalid %s config: %s", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package repo
+
+import (
+	"errors"
+	"testing"
+
+	config "github.com/ipfs/go-ipfs-config"
+)
+
+type failingConfigRepo struct {
+	Mock
+}
+
+func (r *failingConfigRepo) GetConfigKey(key string) (interface{}, error) {
+	return nil, errors.New("unreadable config")
+}
+
+func TestLoadConfigSection(t *testing.T) {
+	r := &Mock{C: config.Config{Datastore: config.Datastore{StorageMax: "10GB"}}}
+
+	v := "default"
+	if err := LoadConfigSection(r, "Datastore.StorageMax", &v); err != nil || v != "10GB" {
+		t.Fatalf("expected the key to be loaded, got %q, %v", v, err)
+	}
+
+	v = "default"
+	if err := LoadConfigSection(r, "Missing.Key", &v); err != nil || v != "default" {
+		t.Fatalf("expected the missing key to be ignored, got %q, %v", v, err)
+	}
+
+	var n int
+	if err := LoadConfigSection(r, "Datastore.StorageMax", &n); err == nil {
+		t.Fatal("expected invalid values to be rejected")
+	}
+
+	if err := LoadConfigSection(&failingConfigRepo{}, "Missing.Key", &v); err == nil {
+		t.Fatal("expected the errors reading the config to be returned")
+	}
+}
@@ -65,6 +65,7 @@ func (err NoRepoError) Error() string {
 
 const apiFile = "api"
 const swarmKeyFile = "swarm.key"
+const keystoreDir = "keystore"
 
 const specFn = "datastore_spec"
 
@@ -384,8 +385,12 @@ func (r *FSRepo) openConfig() error {
 }
 
 func (r *FSRepo) openKeystore() error {
-	ksp := filepath.Join(r.path, "keystore")
-	ks, err := keystore.NewFSKeystore(ksp)
+	params, err := r.keystoreConfig()
+	if err != nil {
+		return err
+	}
+
+	ks, err := AnyKeystore(r.path, params)
 	if err != nil {
 		return err
 	}
@@ -395,6 +400,29 @@ func (r *FSRepo) openKeystore() error {
 	return nil
 }
 
+// keystoreConfig reads the Keystore config section. The section is not part
+// of the config structure, so it is read from the raw config file.
+func (r *FSRepo) keystoreConfig() (map[string]interface{}, error) {
+	configFilename, err := config.Filename(r.path)
+	if err != nil {
+		return nil, err
+	}
+	var mapconf map[string]interface{}
+	if err := serialize.ReadConfigFile(configFilename, &mapconf); err != nil {
+		return nil, err
+	}
+
+	v, ok := mapconf[keystoreSection]
+	if !ok || v == nil {
+		return map[string]interface{}{}, nil
+	}
+	params, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s config must be an object", keystoreSection)
+	}
+	return params, nil
+}
+
 // openDatastore returns an error if the config file is not present.
 func (r *FSRepo) openDatastore() error {
 	if r.config.Datastore.Type != "" || r.config.Datastore.Path != "" {
@@ -2,15 +2,18 @@ package fsrepo
 
 import (
 	"bytes"
+	"crypto/rand"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
 
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	"github.com/ipfs/go-ipfs/thirdparty/assert"
 
 	datastore "github.com/ipfs/go-datastore"
 	config "github.com/ipfs/go-ipfs-config"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
 )
 
 // swap arg order
@@ -116,3 +119,100 @@ func TestOpenMoreThanOnceInSameProcess(t *testing.T) {
 	assert.Nil(r1.Close(), t)
 	assert.Nil(r2.Close(), t)
 }
+
+func TestConfigKeepsUnknownSections(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("config", t)
+	defer Remove(path)
+
+	conf := &config.Config{
+		Identity:  config.Identity{PrivKey: "private"},
+		Datastore: config.DefaultDatastoreConfig(),
+	}
+	assert.Nil(Init(path, conf), t)
+
+	r, err := Open(path)
+	assert.Nil(err, t)
+	defer r.Close()
+
+	assert.Nil(r.SetConfigKey("GC.Mode", "lru"), t)
+
+	// writing other keys, or the whole config, keeps the section
+	assert.Nil(r.SetConfigKey("Datastore.StorageMax", "20GB"), t)
+	cfg, err := r.Config()
+	assert.Nil(err, t)
+	assert.Nil(r.SetConfig(cfg), t)
+
+	v, err := r.GetConfigKey("GC.Mode")
+	assert.Nil(err, t)
+	assert.True(v == "lru", t, "the GC.Mode key should be kept")
+}
+
+func TestEncryptKeystore(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("keystore", t)
+	defer Remove(path)
+
+	conf := &config.Config{
+		Identity:  config.Identity{PrivKey: "private"},
+		Datastore: config.DefaultDatastoreConfig(),
+	}
+	assert.Nil(Init(path, conf), t, "should initialize successfully")
+	r, err := Open(path)
+	assert.Nil(err, t, "should open successfully")
+
+	sk, _, err := ci.GenerateEd25519Key(rand.Reader)
+	assert.Nil(err, t)
+	assert.Nil(r.Keystore().Put("foo", sk), t, "Put should be successful")
+	assert.Nil(r.Close(), t)
+
+	assert.Nil(EncryptKeystore(path, []byte("hunter2")), t, "should encrypt the keystore")
+
+	oldPassphrase := KeystorePassphrase
+	defer func() { KeystorePassphrase = oldPassphrase }()
+	KeystorePassphrase = func() ([]byte, error) { return []byte("hunter2"), nil }
+
+	r, err = Open(path)
+	assert.Nil(err, t, "should open successfully")
+	defer r.Close()
+
+	_, ok := r.Keystore().(*keystore.EncryptedKeystore)
+	assert.True(ok, t, "keystore should be encrypted")
+
+	out, err := r.Keystore().Get("foo")
+	assert.Nil(err, t, "Get should be successful")
+	assert.True(sk.Equals(out), t, "keys should match")
+}
+
+func TestKeystoreHandler(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("keystore", t)
+	defer Remove(path)
+
+	mks := keystore.NewMemKeystore()
+	err := AddKeystoreHandler("test-mem", func(repoPath string, params map[string]interface{}) (keystore.Keystore, error) {
+		assert.True(params["Socket"] == "/tmp/agent.sock", t, "should pass the config section")
+		return mks, nil
+	})
+	assert.Nil(err, t, "should register the keystore")
+	assert.Err(AddKeystoreHandler("test-mem", nil), t, "should refuse to register the keystore twice")
+
+	conf := &config.Config{
+		Identity:  config.Identity{PrivKey: "private"},
+		Datastore: config.DefaultDatastoreConfig(),
+	}
+	assert.Nil(Init(path, conf), t, "should initialize successfully")
+	r, err := Open(path)
+	assert.Nil(err, t, "should open successfully")
+	assert.Nil(r.SetConfigKey("Keystore", map[string]interface{}{
+		"Type":   "test-mem",
+		"Socket": "/tmp/agent.sock",
+	}), t)
+	assert.Nil(r.Close(), t)
+
+	r, err = Open(path)
+	assert.Nil(err, t, "should open successfully")
+	defer r.Close()
+
+	assert.True(r.Keystore() == mks, t, "should use the registered keystore")
+}
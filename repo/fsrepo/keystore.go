@@ -0,0 +1,133 @@
+package fsrepo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	keystore "github.com/ipfs/go-ipfs/keystore"
+)
+
+// keystoreSection is the config section configuring the keystore.
+const keystoreSection = "Keystore"
+
+// KeystoreTypeSelector is the config key selecting the keystore backend.
+const KeystoreTypeSelector = keystoreSection + ".Type"
+
+// Keystore backends selectable through the Keystore.Type config key.
+const (
+	// KeystoreTypeFS stores keys in plaintext files, this is the default.
+	KeystoreTypeFS = "fs"
+	// KeystoreTypeEncrypted stores keys encrypted with a passphrase.
+	KeystoreTypeEncrypted = "encrypted"
+)
+
+// KeystoreConstructor creates a keystore for the repo at repoPath. params is
+// the Keystore section of the config.
+type KeystoreConstructor func(repoPath string, params map[string]interface{}) (keystore.Keystore, error)
+
+var (
+	keystoresLk sync.RWMutex
+	keystores   map[string]KeystoreConstructor
+)
+
+func init() {
+	keystores = map[string]KeystoreConstructor{
+		KeystoreTypeFS:        FSKeystore,
+		KeystoreTypeEncrypted: EncryptedKeystore,
+	}
+}
+
+// AddKeystoreHandler registers a keystore backend, selectable by setting
+// Keystore.Type to name.
+func AddKeystoreHandler(name string, ctor KeystoreConstructor) error {
+	keystoresLk.Lock()
+	defer keystoresLk.Unlock()
+
+	_, ok := keystores[name]
+	if ok {
+		return fmt.Errorf("already have a keystore named %q", name)
+	}
+
+	keystores[name] = ctor
+	return nil
+}
+
+// AnyKeystore creates the keystore of the repo at repoPath based on the "Type"
+// parameter, defaulting to a plaintext FSKeystore.
+func AnyKeystore(repoPath string, params map[string]interface{}) (keystore.Keystore, error) {
+	which := KeystoreTypeFS
+	if v, ok := params["Type"]; ok {
+		which, ok = v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a string", KeystoreTypeSelector)
+		}
+		if which == "" {
+			which = KeystoreTypeFS
+		}
+	}
+
+	keystoresLk.RLock()
+	ctor, ok := keystores[which]
+	keystoresLk.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown keystore type: %q", which)
+	}
+
+	return ctor(repoPath, params)
+}
+
+// FSKeystore creates a plaintext keystore under the repo directory.
+func FSKeystore(repoPath string, params map[string]interface{}) (keystore.Keystore, error) {
+	return keystore.NewFSKeystore(filepath.Join(repoPath, keystoreDir))
+}
+
+// EncryptedKeystore creates a passphrase-encrypted keystore under the repo
+// directory, unlocked with KeystorePassphrase.
+func EncryptedKeystore(repoPath string, params map[string]interface{}) (keystore.Keystore, error) {
+	return keystore.NewEncryptedKeystore(filepath.Join(repoPath, keystoreDir), func() ([]byte, error) {
+		return KeystorePassphrase()
+	})
+}
+
+// EnvKeystorePassphrase is the environment variable holding the passphrase
+// of an encrypted keystore.
+const EnvKeystorePassphrase = "IPFS_KEYSTORE_PASSPHRASE"
+
+// KeystorePassphrase is used to unlock encrypted keystores. It reads the
+// passphrase from the IPFS_KEYSTORE_PASSPHRASE environment variable by
+// default, frontends may replace it to prompt the user instead.
+var KeystorePassphrase keystore.PassphraseFunc = EnvPassphrase
+
+// EnvPassphrase reads the keystore passphrase from the environment.
+func EnvPassphrase() ([]byte, error) {
+	pass, ok := os.LookupEnv(EnvKeystorePassphrase)
+	if !ok {
+		return nil, fmt.Errorf("keystore is encrypted, set %s to unlock it", EnvKeystorePassphrase)
+	}
+	return []byte(pass), nil
+}
+
+// EncryptKeystore encrypts the plaintext keystore of the repo at repoPath in
+// place and switches the repo to the encrypted keystore backend. The repo must
+// not be in use, not even by the current process.
+func EncryptKeystore(repoPath string, passphrase []byte) error {
+	// bypass onlyOne, we must not share the repo with a running node
+	r, err := open(repoPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	fsr := r.(*FSRepo)
+	if _, ok := fsr.keystore.(*keystore.FSKeystore); !ok {
+		return fmt.Errorf("keystore is not a plaintext keystore")
+	}
+
+	if err := keystore.EncryptFSKeystore(filepath.Join(fsr.path, keystoreDir), passphrase); err != nil {
+		return err
+	}
+
+	return r.SetConfigKey(KeystoreTypeSelector, KeystoreTypeEncrypted)
+}
@@ -70,3 +70,11 @@ func (r *ref) Close() error {
 	delete(r.parent.active, r.key)
 	return r.Repo.Close()
 }
+
+// Path returns the path of the underlying repo, if it has one.
+func (r *ref) Path() string {
+	if pr, ok := r.Repo.(interface{ Path() string }); ok {
+		return pr.Path()
+	}
+	return ""
+}
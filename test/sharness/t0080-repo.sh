@@ -113,6 +113,37 @@ test_expect_success "'ipfs repo gc' removes file" '
   grep "removed $HASH" actual7
 '
 
+test_expect_success "'ipfs repo gc --concurrent' removes unpinned file" '
+  echo "concurrent gc" >cfile &&
+  CHASH=`ipfs add -q --pin=false cfile` &&
+  ipfs repo gc --concurrent >actual_concurrent &&
+  grep "removed $CHASH" actual_concurrent
+'
+
+test_expect_success "'ipfs repo gc --concurrent' keeps pinned files" '
+  test_must_fail grep "removed $HASH_WELCOME_DOCS" actual_concurrent &&
+  ipfs cat "$HASH_WELCOME_DOCS/readme" >/dev/null
+'
+
+test_expect_success "'ipfs repo gc --dry-run' lists unpinned file without removing it" '
+  echo "dry run gc" >dfile &&
+  DHASH=`ipfs add -q --pin=false dfile` &&
+  ipfs repo gc --dry-run >actual_dryrun &&
+  grep "would remove $DHASH" actual_dryrun &&
+  grep "would free" actual_dryrun &&
+  ipfs block stat "$DHASH"
+'
+
+test_expect_success "'ipfs repo gc --explain' reports unpinned block" '
+  ipfs repo gc --explain "$DHASH" >actual_explain &&
+  grep "$DHASH is not pinned and would be removed" actual_explain
+'
+
+test_expect_success "'ipfs repo gc --explain' reports the pin keeping a block" '
+  ipfs repo gc --explain "$HASH_WELCOME_DOCS" >actual_explain &&
+  grep "$HASH_WELCOME_DOCS is kept by recursive pin $HASH_WELCOME_DOCS" actual_explain
+'
+
 test_expect_success "'ipfs refs local' no longer shows file" '
   EMPTY_DIR=QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn &&
   ipfs refs local >actual8 &&
@@ -164,6 +164,107 @@ test_pin_progress() {
   '
 }
 
+test_pin_meta() {
+  test_expect_success "create some hashes for named pins" '
+    HASH_N1=$(echo "named 1" | ipfs add -q --pin=false) &&
+    HASH_N2=$(echo "named 2" | ipfs add -q --pin=false) &&
+    HASH_N3=$(echo "named 3" | ipfs add -q --pin=false)
+  '
+
+  test_expect_success "'ipfs pin add --name --label' succeeds" '
+    ipfs pin add --name=site --label=team=web --label=env=prod --label="note=a,b" $HASH_N1 &&
+    ipfs pin add --name=backup --label=team=ops $HASH_N2
+  '
+
+  test_expect_success "'ipfs pin ls' shows pin names" '
+    ipfs pin ls --type=recursive >actual &&
+    grep "$HASH_N1 recursive site" actual &&
+    grep "$HASH_N2 recursive backup" actual
+  '
+
+  test_expect_success "'ipfs pin ls --name' filters pins" '
+    echo "$HASH_N1 recursive site" >expected &&
+    ipfs pin ls --name=site >actual &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "'ipfs pin ls --label' filters pins" '
+    echo "$HASH_N2" >expected &&
+    ipfs pin ls -q --label=team=ops >actual &&
+    test_cmp expected actual &&
+    ipfs pin ls -q --label=team=web --label=env=dev >actual &&
+    test_must_be_empty actual
+  '
+
+  test_expect_success "'ipfs pin ls --label' matches labels with commas" '
+    echo "$HASH_N1" >expected &&
+    ipfs pin ls -q --label=team=web --label="note=a,b" >actual &&
+    test_cmp expected actual &&
+    ipfs pin ls -q --label="note=a" >actual &&
+    test_must_be_empty actual
+  '
+
+  test_expect_success "'ipfs pin ls --label' rejects invalid labels" '
+    test_must_fail ipfs pin ls --label=team 2>err &&
+    grep "must be key=value" err
+  '
+
+  test_expect_success "'ipfs pin update' preserves the pin name" '
+    ipfs pin update $HASH_N1 $HASH_N3 &&
+    echo "$HASH_N3 recursive site" >expected &&
+    ipfs pin ls --name=site --label=env=prod >actual &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "'ipfs pin rm' removes the pin name" '
+    ipfs pin rm $HASH_N3 $HASH_N2 &&
+    ipfs pin ls --name=site >actual &&
+    test_must_be_empty actual
+  '
+}
+
+test_pin_background() {
+  test_expect_success "'ipfs pin add --background' queues the pins" '
+    HASH_Q1=$(echo "queued 1" | ipfs add -q --pin=false) &&
+    HASH_Q2=$(echo "queued 2" | ipfs add -q --pin=false --only-hash) &&
+    ipfs pin add --background --name=queued $HASH_Q1 $HASH_Q2 >actual &&
+    echo "queued $HASH_Q1 to be pinned recursively" >expected &&
+    echo "queued $HASH_Q2 to be pinned recursively" >>expected &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "'ipfs pin status' lists the queued pins" '
+    ipfs pin status >actual &&
+    grep "$HASH_Q1 queued" actual &&
+    grep "$HASH_Q2 queued" actual
+  '
+}
+
+test_pin_background_resumed() {
+  test_expect_success "queued pins are processed by the daemon" '
+    for i in $(test_seq 1 50); do
+      ipfs pin status >actual &&
+      grep "$HASH_Q2 failed" actual && break
+      go-sleep 100ms
+    done &&
+    echo "$HASH_Q1 recursive queued" >expected &&
+    ipfs pin ls --type=recursive $HASH_Q1 >actual &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "'ipfs pin status' reports failed pins" '
+    ipfs pin status >actual &&
+    grep "$HASH_Q2 failed: merkledag: not found" actual &&
+    test_must_fail grep "$HASH_Q1" actual
+  '
+
+  test_expect_success "'ipfs pin status --clear' forgets failed pins" '
+    ipfs pin status --clear &&
+    ipfs pin status >actual &&
+    test_must_be_empty actual
+  '
+}
+
 test_init_ipfs
 
 test_pins '' '' ''
@@ -180,6 +281,10 @@ test_pin_dag --raw-leaves
 
 test_pin_progress
 
+test_pin_meta
+
+test_pin_background
+
 test_launch_ipfs_daemon --offline
 
 test_pins '' '' ''
@@ -196,6 +301,10 @@ test_pin_dag --raw-leaves
 
 test_pin_progress
 
+test_pin_meta
+
+test_pin_background_resumed
+
 test_kill_ipfs_daemon
 
 test_done
@@ -0,0 +1,112 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs remote pinning operations"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+# the node serves the pinning service API itself, standing in for a remote
+# pinning service
+test_expect_success "enable the pinning service API" '
+  ipfs config --json PinningService "{\"Enabled\": true, \"AccessTokens\": [\"secret\"]}"
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "add remote pinning services" '
+  ipfs pin remote service add test "http://$GWAY_ADDR/pinning" secret &&
+  ipfs pin remote service add bad "http://$GWAY_ADDR/pinning" wrong
+'
+
+test_expect_success "remote pinning services are listed" '
+  ipfs pin remote service ls >actual &&
+  printf "bad\thttp://$GWAY_ADDR/pinning\ntest\thttp://$GWAY_ADDR/pinning\n" >expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "the keys of remote pinning services aren't shown" '
+  ipfs config show >config_out &&
+  grep "http://$GWAY_ADDR/pinning" config_out &&
+  test_must_fail grep "\"Key\"" config_out &&
+  ipfs config Pinning.RemoteServices >config_out &&
+  test_must_fail grep "\"Key\"" config_out &&
+  test_must_fail ipfs config Pinning.RemoteServices.test.API.Key
+'
+
+test_expect_success "adding a service twice fails" '
+  test_must_fail ipfs pin remote service add test "http://$GWAY_ADDR/pinning" secret 2>err &&
+  grep "already exists" err
+'
+
+test_expect_success "add some content" '
+  HASH_A=$(echo "A" | ipfs add -q --pin=false) &&
+  HASH_B=$(echo "B" | ipfs add -q --pin=false)
+'
+
+test_expect_success "pin remote add waits for the pin" '
+  ipfs pin remote add --service=test --name=a $HASH_A >actual &&
+  printf "$HASH_A\tpinned\ta\n" >expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "pin remote add --background returns immediately" '
+  ipfs pin remote add --service=test --background $HASH_B >actual &&
+  grep "^$HASH_B" actual
+'
+
+test_expect_success "pin remote ls lists the pins" '
+  ipfs pin remote ls --service=test --status=queued,pinning,pinned >actual &&
+  grep "$HASH_A" actual &&
+  grep "$HASH_B" actual
+'
+
+test_expect_success "pin remote ls filters by name" '
+  ipfs pin remote ls --service=test --name=a >actual &&
+  printf "$HASH_A\tpinned\ta\n" >expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "remote pins are pinned by the service" '
+  ipfs pin ls --type=recursive $HASH_A
+'
+
+test_expect_success "a bad access token is rejected" '
+  test_must_fail ipfs pin remote ls --service=bad 2>err &&
+  grep "UNAUTHORIZED" err
+'
+
+test_expect_success "an unknown service is rejected" '
+  test_must_fail ipfs pin remote ls --service=nope 2>err &&
+  grep "not found" err
+'
+
+test_expect_success "pin remote rm needs a filter" '
+  test_must_fail ipfs pin remote rm --service=test
+'
+
+test_expect_success "removing several pins needs --force" '
+  test_must_fail ipfs pin remote rm --service=test --cid=$HASH_A,$HASH_B 2>err &&
+  grep "force" err
+'
+
+test_expect_success "pin remote rm removes the pin" '
+  ipfs pin remote rm --service=test --cid=$HASH_A &&
+  ipfs pin remote ls --service=test --cid=$HASH_A >actual &&
+  test_must_be_empty actual &&
+  test_must_fail ipfs pin ls --type=recursive $HASH_A
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "remove a remote pinning service" '
+  ipfs pin remote service rm bad &&
+  ipfs pin remote service ls >actual &&
+  printf "test\thttp://$GWAY_ADDR/pinning\n" >expected &&
+  test_cmp expected actual
+'
+
+test_done
@@ -0,0 +1,105 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the denylist of the gateway and commands"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add some content" '
+  mkdir -p dir &&
+  echo "public" >dir/public &&
+  echo "private" >dir/private &&
+  mkdir dir/sub &&
+  echo "listed" >dir/sub/listed &&
+  echo "other" >dir/sub/other &&
+  LISTED=$(ipfs add -q dir/sub/listed) &&
+  DIR=$(ipfs add -Q -r dir) &&
+  BLOCKED=$(echo "blocked" | ipfs add -q)
+'
+
+test_expect_success "publish the directory under the key of the node" '
+  PEERID=$(ipfs config Identity.PeerID) &&
+  ipfs name publish --allow-offline /ipfs/$DIR
+'
+
+test_expect_success "configure the denylist" '
+  echo "$BLOCKED" >"$IPFS_PATH/denylist" &&
+  echo "$LISTED" >>"$IPFS_PATH/denylist" &&
+  echo "/ipfs/$DIR/private" >>"$IPFS_PATH/denylist" &&
+  ipfs config --json Denylist "{\"Files\": [\"denylist\"]}"
+'
+
+test_expect_success "commands ignore the denylist by default" '
+  ipfs cat $BLOCKED
+'
+
+test_expect_success "enforce the denylist in commands" '
+  ipfs config --json Denylist.Commands true
+'
+
+test_expect_success "ipfs cat refuses blocked content" '
+  test_must_fail ipfs cat $BLOCKED 2>err &&
+  grep "blocked content" err &&
+  test_must_fail ipfs cat /ipfs/$DIR/private 2>err &&
+  grep "blocked content" err &&
+  ipfs cat /ipfs/$DIR/public
+'
+
+test_expect_success "ipfs cat refuses blocked paths reached through IPNS" '
+  test_must_fail ipfs cat /ipns/$PEERID/private 2>err &&
+  grep "blocked content" err &&
+  ipfs cat /ipns/$PEERID/public
+'
+
+test_expect_success "ipfs get refuses blocked content" '
+  test_must_fail ipfs get -o out $BLOCKED 2>err &&
+  grep "blocked content" err
+'
+
+test_expect_success "ipfs get leaves blocked content out of directories" '
+  ipfs get -o out /ipfs/$DIR &&
+  test -f out/public &&
+  test -f out/sub/other &&
+  test ! -e out/private &&
+  test ! -e out/sub/listed
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "the gateway refuses blocked content with a 410" '
+  curl -s -o /dev/null -w "%{http_code}" "http://$GWAY_ADDR/ipfs/$BLOCKED" >actual &&
+  echo 410 >expected &&
+  test_cmp expected actual &&
+  curl -s -o /dev/null -w "%{http_code}" "http://$GWAY_ADDR/ipfs/$DIR/private" >actual &&
+  test_cmp expected actual &&
+  curl -sf "http://$GWAY_ADDR/ipfs/$DIR/public"
+'
+
+test_expect_success "the gateway refuses blocked paths reached through IPNS" '
+  curl -s -o /dev/null -w "%{http_code}" "http://$GWAY_ADDR/ipns/$PEERID/private" >actual &&
+  echo 410 >expected &&
+  test_cmp expected actual &&
+  curl -sf "http://$GWAY_ADDR/ipns/$PEERID/public"
+'
+
+test_expect_success "the gateway aborts CARs of directories with blocked content" '
+  test_must_fail curl -sf -o /dev/null "http://$GWAY_ADDR/ipfs/$DIR?format=car"
+'
+
+test_expect_success "the denylist is reloaded when it changes" '
+  echo "/ipfs/$DIR/public" >>"$IPFS_PATH/denylist" &&
+  for i in $(test_seq 1 30); do
+    code=$(curl -s -o /dev/null -w "%{http_code}" "http://$GWAY_ADDR/ipfs/$DIR/public") &&
+    test "$code" = 410 && break
+    go-sleep 1s
+  done &&
+  test "$code" = 410
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -74,8 +74,81 @@ test_key_cmd() {
     test_must_fail ipfs key rename -f fooed self 2>&1 | tee key_rename_out &&
     grep -q "Error: cannot overwrite key with name" key_rename_out
   '
+
+  test_expect_success "key export writes the key to a file" '
+    fooedhash=$(ipfs key list -l | grep fooed | cut -d" " -f1) &&
+    ipfs key export fooed &&
+    test -f fooed.key
+  '
+
+  test_expect_success "key export can't export self" '
+    test_must_fail ipfs key export self >key_export_out 2>&1 &&
+    grep -q "Error: cannot export key with name" key_export_out
+  '
+
+  test_expect_success "key import refuses to overwrite an existing key" '
+    test_must_fail ipfs key import fooed fooed.key >key_import_out 2>&1 &&
+    grep -q "refusing to overwrite" key_import_out
+  '
+
+  test_expect_success "key import restores the exported key" '
+    ipfs key rm fooed &&
+    ipfs key import fooed fooed.key > import_out &&
+    echo $fooedhash > import_exp &&
+    test_cmp import_exp import_out
+  '
+
+  test_expect_success "key import --force overwrites an existing key" '
+    ipfs key import --force fooed fooed.key > import_out &&
+    test_cmp import_exp import_out
+  '
+
+  test_expect_success "key export and import an encrypted PEM key" '
+    ipfs key export fooed --format=pem-pkcs8-encrypted --password=secret -o fooed.pem &&
+    grep -q "BEGIN ENCRYPTED PRIVATE KEY" fooed.pem &&
+    ipfs key import fooedpem fooed.pem --format=pem-pkcs8-encrypted --password=secret > import_out &&
+    test_cmp import_exp import_out
+  '
+
+  test_expect_success "key import of an encrypted PEM key fails with a wrong password" '
+    test_must_fail ipfs key import fooedbad fooed.pem --format=pem-pkcs8-encrypted --password=wrong
+  '
+
+  test_expect_success "cleanup imported keys" '
+    ipfs key rm fooedpem
+  '
 }
 
 test_key_cmd
 
+test_key_encrypt() {
+  test_expect_success "encrypt the keystore" '
+    IPFS_KEYSTORE_PASSPHRASE=secret ipfs repo encrypt-keystore &&
+    test "$(ipfs config Keystore.Type)" = "encrypted"
+  '
+
+  test_expect_success "keys are no longer stored in plaintext" '
+    for f in "$IPFS_PATH"/keystore/key_*; do
+      head -c 8 "$f" | grep -q IPFSKEY1 || return 1
+    done
+  '
+
+  test_expect_success "encrypted keys can be used with the passphrase" '
+    IPFS_KEYSTORE_PASSPHRASE=secret ipfs key export fooed -o fooed-enc.key &&
+    test_cmp fooed.key fooed-enc.key
+  '
+
+  test_expect_success "encrypted keys can't be used with a wrong passphrase" '
+    test_must_fail env IPFS_KEYSTORE_PASSPHRASE=wrong ipfs key export fooed -o fooed-bad.key >key_export_out 2>&1 &&
+    grep -q "incorrect keystore passphrase" key_export_out
+  '
+
+  test_expect_success "new keys are encrypted" '
+    IPFS_KEYSTORE_PASSPHRASE=secret ipfs key gen encked --type=ed25519 &&
+    IPFS_KEYSTORE_PASSPHRASE=secret ipfs key list | grep encked
+  '
+}
+
+test_key_encrypt
+
 test_done